@@ -2,11 +2,16 @@ package domain
 
 import (
 	"aeds2-tp1/entity"
+	"errors"
 	"fmt"
 	"math/rand"
+	"strconv"
 	"time"
 )
 
+// ErrMatriculasExhausted indica que a próxima matrícula ultrapassaria o limite de dígitos
+var ErrMatriculasExhausted = errors.New("matrículas esgotadas")
+
 type StudentGenerator struct {
 	random *rand.Rand
 }
@@ -17,7 +22,16 @@ func NewStudentGenerator() *StudentGenerator {
 	}
 }
 
+// Generate gera alunos a partir da primeira matrícula, que só se esgotam acima de
+// 899.999.999 alunos
 func (sg *StudentGenerator) Generate(count int) []entity.Student {
+	students, _ := sg.GenerateFrom(100000001, count)
+	return students
+}
+
+// GenerateFrom gera alunos com matrículas consecutivas a partir de first. Se a matrícula
+// ultrapassar o limite de dígitos, devolve os alunos gerados até ali com ErrMatriculasExhausted
+func (sg *StudentGenerator) GenerateFrom(first int, count int) ([]entity.Student, error) {
 	students := make([]entity.Student, 0, count)
 	
 	nomes := []string{
@@ -45,7 +59,10 @@ func (sg *StudentGenerator) Generate(count int) []entity.Student {
 	
 	generated := 0
 	for generated < count {
-		matricula := 100000000 + generated + 1
+		matricula := first + generated
+		if len(strconv.Itoa(matricula)) > entity.MaxMatriculaDigits {
+			return students, fmt.Errorf("%w após %d alunos gerados", ErrMatriculasExhausted, generated)
+		}
 		cpf := sg.generateCPF()
 		anoIngresso := 2015 + sg.random.Intn(10)
 		ca := 5.0 + sg.random.Float64()*5.0
@@ -71,7 +88,7 @@ func (sg *StudentGenerator) Generate(count int) []entity.Student {
 		generated++
 	}
 	
-	return students
+	return students, nil
 }
 
 func (sg *StudentGenerator) generateCPF() string {
@@ -0,0 +1,23 @@
+package domain
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestGenerateFromStopsAtMatriculaLimit(t *testing.T) {
+	generator := NewStudentGenerator()
+
+	students, err := generator.GenerateFrom(999999990, 5)
+	if err != nil || len(students) != 5 || students[4].Matricula != 999999994 {
+		t.Fatalf("GenerateFrom longe do limite: %d alunos, %v", len(students), err)
+	}
+
+	students, err = generator.GenerateFrom(999999990, 20)
+	if !errors.Is(err, ErrMatriculasExhausted) {
+		t.Fatalf("GenerateFrom além do limite devolveu %v", err)
+	}
+	if len(students) != 10 || students[9].Matricula != 999999999 {
+		t.Fatalf("%d alunos gerados antes do limite, esperados 10", len(students))
+	}
+}
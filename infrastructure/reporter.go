@@ -21,6 +21,10 @@ func (r *Reporter) PrintStats() {
 	fmt.Printf("Eficiência total de armazenamento: %.2f%%\n", r.stats.EfficiencyRate)
 	fmt.Printf("Número de blocos parcialmente utilizados: %d\n", r.stats.PartialBlocks)
 	fmt.Printf("Total de bytes utilizados: %d\n", r.stats.TotalBytesUsed)
+	fmt.Printf("Bytes de registros ativos: %d\n", r.stats.TotalLiveBytes)
+	fmt.Printf("Bytes de registros removidos (ainda não recuperados): %d\n", r.stats.TotalDeadBytes)
+	fmt.Printf("Registros removidos ocupando espaço: %d\n", r.stats.TotalTombstones)
+	fmt.Printf("Fragmentação: %.2f%%\n", storage.FragmentationRatio(r.stats))
 	fmt.Printf("Total de bytes disponíveis: %d\n", r.stats.TotalBytesTotal)
 	
 	avgOccupancy := 0.0
@@ -36,11 +40,15 @@ func (r *Reporter) PrintStats() {
 func (r *Reporter) PrintBlockMap() {
 	fmt.Println("\n=== MAPA DE OCUPAÇÃO DOS BLOCOS ===")
 	for _, blockStat := range r.stats.BlockStatsList {
-		fmt.Printf("Bloco %d: %d bytes (%.2f%% cheio) - %d registros\n",
+		fmt.Printf("Bloco %d: %d bytes (%.2f%% cheio) - %d registros",
 			blockStat.BlockNumber+1,
 			blockStat.BytesUsed,
 			blockStat.OccupancyRate,
 			blockStat.RecordsCount)
+		if blockStat.DeadBytes > 0 {
+			fmt.Printf(" - %d bytes removidos", blockStat.DeadBytes)
+		}
+		fmt.Println()
 	}
 }
 
@@ -58,3 +66,160 @@ func (r *Reporter) PrintBlockVisualization() {
 		fmt.Printf("Bloco %3d: [%s] %.2f%%\n", blockStat.BlockNumber+1, bar, blockStat.OccupancyRate)
 	}
 }
+
+func PrintAllocationComparison(results []storage.AllocationPolicyResult) {
+	fmt.Println("\n=== COMPARAÇÃO DE POLÍTICAS DE ALOCAÇÃO ===")
+	fmt.Printf("%-10s %8s %10s %12s\n", "Política", "Blocos", "Parciais", "Eficiência")
+	for _, result := range results {
+		fmt.Printf("%-10s %8d %10d %11.2f%%\n",
+			result.Policy,
+			result.Blocks,
+			result.PartialBlocks,
+			result.EfficiencyRate)
+	}
+}
+
+func PrintOrganizationComparison(results []storage.OrganizationResult) {
+	fmt.Println("\n=== COMPARAÇÃO DE ORGANIZAÇÕES DE ARQUIVO ===")
+	fmt.Printf("%-36s %8s %12s %12s %16s\n", "Organização", "Blocos", "Eficiência", "Encontrados", "Blocos/consulta")
+	for _, result := range results {
+		fmt.Printf("%-36s %8d %11.2f%% %7d/%-4d %16.2f\n",
+			result.Mode,
+			result.Blocks,
+			result.EfficiencyRate,
+			result.Found,
+			result.Lookups,
+			result.AverageLookupReads())
+	}
+	for _, result := range results {
+		if result.Bloom != nil {
+			fmt.Printf("%s: filtros de Bloom descartaram %d blocos; %d falsos positivos (%.4f%%)\n",
+				result.Mode, result.Bloom.BlocksSkipped, result.Bloom.FalsePositives, result.Bloom.FalsePositiveRate())
+		}
+	}
+}
+
+func PrintExternalSortReport(report *storage.ExternalSortReport) {
+	fmt.Println("\n=== ORDENAÇÃO EXTERNA ===")
+	fmt.Printf("Campo: %s\n", report.Field)
+	fmt.Printf("Memória: %d blocos (intercalação de até %d sequências)\n", report.MemoryBlocks, report.MemoryBlocks-1)
+	fmt.Printf("Registros ordenados: %d\n", report.Records)
+	fmt.Printf("Sequências iniciais: %d\n", report.Runs)
+	fmt.Printf("Passadas de intercalação: %d\n", report.Passes)
+	fmt.Printf("Blocos lidos: %d\n", report.BlockReads)
+	fmt.Printf("Blocos gravados: %d\n", report.BlockWrites)
+	fmt.Printf("Total de E/S de blocos: %d\n", report.BlockIOs())
+	fmt.Printf("Arquivo ordenado: %s (%d blocos, tamanho fixo)\n", report.Output, report.OutputBlocks)
+}
+
+func PrintSortedAreaStats(stats *storage.SortedAreaStats) {
+	fmt.Println("\n=== ARQUIVO SEQUENCIAL ORDENADO ===")
+	fmt.Printf("Área principal: %d blocos, %d registros ativos\n", stats.MainBlocks, stats.MainRecords)
+	fmt.Printf("Área de overflow: %d blocos, %d registros ativos\n", stats.OverflowBlocks, stats.OverflowRecords)
+	if stats.OverflowRecords > 0 {
+		fmt.Println("Reorganize o arquivo para intercalar o overflow na área principal.")
+	}
+}
+
+func PrintBloomFilterStats(stats *storage.BloomFilterStats) {
+	fmt.Println("\n=== FILTROS DE BLOOM (MATRÍCULA POR BLOCO) ===")
+	fmt.Printf("Filtros: %d blocos (%d com registros), %d bytes cada, %d funções de hash\n",
+		stats.Blocks, stats.Filters, stats.FilterBytes, stats.Hashes)
+	fmt.Printf("Bits ligados: %.2f%% (falsos positivos esperados: %.4f%%)\n",
+		stats.FillRate, stats.EstimatedFalsePositiveRate())
+	fmt.Printf("Buscas por matrícula sem índice: %d\n", stats.Lookups)
+	fmt.Printf("Blocos descartados pelo filtro: %d\n", stats.BlocksSkipped)
+	fmt.Printf("Blocos lidos: %d (%d falsos positivos)\n", stats.BlocksRead, stats.FalsePositives)
+	fmt.Printf("Taxa de falsos positivos observada: %.4f%%\n", stats.FalsePositiveRate())
+}
+
+func PrintBufferPoolStats(stats storage.BufferPoolStats) {
+	fmt.Println("\n=== BUFFER POOL ===")
+	fmt.Printf("Quadros: %d (%d ocupados, %d sujos), substituição %s\n", stats.Frames, stats.Used, stats.Dirty, stats.Policy)
+	fmt.Printf("Acertos: %d\n", stats.Hits)
+	fmt.Printf("Faltas: %d\n", stats.Misses)
+	fmt.Printf("Taxa de acertos: %.2f%%\n", stats.HitRate())
+	fmt.Printf("Substituições: %d (%d blocos sujos gravados)\n", stats.Evictions, stats.WriteBacks)
+}
+
+func PrintDuplicateMatriculas(duplicates []storage.DuplicateMatricula) {
+	fmt.Println("\n=== MATRÍCULAS REPETIDAS ===")
+	if len(duplicates) == 0 {
+		fmt.Println("Nenhuma matrícula repetida no arquivo.")
+		return
+	}
+
+	records := 0
+	for _, duplicate := range duplicates {
+		fmt.Printf("Matrícula %d: %d registros\n", duplicate.Matricula, len(duplicate.RIDs))
+		for i, rid := range duplicate.RIDs {
+			fmt.Printf("  %v: %s (CPF %s)\n", rid, duplicate.Students[i].Nome, duplicate.Students[i].CPF)
+		}
+		records += len(duplicate.RIDs)
+	}
+	fmt.Printf("\n%d matrículas repetidas em %d registros\n", len(duplicates), records)
+}
+
+func PrintIndexStats(stats *storage.IndexStats) {
+	fmt.Println("\n=== ÍNDICE PRIMÁRIO (MATRÍCULA) ===")
+	fmt.Printf("Estrutura: %s\n", stats.Kind)
+	fmt.Printf("Entradas: %d\n", stats.Entries)
+
+	pageName := "Folhas"
+	if stats.Kind == storage.IndexExtendibleHash {
+		pageName = "Buckets"
+		fmt.Printf("Profundidade global: %d (diretório com %d entradas)\n", stats.GlobalDepth, stats.DirectorySize)
+	} else {
+		fmt.Printf("Altura: %d (%d nós)\n", stats.Height, stats.Nodes)
+	}
+
+	fmt.Printf("%s: %d (capacidade de %d entradas cada)\n", pageName, stats.Pages, stats.PageCapacity)
+	fmt.Printf("Ocupação média: %.2f%% (mínimo %d, máximo %d entradas)\n",
+		stats.OccupancyRate, stats.MinPageEntries, stats.MaxPageEntries)
+
+	for depth, buckets := range stats.LocalDepths {
+		if buckets > 0 {
+			fmt.Printf("Buckets com profundidade local %d: %d\n", depth, buckets)
+		}
+	}
+}
+
+// PrintIndexVerification mostra a situação de cada índice e até maxProblems entradas órfãs e
+// registros faltando por índice
+func PrintIndexVerification(verification *storage.IndexVerification, maxProblems int) {
+	fmt.Println("\n=== VERIFICAÇÃO DOS ÍNDICES ===")
+	fmt.Printf("Registros ativos no arquivo de dados: %d\n", verification.Records)
+
+	for _, check := range verification.Checks {
+		fmt.Printf("\nÍndice %s (%s)\n", check.Name, check.Filename)
+		fmt.Printf("Situação: %s\n", check.Status)
+		if check.Status == storage.IndexAbsent || check.Status == storage.IndexInvalid {
+			continue
+		}
+
+		fmt.Printf("Entradas: %d\n", check.Entries)
+		fmt.Printf("Entradas órfãs: %d\n", len(check.Orphans))
+		printIndexProblems(check.Orphans, maxProblems)
+		fmt.Printf("Registros sem entrada: %d\n", len(check.Missing))
+		printIndexProblems(check.Missing, maxProblems)
+		if check.Duplicates > 0 {
+			fmt.Printf("Registros com chave repetida (não indexados): %d\n", check.Duplicates)
+		}
+	}
+
+	if verification.Consistent() {
+		fmt.Println("\nTodos os índices estão consistentes com o arquivo de dados.")
+	} else {
+		fmt.Println("\nHá índices inconsistentes; reconstrua-os a partir do arquivo de dados.")
+	}
+}
+
+func printIndexProblems(problems []storage.IndexProblem, maxProblems int) {
+	for i, problem := range problems {
+		if i == maxProblems {
+			fmt.Printf("  ... e mais %d\n", len(problems)-maxProblems)
+			return
+		}
+		fmt.Printf("  chave %s em %v: %s\n", problem.Key, problem.RID, problem.Reason)
+	}
+}
@@ -18,89 +18,114 @@ func main() {
 	fmt.Println("=== Sistema de Armazenamento de Registros de Alunos ===")
 	fmt.Println()
 
-	if _, err := os.Stat(filename); err == nil {
-		err := os.Remove(filename)
+	reader := bufio.NewReader(os.Stdin)
+
+	var storageImpl storage.Storage
+	var err error
+
+	if _, statErr := os.Stat(filename); statErr == nil {
+		storageImpl, err = chooseStartupMode(reader)
+	} else {
+		storageImpl, err = createNewDataFile(reader)
+	}
+
+	if err != nil {
+		fmt.Printf("Erro: %v\n", err)
+		return
+	}
+
+	showStorageReport(storageImpl)
+
+	runQueryMode(reader, storageImpl)
+}
+
+func chooseStartupMode(reader *bufio.Reader) (storage.Storage, error) {
+	header, headerErr := storage.ReadFileHeader(filename)
+	if headerErr != nil {
+		fmt.Printf("Arquivo %s encontrado, mas não pode ser aberto: %v\n", filename, headerErr)
+	} else {
+		fmt.Printf("Arquivo %s encontrado:\n", filename)
+		fmt.Printf("  Modo: %s\n", header.Mode)
+		fmt.Printf("  Tamanho do bloco: %d bytes\n", header.BlockSize)
+		fmt.Printf("  Registros: %d\n", header.RecordCount)
+		fmt.Printf("  Criado em: %s\n", header.CreatedAt.Format("02/01/2006 15:04:05"))
+	}
+
+	fmt.Println("\n1 - Abrir arquivo existente")
+	fmt.Println("2 - Criar novo arquivo (o atual será apagado)")
+	option := readInt(reader, "Escolha uma opção (1 ou 2): ")
+
+	if option == 1 {
+		if headerErr != nil {
+			return nil, headerErr
+		}
+		storageImpl, _, err := storage.OpenStorage(filename)
 		if err != nil {
-			fmt.Printf("Aviso: não foi possível deletar o arquivo %s existente: %v\n", filename, err)
-		} else {
-			fmt.Printf("Arquivo %s existente foi deletado. Criando novo arquivo.\n", filename)
+			return nil, err
 		}
+		fmt.Printf("Arquivo %s aberto com sucesso!\n", filename)
+		return storage.NewIndexedStorage(storageImpl), nil
 	}
 
-	reader := bufio.NewReader(os.Stdin)
+	err := storage.RemoveDataFile(filename)
+	if err != nil {
+		fmt.Printf("Aviso: não foi possível deletar o arquivo %s existente: %v\n", filename, err)
+	} else {
+		fmt.Printf("Arquivo %s existente foi deletado. Criando novo arquivo.\n", filename)
+	}
 
+	return createNewDataFile(reader)
+}
+
+func createNewDataFile(reader *bufio.Reader) (storage.Storage, error) {
 	numRecords := readInt(reader, "Digite o número de registros a serem gerados: ")
 	blockSize := readInt(reader, "Digite o tamanho máximo do bloco (em bytes): ")
 
 	fmt.Println("\nModo de armazenamento:")
 	fmt.Println("1 - Registros de tamanho fixo")
 	fmt.Println("2 - Registros de tamanho variável")
-	storageMode := readInt(reader, "Escolha o modo (1 ou 2): ")
-
-	var storageImpl storage.Storage
-	var err error
+	fmt.Println("3 - Sequencial ordenado por matrícula (tamanho fixo)")
+	storageMode := readInt(reader, "Escolha o modo (1, 2 ou 3): ")
 
+	mode := storage.ModeVariable
 	if storageMode == 1 {
-		storageImpl, err = storage.NewFixedStorage(blockSize)
-		if err != nil {
-			fmt.Printf("Erro: %v\n", err)
-			return
-		}
+		mode = storage.ModeFixed
+	} else if storageMode == 3 {
+		mode = storage.ModeSorted
 	} else if storageMode == 2 {
 		fmt.Println("\nTipo de armazenamento variável:")
 		fmt.Println("1 - Contíguo (sem espalhamento)")
 		fmt.Println("2 - Espalhado (com fragmentação entre blocos)")
 		fragmentedMode := readInt(reader, "Escolha o tipo (1 ou 2): ")
 
-		if fragmentedMode == 1 {
-			storageImpl, err = storage.NewVariableStorage(blockSize)
-			if err != nil {
-				fmt.Printf("Erro: %v\n", err)
-				return
-			}
-		} else if fragmentedMode == 2 {
-			storageImpl, err = storage.NewVariableFragmentedStorage(blockSize)
-			if err != nil {
-				fmt.Printf("Erro: %v\n", err)
-				return
-			}
-		} else {
+		if fragmentedMode == 2 {
+			mode = storage.ModeVariableFragmented
+		} else if fragmentedMode != 1 {
 			fmt.Println("Tipo inválido, usando contíguo por padrão")
-			storageImpl, err = storage.NewVariableStorage(blockSize)
-			if err != nil {
-				fmt.Printf("Erro: %v\n", err)
-				return
-			}
 		}
 	} else {
 		fmt.Println("Modo inválido, usando tamanho variável contíguo por padrão")
-		storageImpl, err = storage.NewVariableStorage(blockSize)
-		if err != nil {
-			fmt.Printf("Erro: %v\n", err)
-			return
-		}
 	}
 
+	inner, err := storage.NewStorageForMode(mode, blockSize)
+	if err != nil {
+		return nil, err
+	}
+	storageImpl := storage.NewIndexedStorage(inner)
+
 	fmt.Println("\nGerando registros de alunos...")
 	generator := domain.NewStudentGenerator()
 	students := generator.Generate(numRecords)
 	fmt.Printf("Gerados %d registros de alunos\n", len(students))
 
-	fmt.Println("\nGravando registros no arquivo alunos.dat...")
+	fmt.Printf("\nGravando registros no arquivo %s...\n", filename)
 	err = storageImpl.WriteStudents(filename, students)
 	if err != nil {
-		fmt.Printf("Erro ao gravar arquivo: %v\n", err)
-		return
+		return nil, fmt.Errorf("erro ao gravar arquivo: %w", err)
 	}
 	fmt.Println("Arquivo gravado com sucesso!")
 
-	stats := storageImpl.GetStats(filename)
-	reporter := infrastructure.NewReporter(stats)
-	reporter.PrintStats()
-	reporter.PrintBlockMap()
-	reporter.PrintBlockVisualization()
-
-	runQueryMode(reader, storageImpl)
+	return storageImpl, nil
 }
 
 func runQueryMode(reader *bufio.Reader, storageImpl storage.Storage) {
@@ -114,7 +139,21 @@ func runQueryMode(reader *bufio.Reader, storageImpl storage.Storage) {
 		fmt.Println("6 - Remover aluno")
 		fmt.Println("7 - Reorganizar arquivo")
 		fmt.Println("8 - Ver relatório de armazenamento")
-		fmt.Println("9 - Sair")
+		fmt.Println("9 - Comparar políticas de alocação")
+		fmt.Println("10 - Alterar política de alocação")
+		fmt.Println("11 - Compactar blocos (incremental)")
+		fmt.Println("12 - Configurar reorganização automática")
+		fmt.Println("13 - Alterar estrutura do índice primário")
+		fmt.Println("14 - Consultar aluno por CPF")
+		fmt.Println("15 - Consultar alunos por curso")
+		fmt.Println("16 - Consultar alunos por ano de ingresso")
+		fmt.Println("17 - Consultar alunos por faixa de CA ou ano de ingresso")
+		fmt.Println("18 - Verificar ou reconstruir índices")
+		fmt.Println("19 - Comparar organizações de arquivo (heap x ordenada)")
+		fmt.Println("20 - Ordenar arquivo por campo (ordenação externa)")
+		fmt.Println("21 - Configurar buffer pool")
+		fmt.Println("22 - Listar matrículas repetidas")
+		fmt.Println("0 - Sair")
 		
 		option := readInt(reader, "Escolha uma opção: ")
 
@@ -138,10 +177,48 @@ func runQueryMode(reader *bufio.Reader, storageImpl storage.Storage) {
 		case 6:
 			removeStudent(reader, storageImpl)
 		case 7:
-			reorganizeFile(storageImpl)
+			reorganizeFile(reader, storageImpl)
 		case 8:
 			showStorageReport(storageImpl)
 		case 9:
+			compareAllocationPolicies(reader, storageImpl)
+		case 10:
+			chooseAllocationPolicy(reader, storageImpl)
+		case 11:
+			compactBlocks(reader, storageImpl)
+		case 12:
+			configureAutoReorganize(reader, storageImpl)
+		case 13:
+			chooseIndexKind(reader, storageImpl)
+		case 14:
+			cpf := readString(reader, "Digite o CPF do aluno (11 dígitos): ")
+			student, err := storageImpl.FindStudentByCPF(filename, cpf)
+			if err != nil {
+				fmt.Printf("Erro: %v\n", err)
+			} else {
+				printStudent(student)
+			}
+		case 15:
+			curso := readString(reader, "Digite o curso: ")
+			students, err := storageImpl.FindStudentsByCurso(filename, curso)
+			printStudentList(fmt.Sprintf("ALUNOS DO CURSO %s", strings.ToUpper(curso)), students, err)
+		case 16:
+			ano := readInt(reader, "Digite o ano de ingresso: ")
+			students, err := storageImpl.FindStudentsByAnoIngresso(filename, ano)
+			printStudentList(fmt.Sprintf("ALUNOS INGRESSANTES EM %d", ano), students, err)
+		case 17:
+			rangeQuery(reader, storageImpl)
+		case 18:
+			maintainIndexes(reader, storageImpl)
+		case 19:
+			compareOrganizations(reader, storageImpl)
+		case 20:
+			externalSort(reader, storageImpl)
+		case 21:
+			configureBufferPool(reader)
+		case 22:
+			listDuplicateMatriculas(storageImpl)
+		case 0:
 			return
 		default:
 			fmt.Println("Opção inválida!")
@@ -169,6 +246,67 @@ func listAllStudents(storageImpl storage.Storage) {
 	}
 }
 
+func printStudentList(title string, students []*entity.Student, err error) {
+	fmt.Printf("\n=== %s ===\n", title)
+	if err != nil {
+		fmt.Printf("Erro na consulta: %v\n", err)
+		return
+	}
+
+	if len(students) == 0 {
+		fmt.Println("Nenhum aluno encontrado.")
+		return
+	}
+
+	fmt.Printf("Total de alunos: %d\n\n", len(students))
+	for i, student := range students {
+		fmt.Printf("%d. Matrícula: %d - %s - Curso: %s - Ingresso: %d - CA: %.2f\n",
+			i+1, student.Matricula, student.Nome, student.Curso, student.AnoIngresso, student.CA)
+	}
+}
+
+func rangeQuery(reader *bufio.Reader, storageImpl storage.Storage) {
+	fmt.Println("\n=== CONSULTA POR FAIXA ===")
+	fmt.Println("1 - CA")
+	fmt.Println("2 - Ano de ingresso")
+	field := readInt(reader, "Escolha o campo (1 ou 2): ")
+
+	count := 0
+	printMatch := func(student *entity.Student) bool {
+		count++
+		fmt.Printf("%d. Matrícula: %d - %s - Curso: %s - Ingresso: %d - CA: %.2f\n",
+			count, student.Matricula, student.Nome, student.Curso, student.AnoIngresso, student.CA)
+		return true
+	}
+
+	var err error
+	switch field {
+	case 1:
+		min := readFloat(reader, "CA mínimo: ")
+		max := readFloat(reader, "CA máximo: ")
+		fmt.Printf("\n=== ALUNOS COM CA ENTRE %.2f E %.2f ===\n", min, max)
+		err = storageImpl.ScanStudentsByCA(filename, min, max, printMatch)
+	case 2:
+		min := readInt(reader, "Ano inicial: ")
+		max := readInt(reader, "Ano final: ")
+		fmt.Printf("\n=== ALUNOS INGRESSANTES ENTRE %d E %d ===\n", min, max)
+		err = storageImpl.ScanStudentsByAnoIngresso(filename, min, max, printMatch)
+	default:
+		fmt.Println("Campo inválido!")
+		return
+	}
+
+	if err != nil {
+		fmt.Printf("Erro na consulta: %v\n", err)
+		return
+	}
+	if count == 0 {
+		fmt.Println("Nenhum aluno encontrado.")
+		return
+	}
+	fmt.Printf("\nTotal de alunos: %d\n", count)
+}
+
 func registerManualStudent(reader *bufio.Reader, storageImpl storage.Storage) {
 	fmt.Println("\n=== REGISTRAR ALUNO MANUALMENTE ===")
 	
@@ -277,8 +415,12 @@ func removeStudent(reader *bufio.Reader, storageImpl storage.Storage) {
 	}
 }
 
-func reorganizeFile(storageImpl storage.Storage) {
+func reorganizeFile(reader *bufio.Reader, storageImpl storage.Storage) {
 	fmt.Println("\n=== REORGANIZAR ARQUIVO ===")
+	fmt.Print("Manter cópia de segurança do arquivo original? (s/n): ")
+	answer, _ := reader.ReadString('\n')
+	storageImpl.SetReorganizeBackup(strings.EqualFold(strings.TrimSpace(answer), "s"))
+
 	fmt.Println("Iniciando compactação...")
 	
 	report, err := storageImpl.Reorganize(filename)
@@ -287,6 +429,10 @@ func reorganizeFile(storageImpl storage.Storage) {
 		return
 	}
 	
+	printReorganizationReport(report)
+}
+
+func printReorganizationReport(report *storage.ReorganizationReport) {
 	fmt.Println("\n===== RELATÓRIO DE REORGANIZAÇÃO =====")
 	fmt.Println("Antes:")
 	fmt.Printf("Blocos: %d\n", report.BlocksBefore)
@@ -302,20 +448,32 @@ func reorganizeFile(storageImpl storage.Storage) {
 	fmt.Printf("Blocos liberados: %d\n", report.FreedBlocks)
 	fmt.Println("======================================")
 	
-	fmt.Printf("\nArquivo reorganizado salvo como: %s_reorg.dat\n", strings.TrimSuffix(filename, ".dat"))
+	fmt.Printf("\nArquivo %s substituído pela versão reorganizada\n", filename)
+	if report.BackupFilename != "" {
+		fmt.Printf("Cópia de segurança do original: %s\n", report.BackupFilename)
+	}
 }
 
 func registerNewStudents(reader *bufio.Reader, storageImpl storage.Storage) {
 	fmt.Println("\n=== REGISTRAR LOTE DE ALUNOS ===")
 	numRecords := readInt(reader, "Digite o número de alunos a serem gerados: ")
 	
-	fmt.Println("\nGerando novos alunos...")
+	first, err := storage.NextMatricula(storageImpl, filename)
+	if err != nil {
+		fmt.Printf("Erro ao ler matrículas do arquivo: %v\n", err)
+		return
+	}
+
+	fmt.Printf("\nGerando novos alunos a partir da matrícula %d...\n", first)
 	generator := domain.NewStudentGenerator()
-	students := generator.Generate(numRecords)
+	students, err := generator.GenerateFrom(first, numRecords)
+	if err != nil {
+		fmt.Printf("Aviso: %v\n", err)
+	}
 	fmt.Printf("Gerados %d novos alunos\n", len(students))
 
 	fmt.Println("\nAdicionando alunos ao arquivo...")
-	err := storageImpl.AddStudents(filename, students)
+	err = storageImpl.AddStudents(filename, students)
 	if err != nil {
 		fmt.Printf("Erro ao adicionar alunos: %v\n", err)
 		return
@@ -329,9 +487,377 @@ func showStorageReport(storageImpl storage.Storage) {
 	reporter.PrintStats()
 	reporter.PrintBlockMap()
 	reporter.PrintBlockVisualization()
+
+	if ss, ok := sortedStorage(storageImpl); ok {
+		areaStats, err := ss.AreaStats(filename)
+		if err != nil {
+			fmt.Printf("Erro ao ler as áreas do arquivo: %v\n", err)
+		} else {
+			infrastructure.PrintSortedAreaStats(areaStats)
+		}
+	}
+
+	if vs, ok := variableStorage(storageImpl); ok {
+		bloomStats, err := vs.BloomStats(filename)
+		if err != nil {
+			fmt.Printf("Erro ao ler os filtros de Bloom: %v\n", err)
+		} else {
+			infrastructure.PrintBloomFilterStats(bloomStats)
+		}
+	}
+
+	infrastructure.PrintBufferPoolStats(storage.GetBufferPoolStats())
+
+	if indexed, ok := storageImpl.(*storage.IndexedStorage); ok {
+		indexStats, err := indexed.IndexStats(filename)
+		if err != nil {
+			fmt.Printf("Erro ao ler o índice: %v\n", err)
+			return
+		}
+		infrastructure.PrintIndexStats(indexStats)
+	}
 }
 
 
+// compareAllocationPolicies aplica a mesma carga sintética (gravação, remoções,
+// atualizações e inserções) com cada política e compara o resultado
+func compareAllocationPolicies(reader *bufio.Reader, storageImpl storage.Storage) {
+	fmt.Println("\n=== COMPARAR POLÍTICAS DE ALOCAÇÃO ===")
+	numRecords := readInt(reader, "Digite o número de alunos da carga de teste: ")
+	if numRecords <= 0 {
+		fmt.Println("Número de alunos inválido!")
+		return
+	}
+
+	workload := buildAllocationWorkload(numRecords)
+	fmt.Printf("Carga: %d gravados, %d removidos, %d atualizados, %d inseridos\n",
+		len(workload.Initial), len(workload.Deletes), len(workload.Updates), len(workload.Inserts))
+
+	results, err := storage.CompareAllocationPolicies(storageImpl.GetBlockSize(), workload)
+	if err != nil {
+		fmt.Printf("Erro na comparação: %v\n", err)
+		return
+	}
+	infrastructure.PrintAllocationComparison(results)
+}
+
+// compareOrganizations aplica a carga da comparação de políticas a cada organização de
+// arquivo e compara os blocos lidos pelas consultas por matrícula
+func compareOrganizations(reader *bufio.Reader, storageImpl storage.Storage) {
+	fmt.Println("\n=== COMPARAR ORGANIZAÇÕES (HEAP X ORDENADA) ===")
+	numRecords := readInt(reader, "Digite o número de alunos da carga de teste: ")
+	if numRecords <= 0 {
+		fmt.Println("Número de alunos inválido!")
+		return
+	}
+
+	workload := buildAllocationWorkload(numRecords)
+	var lookups []int
+	for i := 0; i < len(workload.Initial); i += 4 {
+		lookups = append(lookups, workload.Initial[i].Matricula)
+	}
+	for i := 0; i < len(workload.Inserts); i += 4 {
+		lookups = append(lookups, workload.Inserts[i].Matricula)
+	}
+	fmt.Printf("Carga: %d gravados, %d removidos, %d atualizados, %d inseridos; %d consultas por matrícula\n",
+		len(workload.Initial), len(workload.Deletes), len(workload.Updates), len(workload.Inserts), len(lookups))
+
+	results, err := storage.CompareOrganizations(storageImpl.GetBlockSize(), workload, lookups)
+	if err != nil {
+		fmt.Printf("Erro na comparação: %v\n", err)
+		return
+	}
+	infrastructure.PrintOrganizationComparison(results)
+}
+
+// externalSort grava uma cópia do arquivo ordenada pelo campo escolhido, com memória
+// limitada a alguns blocos, e mostra os primeiros alunos do resultado
+func externalSort(reader *bufio.Reader, storageImpl storage.Storage) {
+	fmt.Println("\n=== ORDENAÇÃO EXTERNA ===")
+	for i, field := range storage.SortFields {
+		fmt.Printf("%d - %s\n", i+1, field)
+	}
+	choice := readInt(reader, fmt.Sprintf("Escolha o campo (1 a %d): ", len(storage.SortFields)))
+	if choice < 1 || choice > len(storage.SortFields) {
+		fmt.Println("Campo inválido!")
+		return
+	}
+	field := storage.SortFields[choice-1]
+
+	memoryBlocks := readInt(reader, fmt.Sprintf("Memória disponível em blocos (mínimo %d): ", storage.MinSortMemoryBlocks))
+	output := storage.SortOutputFilename(filename, field)
+	report, err := storage.ExternalSort(storageImpl, filename, output, field, memoryBlocks)
+	if err != nil {
+		fmt.Printf("Erro na ordenação: %v\n", err)
+		return
+	}
+	infrastructure.PrintExternalSortReport(report)
+
+	sorted, err := storage.NewFixedStorage(storageImpl.GetBlockSize())
+	if err != nil {
+		fmt.Printf("Erro ao abrir arquivo ordenado: %v\n", err)
+		return
+	}
+	fmt.Println("\nPrimeiros alunos:")
+	count := 0
+	err = sorted.ScanStudents(output, func(_ storage.RecordID, student *entity.Student) bool {
+		count++
+		fmt.Printf("%d. Matrícula: %d - %s - Curso: %s - Ingresso: %d - CA: %.2f\n",
+			count, student.Matricula, student.Nome, student.Curso, student.AnoIngresso, student.CA)
+		return count < 10
+	})
+	if err != nil {
+		fmt.Printf("Erro ao ler arquivo ordenado: %v\n", err)
+	}
+}
+
+func buildAllocationWorkload(numRecords int) storage.AllocationWorkload {
+	generator := domain.NewStudentGenerator()
+	initial := generator.Generate(numRecords)
+
+	workload := storage.AllocationWorkload{Initial: initial}
+	for i := 0; i < len(initial); i += 3 {
+		workload.Deletes = append(workload.Deletes, initial[i].Matricula)
+	}
+
+	replacements := generator.Generate(numRecords)
+	for i := 1; i < len(initial); i += 2 {
+		if i%3 == 0 {
+			continue
+		}
+		updated := replacements[i]
+		updated.Matricula = initial[i].Matricula
+		workload.Updates = append(workload.Updates, updated)
+	}
+
+	workload.Inserts = generator.Generate(numRecords / 2)
+	for i := range workload.Inserts {
+		workload.Inserts[i].Matricula += numRecords
+	}
+	return workload
+}
+
+func chooseIndexKind(reader *bufio.Reader, storageImpl storage.Storage) {
+	indexed, ok := storageImpl.(*storage.IndexedStorage)
+	if !ok {
+		fmt.Println("O armazenamento atual não usa índice primário.")
+		return
+	}
+
+	fmt.Printf("\nEstrutura atual: %s\n", indexed.GetIndexKind())
+	for i, kind := range storage.IndexKinds {
+		fmt.Printf("%d - %s\n", i+1, kind)
+	}
+
+	option := readInt(reader, "Escolha a estrutura: ")
+	if option < 1 || option > len(storage.IndexKinds) {
+		fmt.Println("Opção inválida!")
+		return
+	}
+	indexed.SetIndexKind(storage.IndexKinds[option-1])
+
+	indexStats, err := indexed.IndexStats(filename)
+	if err != nil {
+		fmt.Printf("Erro ao montar o índice: %v\n", err)
+		return
+	}
+	infrastructure.PrintIndexStats(indexStats)
+}
+
+// listDuplicateMatriculas mostra as matrículas com mais de um registro, que só existem em
+// arquivos gravados antes de a matrícula ser verificada
+func listDuplicateMatriculas(storageImpl storage.Storage) {
+	duplicates, err := storage.FindDuplicateMatriculas(storageImpl, filename)
+	if err != nil {
+		fmt.Printf("Erro ao ler arquivo: %v\n", err)
+		return
+	}
+	infrastructure.PrintDuplicateMatriculas(duplicates)
+}
+
+// configureBufferPool troca a quantidade de quadros e a política de substituição do
+// buffer pool, zerando os contadores de acertos e faltas
+func configureBufferPool(reader *bufio.Reader) {
+	current := storage.GetBufferPoolStats()
+	fmt.Printf("\nBuffer pool atual: %d quadros, substituição %s\n", current.Frames, current.Policy)
+
+	frames := readInt(reader, "Quantidade de quadros: ")
+	for i, policy := range storage.ReplacementPolicies {
+		fmt.Printf("%d - %s\n", i+1, policy)
+	}
+	option := readInt(reader, "Escolha a política de substituição: ")
+	if option < 1 || option > len(storage.ReplacementPolicies) {
+		fmt.Println("Opção inválida!")
+		return
+	}
+
+	if err := storage.ConfigureBufferPool(frames, storage.ReplacementPolicies[option-1]); err != nil {
+		fmt.Printf("Erro: %v\n", err)
+		return
+	}
+	fmt.Printf("Buffer pool configurado: %d quadros, substituição %s\n", frames, storage.ReplacementPolicies[option-1])
+}
+
+func maintainIndexes(reader *bufio.Reader, storageImpl storage.Storage) {
+	indexed, ok := storageImpl.(*storage.IndexedStorage)
+	if !ok {
+		fmt.Println("O armazenamento atual não usa índices.")
+		return
+	}
+
+	fmt.Println("\n=== ÍNDICES ===")
+	fmt.Println("1 - Verificar consistência dos índices")
+	fmt.Println("2 - Reconstruir todos os índices")
+	option := readInt(reader, "Escolha uma opção: ")
+
+	switch option {
+	case 1:
+		verification, err := indexed.VerifyIndexes(filename)
+		if err != nil {
+			fmt.Printf("Erro na verificação: %v\n", err)
+			return
+		}
+		infrastructure.PrintIndexVerification(verification, 10)
+		if verification.Consistent() {
+			return
+		}
+
+		fmt.Print("Reconstruir os índices agora? (s/n): ")
+		answer, _ := reader.ReadString('\n')
+		if !strings.EqualFold(strings.TrimSpace(answer), "s") {
+			return
+		}
+	case 2:
+	default:
+		fmt.Println("Opção inválida!")
+		return
+	}
+
+	if err := indexed.RebuildIndex(filename); err != nil {
+		fmt.Printf("Erro ao reconstruir os índices: %v\n", err)
+		return
+	}
+	fmt.Println("Índices reconstruídos a partir do arquivo de dados.")
+}
+
+// variableStorage devolve o armazenamento variável contíguo por trás do índice, se for o caso
+func variableStorage(storageImpl storage.Storage) (*storage.VariableStorage, bool) {
+	if indexed, ok := storageImpl.(*storage.IndexedStorage); ok {
+		storageImpl = indexed.Unwrap()
+	}
+	vs, ok := storageImpl.(*storage.VariableStorage)
+	return vs, ok
+}
+
+// sortedStorage devolve o arquivo sequencial ordenado por trás do índice, se for o caso
+func sortedStorage(storageImpl storage.Storage) (*storage.SortedStorage, bool) {
+	if indexed, ok := storageImpl.(*storage.IndexedStorage); ok {
+		storageImpl = indexed.Unwrap()
+	}
+	ss, ok := storageImpl.(*storage.SortedStorage)
+	return ss, ok
+}
+
+func chooseAllocationPolicy(reader *bufio.Reader, storageImpl storage.Storage) {
+	vs, ok := variableStorage(storageImpl)
+	if !ok {
+		fmt.Println("Políticas de alocação só se aplicam ao armazenamento variável contíguo.")
+		return
+	}
+
+	fmt.Printf("\nPolítica atual: %s\n", vs.GetAllocationPolicy())
+	for i, policy := range storage.AllocationPolicies {
+		fmt.Printf("%d - %s\n", i+1, policy)
+	}
+
+	option := readInt(reader, "Escolha a política: ")
+	if option < 1 || option > len(storage.AllocationPolicies) {
+		fmt.Println("Opção inválida!")
+		return
+	}
+	vs.SetAllocationPolicy(storage.AllocationPolicies[option-1])
+	fmt.Printf("Política alterada para %s\n", vs.GetAllocationPolicy())
+}
+
+func compactBlocks(reader *bufio.Reader, storageImpl storage.Storage) {
+	vs, ok := variableStorage(storageImpl)
+	if !ok {
+		fmt.Println("A compactação incremental só se aplica ao armazenamento variável contíguo.")
+		return
+	}
+
+	fmt.Println("\n=== COMPACTAR BLOCOS ===")
+	options := storage.CompactionOptions{
+		StartBlock: readInt(reader, "Bloco inicial (0 para o início): "),
+		MaxBlocks:  readInt(reader, "Quantidade de blocos (0 para todos): "),
+	}
+	fmt.Print("Fundir blocos vizinhos pouco ocupados? (s/n): ")
+	answer, _ := reader.ReadString('\n')
+	options.MergeBlocks = strings.EqualFold(strings.TrimSpace(answer), "s")
+
+	// Pelo IndexedStorage, os índices acompanham os registros movidos entre blocos
+	compact := vs.CompactBlocks
+	if indexed, ok := storageImpl.(*storage.IndexedStorage); ok {
+		compact = indexed.CompactBlocks
+	}
+	report, err := compact(filename, options)
+	if err != nil {
+		fmt.Printf("Erro na compactação: %v\n", err)
+		return
+	}
+
+	fmt.Println("\n===== RELATÓRIO DE COMPACTAÇÃO =====")
+	fmt.Printf("Blocos visitados: %d\n", report.BlocksVisited)
+	fmt.Printf("Blocos compactados: %d\n", report.BlocksCompacted)
+	fmt.Printf("Bytes de registros removidos recuperados: %d\n", report.DeadBytesReclaimed)
+	if options.MergeBlocks {
+		fmt.Printf("Blocos fundidos: %d (%d registros movidos)\n", report.BlocksMerged, report.RecordsMoved)
+	}
+	fmt.Printf("Blocos vazios descartados do fim do arquivo: %d\n", report.BlocksTruncated)
+	if !report.Done {
+		fmt.Printf("Para continuar, execute novamente a partir do bloco %d\n", report.NextBlock)
+	}
+	fmt.Println("====================================")
+}
+
+func configureAutoReorganize(reader *bufio.Reader, storageImpl storage.Storage) {
+	vs, ok := variableStorage(storageImpl)
+	if !ok {
+		fmt.Println("A reorganização automática só se aplica ao armazenamento variável contíguo.")
+		return
+	}
+
+	fmt.Println("\n=== REORGANIZAÇÃO AUTOMÁTICA ===")
+	current := vs.GetAutoReorganize()
+	fmt.Printf("Configuração atual: %s\n", current.Mode)
+	fmt.Printf("Fragmentação atual: %.1f%%\n", storage.FragmentationRatio(vs.GetStats(filename)))
+
+	fmt.Println("\n1 - Desligada")
+	fmt.Println("2 - Quando a fragmentação ultrapassar um limite")
+	fmt.Println("3 - A cada N remoções/atualizações")
+
+	policy := storage.AutoReorganizePolicy{}
+	switch readInt(reader, "Escolha a opção: ") {
+	case 1:
+		policy.Mode = storage.AutoReorganizeOff
+	case 2:
+		policy.Mode = storage.AutoReorganizeThreshold
+		policy.FragmentationLimit = readFloat(reader, "Limite de fragmentação (% de bytes removidos): ")
+	case 3:
+		policy.Mode = storage.AutoReorganizeEveryN
+		policy.EveryN = readInt(reader, "Número de operações: ")
+	default:
+		fmt.Println("Opção inválida!")
+		return
+	}
+
+	vs.SetAutoReorganize(policy, func(report *storage.ReorganizationReport) {
+		fmt.Println("\nReorganização automática executada.")
+		printReorganizationReport(report)
+	})
+	fmt.Printf("Reorganização automática: %s\n", vs.GetAutoReorganize().Mode)
+}
+
 func printStudent(student *entity.Student) {
 	fmt.Println("\n=== DADOS DO ALUNO ===")
 	fmt.Printf("Matrícula:     %d\n", student.Matricula)
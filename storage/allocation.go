@@ -0,0 +1,114 @@
+package storage
+
+import (
+	"aeds2-tp1/entity"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+type AllocationPolicy int
+
+const (
+	FirstFit AllocationPolicy = iota
+	BestFit
+	WorstFit
+	NextFit
+)
+
+var AllocationPolicies = []AllocationPolicy{FirstFit, BestFit, WorstFit, NextFit}
+
+func (p AllocationPolicy) String() string {
+	switch p {
+	case FirstFit:
+		return "First Fit"
+	case BestFit:
+		return "Best Fit"
+	case WorstFit:
+		return "Worst Fit"
+	case NextFit:
+		return "Next Fit"
+	}
+	return fmt.Sprintf("política desconhecida (%d)", int(p))
+}
+
+// findBlock escolhe, segundo a política, o bloco que receberá need bytes; -1 indica
+// que um bloco novo deve ser alocado. cursor é a posição corrente do Next Fit
+func (m *freeSpaceMap) findBlock(policy AllocationPolicy, need int, cursor int) int {
+	switch policy {
+	case BestFit:
+		return m.bestFit(need)
+	case WorstFit:
+		return m.worstFit(need)
+	case NextFit:
+		if cursor >= len(m.free) {
+			cursor = 0
+		}
+		if found := m.firstFitFrom(need, cursor); found >= 0 {
+			return found
+		}
+		return m.firstFitFrom(need, 0)
+	}
+	return m.firstFit(need)
+}
+
+// AllocationWorkload descreve a sequência de operações aplicada igualmente a cada política
+type AllocationWorkload struct {
+	Initial []entity.Student
+	Deletes []int
+	Updates []entity.Student
+	Inserts []entity.Student
+}
+
+type AllocationPolicyResult struct {
+	Policy         AllocationPolicy
+	Blocks         int
+	PartialBlocks  int
+	EfficiencyRate float64
+}
+
+// CompareAllocationPolicies executa a mesma carga com cada política em arquivos temporários
+func CompareAllocationPolicies(blockSize int, workload AllocationWorkload) ([]AllocationPolicyResult, error) {
+	dir, err := os.MkdirTemp("", "alocacao")
+	if err != nil {
+		return nil, fmt.Errorf("erro ao criar diretório temporário: %w", err)
+	}
+	defer os.RemoveAll(dir)
+
+	results := make([]AllocationPolicyResult, 0, len(AllocationPolicies))
+	for _, policy := range AllocationPolicies {
+		vs, err := NewVariableStorage(blockSize)
+		if err != nil {
+			return nil, err
+		}
+		vs.SetAllocationPolicy(policy)
+
+		filename := filepath.Join(dir, fmt.Sprintf("politica_%d.dat", int(policy)))
+		if err := vs.WriteStudents(filename, workload.Initial); err != nil {
+			return nil, err
+		}
+		for _, matricula := range workload.Deletes {
+			if err := vs.DeleteStudent(filename, matricula); err != nil {
+				return nil, fmt.Errorf("%s: %w", policy, err)
+			}
+		}
+		for _, student := range workload.Updates {
+			if err := vs.UpdateStudent(filename, student); err != nil {
+				return nil, fmt.Errorf("%s: %w", policy, err)
+			}
+		}
+		if err := vs.AddStudents(filename, workload.Inserts); err != nil {
+			return nil, fmt.Errorf("%s: %w", policy, err)
+		}
+
+		stats := vs.GetStats(filename)
+		results = append(results, AllocationPolicyResult{
+			Policy:         policy,
+			Blocks:         stats.TotalBlocks,
+			PartialBlocks:  stats.PartialBlocks,
+			EfficiencyRate: stats.EfficiencyRate,
+		})
+	}
+
+	return results, nil
+}
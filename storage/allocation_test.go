@@ -0,0 +1,140 @@
+package storage
+
+import (
+	"aeds2-tp1/domain"
+	"aeds2-tp1/entity"
+	"math/rand"
+	"path/filepath"
+	"testing"
+)
+
+// expectedBlock repete, varrendo a lista, a escolha de cada política
+func expectedBlock(policy AllocationPolicy, free []int, need int, cursor int) int {
+	firstFrom := func(start int) int {
+		for i := start; i < len(free); i++ {
+			if free[i] >= need {
+				return i
+			}
+		}
+		return -1
+	}
+
+	best := -1
+	for i, f := range free {
+		if f < need {
+			continue
+		}
+		switch {
+		case best < 0:
+			best = i
+		case policy == BestFit && f < free[best]:
+			best = i
+		case policy == WorstFit && f > free[best]:
+			best = i
+		}
+	}
+
+	switch policy {
+	case BestFit, WorstFit:
+		return best
+	case NextFit:
+		if cursor >= len(free) {
+			cursor = 0
+		}
+		if found := firstFrom(cursor); found >= 0 {
+			return found
+		}
+		return firstFrom(0)
+	}
+	return firstFrom(0)
+}
+
+func TestFreeSpaceMapFindBlockByPolicy(t *testing.T) {
+	m := newFreeSpaceMap([]int{10, 50, 30, 80, 30})
+	want := map[AllocationPolicy]int{FirstFit: 1, BestFit: 2, WorstFit: 3, NextFit: 4}
+	for policy, block := range want {
+		if got := m.findBlock(policy, 25, 4); got != block {
+			t.Fatalf("%s escolheu o bloco %d, esperado %d", policy, got, block)
+		}
+		if got := m.findBlock(policy, 81, 4); got != -1 {
+			t.Fatalf("%s escolheu o bloco %d sem espaço suficiente", policy, got)
+		}
+	}
+
+	random := rand.New(rand.NewSource(7))
+	for n := 1; n < 70; n++ {
+		free := make([]int, n)
+		for i := range free {
+			free[i] = random.Intn(60)
+		}
+		m := newFreeSpaceMap(append([]int(nil), free...))
+		for need := 1; need <= 60; need += 3 {
+			cursor := random.Intn(n + 2)
+			for _, policy := range AllocationPolicies {
+				if got, want := m.findBlock(policy, need, cursor), expectedBlock(policy, free, need, cursor); got != want {
+					t.Fatalf("%s em %v (need %d, cursor %d): bloco %d, esperado %d", policy, free, need, cursor, got, want)
+				}
+			}
+		}
+	}
+}
+
+func TestVariableStorageInsertFollowsAllocationPolicy(t *testing.T) {
+	const blockSize = 512
+	generator := domain.NewStudentGenerator()
+	students := generator.Generate(60)
+	extra := generator.Generate(61)[60]
+
+	for _, policy := range AllocationPolicies {
+		vs, err := NewVariableStorage(blockSize)
+		if err != nil {
+			t.Fatal(err)
+		}
+		vs.SetAllocationPolicy(policy)
+		filename := filepath.Join(t.TempDir(), "alunos.dat")
+		if err := vs.WriteStudents(filename, students); err != nil {
+			t.Fatal(err)
+		}
+
+		// Remoções em blocos diferentes deixam espaços livres de tamanhos distintos
+		removed := map[int]int{2: 2, 5: 3, 8: 1}
+		err = vs.ScanStudents(filename, func(rid RecordID, student *entity.Student) bool {
+			if removed[rid.Block] > 0 {
+				removed[rid.Block]--
+				if err := vs.DeleteByRID(filename, rid); err != nil {
+					t.Fatal(err)
+				}
+			}
+			return true
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		bf, err := openBlockFile(filename, ModeVariable, blockSize, false, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		free := make([]int, bf.totalBlocks())
+		for blockNum := range free {
+			block, err := bf.readBlock(blockNum)
+			if err != nil {
+				t.Fatal(err)
+			}
+			free[blockNum] = loadSlottedPage(block).freeSpace()
+		}
+		bf.Close()
+
+		want := expectedBlock(policy, free, len(vs.serializeStudent(extra)), vs.nextFitCursor)
+		if want < 0 {
+			want = len(free)
+		}
+		rid, err := vs.InsertStudent(filename, extra)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if rid.Block != want {
+			t.Fatalf("%s gravou no bloco %d, esperado %d (espaço livre %v)", policy, rid.Block, want, free)
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package storage
+
+import "fmt"
+
+type AutoReorganizeMode int
+
+const (
+	AutoReorganizeOff AutoReorganizeMode = iota
+	AutoReorganizeThreshold
+	AutoReorganizeEveryN
+)
+
+func (m AutoReorganizeMode) String() string {
+	switch m {
+	case AutoReorganizeOff:
+		return "desligada"
+	case AutoReorganizeThreshold:
+		return "por limite de fragmentação"
+	case AutoReorganizeEveryN:
+		return "a cada N operações"
+	}
+	return fmt.Sprintf("modo desconhecido (%d)", int(m))
+}
+
+// AutoReorganizePolicy decide quando DeleteStudent e UpdateStudent disparam Reorganize:
+// no modo por limite, quando FragmentationRatio ultrapassa FragmentationLimit (%);
+// no modo a cada N, após EveryN remoções/atualizações desde a última reorganização
+type AutoReorganizePolicy struct {
+	Mode               AutoReorganizeMode
+	FragmentationLimit float64
+	EveryN             int
+}
+
+// DefaultFragmentationLimit é o percentual de bytes removidos usado quando o limite não é informado
+const DefaultFragmentationLimit = 30.0
+
+// FragmentationRatio é o percentual dos bytes de registros ocupados por registros removidos
+func FragmentationRatio(stats StorageStats) float64 {
+	total := stats.TotalLiveBytes + stats.TotalDeadBytes
+	if total == 0 {
+		return 0
+	}
+	return float64(stats.TotalDeadBytes) / float64(total) * 100
+}
+
+// SetAutoReorganize configura a reorganização automática; onReorganize (opcional)
+// recebe o relatório de cada reorganização disparada
+func (vs *VariableStorage) SetAutoReorganize(policy AutoReorganizePolicy, onReorganize func(report *ReorganizationReport)) {
+	if policy.Mode == AutoReorganizeThreshold && policy.FragmentationLimit <= 0 {
+		policy.FragmentationLimit = DefaultFragmentationLimit
+	}
+	if policy.Mode == AutoReorganizeEveryN && policy.EveryN <= 0 {
+		policy.EveryN = 1
+	}
+	vs.autoReorganize = policy
+	vs.onAutoReorganize = onReorganize
+	vs.opsSinceReorg = 0
+}
+
+func (vs *VariableStorage) GetAutoReorganize() AutoReorganizePolicy {
+	return vs.autoReorganize
+}
+
+// checkAutoReorganize é chamado após cada remoção ou atualização bem-sucedida. As operações
+// não mantêm as estatísticas; só o modo por limite as recalcula a partir do arquivo
+func (vs *VariableStorage) checkAutoReorganize(filename string) error {
+	vs.opsSinceReorg++
+
+	trigger := false
+	switch vs.autoReorganize.Mode {
+	case AutoReorganizeThreshold:
+		stats := vs.GetStats(filename)
+		trigger = stats.TotalTombstones > 0 && FragmentationRatio(stats) >= vs.autoReorganize.FragmentationLimit
+	case AutoReorganizeEveryN:
+		trigger = vs.opsSinceReorg >= vs.autoReorganize.EveryN
+	}
+	if !trigger {
+		return nil
+	}
+
+	report, err := vs.Reorganize(filename)
+	if err != nil {
+		return fmt.Errorf("operação concluída, mas a reorganização automática falhou: %w", err)
+	}
+	vs.opsSinceReorg = 0
+
+	if vs.onAutoReorganize != nil {
+		vs.onAutoReorganize(report)
+	}
+	return nil
+}
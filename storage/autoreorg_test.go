@@ -0,0 +1,169 @@
+package storage
+
+import (
+	"aeds2-tp1/domain"
+	"aeds2-tp1/entity"
+	"path/filepath"
+	"testing"
+)
+
+func newAutoReorganizeTestFile(t *testing.T, count int) (*VariableStorage, string, []entity.Student) {
+	t.Helper()
+	vs, err := NewVariableStorage(512)
+	if err != nil {
+		t.Fatal(err)
+	}
+	filename := filepath.Join(t.TempDir(), "alunos.dat")
+	students := domain.NewStudentGenerator().Generate(count)
+	if err := vs.WriteStudents(filename, students); err != nil {
+		t.Fatal(err)
+	}
+	return vs, filename, students
+}
+
+func TestSetAutoReorganizeDefaults(t *testing.T) {
+	vs, err := NewVariableStorage(512)
+	if err != nil {
+		t.Fatal(err)
+	}
+	vs.SetAutoReorganize(AutoReorganizePolicy{Mode: AutoReorganizeThreshold}, nil)
+	if got := vs.GetAutoReorganize().FragmentationLimit; got != DefaultFragmentationLimit {
+		t.Fatalf("limite padrão %.1f, esperado %.1f", got, DefaultFragmentationLimit)
+	}
+	vs.SetAutoReorganize(AutoReorganizePolicy{Mode: AutoReorganizeEveryN, EveryN: -2}, nil)
+	if got := vs.GetAutoReorganize().EveryN; got != 1 {
+		t.Fatalf("N padrão %d, esperado 1", got)
+	}
+}
+
+func TestAutoReorganizeEveryN(t *testing.T) {
+	vs, filename, students := newAutoReorganizeTestFile(t, 60)
+	triggered := 0
+	vs.SetAutoReorganize(AutoReorganizePolicy{Mode: AutoReorganizeEveryN, EveryN: 3}, func(report *ReorganizationReport) {
+		triggered++
+	})
+
+	want := make(map[int]entity.Student)
+	for _, student := range students {
+		want[student.Matricula] = student
+	}
+
+	// Remoções e atualizações contam igualmente para o N
+	for i := 0; i < 9; i++ {
+		student := students[i*5]
+		if i%3 == 1 {
+			student.Nome = "Nome Atualizado"
+			if err := vs.UpdateStudent(filename, student); err != nil {
+				t.Fatal(err)
+			}
+			want[student.Matricula] = student
+		} else {
+			if err := vs.DeleteStudent(filename, student.Matricula); err != nil {
+				t.Fatal(err)
+			}
+			delete(want, student.Matricula)
+		}
+		if triggered != (i+1)/3 {
+			t.Fatalf("%d reorganizações após %d operações com N = 3", triggered, i+1)
+		}
+	}
+	if stats := vs.GetStats(filename); stats.TotalTombstones != 0 {
+		t.Fatalf("%d registros removidos após a reorganização", stats.TotalTombstones)
+	}
+	checkVariableContents(t, vs, filename, want)
+
+	// Uma operação que falha não conta
+	if err := vs.DeleteStudent(filename, students[0].Matricula); err == nil {
+		t.Fatal("remoção de matrícula inexistente aceita")
+	}
+	for _, i := range []int{1, 2} {
+		if err := vs.DeleteStudent(filename, students[i].Matricula); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if triggered != 3 {
+		t.Fatalf("%d reorganizações após falha e duas remoções, esperadas 3", triggered)
+	}
+}
+
+func TestAutoReorganizeThreshold(t *testing.T) {
+	const limit = 20.0
+	vs, filename, students := newAutoReorganizeTestFile(t, 80)
+	var reports []*ReorganizationReport
+	vs.SetAutoReorganize(AutoReorganizePolicy{Mode: AutoReorganizeThreshold, FragmentationLimit: limit}, func(report *ReorganizationReport) {
+		reports = append(reports, report)
+	})
+
+	for i, student := range students[:40] {
+		before := len(reports)
+		if err := vs.DeleteStudent(filename, student.Matricula); err != nil {
+			t.Fatal(err)
+		}
+
+		// Sem disparo a fragmentação fica abaixo do limite; com disparo, zera
+		ratio := FragmentationRatio(vs.GetStats(filename))
+		if len(reports) == before && ratio >= limit {
+			t.Fatalf("fragmentação de %.1f%% sem reorganização após %d remoções", ratio, i+1)
+		}
+		if len(reports) > before && ratio != 0 {
+			t.Fatalf("fragmentação de %.1f%% logo após a reorganização", ratio)
+		}
+	}
+	if len(reports) == 0 {
+		t.Fatal("metade dos registros removida sem reorganização")
+	}
+	if reports[0].BlocksAfter > reports[0].BlocksBefore {
+		t.Fatalf("reorganização passou de %d para %d blocos", reports[0].BlocksBefore, reports[0].BlocksAfter)
+	}
+}
+
+func TestAutoReorganizeOff(t *testing.T) {
+	vs, filename, students := newAutoReorganizeTestFile(t, 40)
+	triggered := 0
+	vs.SetAutoReorganize(AutoReorganizePolicy{Mode: AutoReorganizeOff}, func(report *ReorganizationReport) {
+		triggered++
+	})
+	for _, student := range students[:30] {
+		if err := vs.DeleteStudent(filename, student.Matricula); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if triggered != 0 {
+		t.Fatalf("%d reorganizações com o modo desligado", triggered)
+	}
+	if stats := vs.GetStats(filename); stats.TotalTombstones != 30 {
+		t.Fatalf("%d registros removidos mantidos, esperados 30", stats.TotalTombstones)
+	}
+}
+
+func TestIndexedAutoReorganizeKeepsIndexesValid(t *testing.T) {
+	vs, filename, students := newAutoReorganizeTestFile(t, 100)
+	s := NewIndexedStorage(vs)
+	if err := s.WriteStudents(filename, students); err != nil {
+		t.Fatal(err)
+	}
+	checkIndexesConsistent(t, s, filename, len(students))
+
+	triggered := 0
+	vs.SetAutoReorganize(AutoReorganizePolicy{Mode: AutoReorganizeEveryN, EveryN: 4}, func(report *ReorganizationReport) {
+		triggered++
+	})
+	for _, student := range students[:10] {
+		if err := s.DeleteStudent(filename, student.Matricula); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if triggered != 2 {
+		t.Fatalf("%d reorganizações após 10 remoções indexadas com N = 4", triggered)
+	}
+
+	// A reorganização troca os RecordIDs; a próxima consulta refaz os índices
+	for _, student := range students[10:] {
+		got, err := s.FindStudentByCPF(filename, student.CPF)
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkSameStudent(t, got, student)
+	}
+	checkIndexesConsistent(t, s, filename, len(students)-10)
+}
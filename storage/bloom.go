@@ -0,0 +1,193 @@
+package storage
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"math/bits"
+	"os"
+)
+
+// Arquivo .blm: magic (4) + geração do .dat (8) + quantidade de blocos (4) + bytes por
+// filtro (4) + um filtro de Bloom por bloco com as matrículas dos registros da página
+const (
+	bloomExtension  = ".blm"
+	bloomMagic      = "BLM1"
+	bloomHeaderSize = 20
+	bloomHashes     = 6
+)
+
+// bloomFilterBytes reserva um bit para cada 4 bytes do bloco (mínimo de 8 bytes): com
+// registros a partir de 60 bytes, são pelo menos 15 bits por matrícula
+func bloomFilterBytes(blockSize int) int {
+	return max(8, blockSize/32)
+}
+
+// blockFilters guarda um filtro de Bloom de tamanho fixo por bloco. Um filtro responde
+// "talvez" para toda matrícula presente no bloco e "não" para a maioria das ausentes;
+// blocos sem filtro (além do fim) respondem sempre "talvez"
+type blockFilters struct {
+	size int
+	data []byte
+}
+
+func newBlockFilters(size int, blocks int) *blockFilters {
+	return &blockFilters{size: size, data: make([]byte, size*blocks)}
+}
+
+func (f *blockFilters) len() int {
+	return len(f.data) / f.size
+}
+
+func (f *blockFilters) filter(blockNum int) []byte {
+	return f.data[blockNum*f.size : (blockNum+1)*f.size]
+}
+
+// set substitui o filtro do bloco pelo das matrículas informadas
+func (f *blockFilters) set(blockNum int, keys []int) {
+	if blockNum >= f.len() {
+		f.resize(blockNum + 1)
+	}
+
+	filter := f.filter(blockNum)
+	clear(filter)
+	nbits := uint64(f.size * 8)
+	for _, key := range keys {
+		h1, h2 := bloomHash(key)
+		for i := uint64(0); i < bloomHashes; i++ {
+			bit := (h1 + i*h2) % nbits
+			filter[bit/8] |= 1 << (bit % 8)
+		}
+	}
+}
+
+func (f *blockFilters) mayContain(blockNum int, key int) bool {
+	if blockNum >= f.len() {
+		return true
+	}
+
+	filter := f.filter(blockNum)
+	nbits := uint64(f.size * 8)
+	h1, h2 := bloomHash(key)
+	for i := uint64(0); i < bloomHashes; i++ {
+		bit := (h1 + i*h2) % nbits
+		if filter[bit/8]&(1<<(bit%8)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// resize ajusta a quantidade de filtros; blocos acrescentados começam com o filtro vazio
+func (f *blockFilters) resize(blocks int) {
+	if blocks <= f.len() {
+		f.data = f.data[:blocks*f.size]
+		return
+	}
+	f.data = append(f.data, make([]byte, (blocks-f.len())*f.size)...)
+}
+
+// fillRate devolve o percentual de bits ligados nos filtros não vazios e a quantidade desses filtros
+func (f *blockFilters) fillRate() (float64, int) {
+	ones, filters := 0, 0
+	for blockNum := 0; blockNum < f.len(); blockNum++ {
+		count := 0
+		for _, b := range f.filter(blockNum) {
+			count += bits.OnesCount8(b)
+		}
+		if count > 0 {
+			ones += count
+			filters++
+		}
+	}
+	if filters == 0 {
+		return 0, 0
+	}
+	return float64(ones) / float64(filters*f.size*8) * 100, filters
+}
+
+// bloomHash gera os dois hashes do hashing duplo (h1 + i*h2) a partir da matrícula
+func bloomHash(key int) (uint64, uint64) {
+	h := uint64(key)
+	return mix64(h), mix64(h^0x9e3779b97f4a7c15) | 1
+}
+
+// mix64 é o finalizador do splitmix64
+func mix64(x uint64) uint64 {
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
+
+func (f *blockFilters) save(filename string, generation uint64) error {
+	data := make([]byte, bloomHeaderSize+len(f.data))
+	copy(data[0:4], bloomMagic)
+	binary.LittleEndian.PutUint64(data[4:12], generation)
+	binary.LittleEndian.PutUint32(data[12:16], uint32(f.len()))
+	binary.LittleEndian.PutUint32(data[16:20], uint32(f.size))
+	copy(data[bloomHeaderSize:], f.data)
+
+	if err := os.WriteFile(filename, data, 0644); err != nil {
+		return fmt.Errorf("erro ao gravar filtros de Bloom: %w", err)
+	}
+	return nil
+}
+
+// loadBlockFiltersFile lê os filtros persistidos; devolve nil se estiverem ausentes,
+// corrompidos, com outro tamanho ou desatualizados em relação ao arquivo de dados
+func loadBlockFiltersFile(filename string, generation uint64, totalBlocks int, size int) *blockFilters {
+	data, err := os.ReadFile(filename)
+	if err != nil || len(data) < bloomHeaderSize || string(data[0:4]) != bloomMagic {
+		return nil
+	}
+
+	if binary.LittleEndian.Uint64(data[4:12]) != generation {
+		return nil
+	}
+
+	count := int(binary.LittleEndian.Uint32(data[12:16]))
+	if count != totalBlocks || int(binary.LittleEndian.Uint32(data[16:20])) != size || len(data) != bloomHeaderSize+size*count {
+		return nil
+	}
+
+	return &blockFilters{size: size, data: data[bloomHeaderSize:]}
+}
+
+// BloomFilterStats resume os filtros de Bloom do arquivo e o efeito deles nas buscas por
+// matrícula feitas por esta instância. Um falso positivo é um bloco lido porque o filtro
+// respondeu "talvez" sem que a matrícula estivesse nele
+type BloomFilterStats struct {
+	Blocks         int
+	Filters        int
+	FilterBytes    int
+	Hashes         int
+	FillRate       float64
+	Lookups        int
+	BlocksRead     int
+	BlocksSkipped  int
+	FalsePositives int
+}
+
+// FalsePositiveRate é o percentual de blocos sem a matrícula que o filtro não descartou
+func (s BloomFilterStats) FalsePositiveRate() float64 {
+	negatives := s.BlocksSkipped + s.FalsePositives
+	if negatives == 0 {
+		return 0
+	}
+	return float64(s.FalsePositives) / float64(negatives) * 100
+}
+
+// EstimatedFalsePositiveRate é a taxa esperada pela ocupação dos filtros: (bits ligados)^k
+func (s BloomFilterStats) EstimatedFalsePositiveRate() float64 {
+	return math.Pow(s.FillRate/100, float64(s.Hashes)) * 100
+}
+
+type bloomCounters struct {
+	lookups        int
+	blocksRead     int
+	blocksSkipped  int
+	falsePositives int
+}
@@ -0,0 +1,262 @@
+package storage
+
+import (
+	"aeds2-tp1/domain"
+	"aeds2-tp1/entity"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestBlockFiltersHaveNoFalseNegatives(t *testing.T) {
+	random := rand.New(rand.NewSource(23))
+	for _, blockSize := range []int{64, 512, 4096} {
+		size := bloomFilterBytes(blockSize)
+		filters := newBlockFilters(size, 0)
+		keys := make([][]int, 20)
+		present := make(map[int]bool)
+		for blockNum := range keys {
+			// Cerca de um registro a cada 100 bytes do bloco, com pelo menos um
+			keys[blockNum] = make([]int, 1+blockSize/100)
+			for i := range keys[blockNum] {
+				keys[blockNum][i] = 100000000 + random.Intn(900000000)
+				present[keys[blockNum][i]] = true
+			}
+			filters.set(blockNum, keys[blockNum])
+		}
+
+		for blockNum, blockKeys := range keys {
+			for _, key := range blockKeys {
+				if !filters.mayContain(blockNum, key) {
+					t.Fatalf("bloco de %d bytes: filtro %d descartou a matrícula %d", blockSize, blockNum, key)
+				}
+			}
+		}
+
+		// Com pelo menos 15 bits por matrícula e 6 hashes a taxa esperada fica abaixo de 1%
+		positives, negatives := 0, 0
+		for i := 0; i < 20000; i++ {
+			key := 100000000 + random.Intn(900000000)
+			if present[key] {
+				continue
+			}
+			negatives++
+			if filters.mayContain(i%len(keys), key) {
+				positives++
+			}
+		}
+		if rate := float64(positives) / float64(negatives) * 100; rate > 5 {
+			t.Fatalf("bloco de %d bytes: %.1f%% de falsos positivos", blockSize, rate)
+		}
+
+		// Substituir o filtro esquece as matrículas antigas; blocos além do fim respondem "talvez"
+		filters.set(3, keys[4])
+		for _, key := range keys[4] {
+			if !filters.mayContain(3, key) {
+				t.Fatalf("filtro substituído descartou a matrícula %d", key)
+			}
+		}
+		if !filters.mayContain(len(keys), keys[0][0]) {
+			t.Fatal("bloco sem filtro descartou uma matrícula")
+		}
+		filters.resize(len(keys) + 2)
+		if filters.mayContain(len(keys)+1, keys[0][0]) {
+			t.Fatal("filtro acrescentado por resize não está vazio")
+		}
+	}
+}
+
+// checkFoundByMatricula confere que toda matrícula ativa é encontrada e nenhuma removida
+func checkFoundByMatricula(t *testing.T, vs *VariableStorage, filename string, want map[int]entity.Student, removed []int) {
+	t.Helper()
+	for matricula, student := range want {
+		got, err := vs.FindStudentByMatricula(filename, matricula)
+		if err != nil {
+			t.Fatalf("matrícula %d não encontrada: %v", matricula, err)
+		}
+		checkSameStudent(t, got, student)
+	}
+	for _, matricula := range removed {
+		if _, err := vs.FindStudentByMatricula(filename, matricula); err == nil {
+			t.Fatalf("matrícula removida %d encontrada", matricula)
+		}
+	}
+}
+
+func TestBloomFiltersFollowEveryWrite(t *testing.T) {
+	const blockSize = 256
+	vs, err := NewVariableStorage(blockSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	filename := filepath.Join(t.TempDir(), "alunos.dat")
+	generator := domain.NewStudentGenerator()
+	students := generator.Generate(200)
+	if err := vs.WriteStudents(filename, students); err != nil {
+		t.Fatal(err)
+	}
+	want := make(map[int]entity.Student)
+	for _, student := range students {
+		want[student.Matricula] = student
+	}
+	checkFoundByMatricula(t, vs, filename, want, nil)
+
+	// Atualizações que mudam o registro de bloco ou o levam para o overflow
+	var removed []int
+	for i, student := range students[:40] {
+		switch i % 4 {
+		case 0:
+			student.Nome = strings.Repeat("N", entity.MaxNomeLength)
+		case 1:
+			student.Nome = "A"
+		case 2:
+			if err := vs.DeleteStudent(filename, student.Matricula); err != nil {
+				t.Fatal(err)
+			}
+			delete(want, student.Matricula)
+			removed = append(removed, student.Matricula)
+			continue
+		default:
+			student.FiliacaoMae = strings.Repeat("M", entity.MaxFiliacaoLength)
+			student.FiliacaoPai = strings.Repeat("P", entity.MaxFiliacaoLength)
+		}
+		if err := vs.UpdateStudent(filename, student); err != nil {
+			t.Fatal(err)
+		}
+		want[student.Matricula] = student
+	}
+	added, err := generator.GenerateFrom(100000201, 30)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := vs.AddStudents(filename, added); err != nil {
+		t.Fatal(err)
+	}
+	for _, student := range added {
+		want[student.Matricula] = student
+	}
+	checkFoundByMatricula(t, vs, filename, want, removed)
+
+	// Dois de cada três alunos removidos deixam os blocos vizinhos com espaço para a junção
+	for i, student := range students[40:] {
+		if i%3 == 0 {
+			continue
+		}
+		if err := vs.DeleteStudent(filename, student.Matricula); err != nil {
+			t.Fatal(err)
+		}
+		delete(want, student.Matricula)
+		removed = append(removed, student.Matricula)
+	}
+	report, err := vs.CompactBlocks(filename, CompactionOptions{MergeBlocks: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.RecordsMoved == 0 {
+		t.Fatal("compactação sem registros movidos entre blocos")
+	}
+	checkFoundByMatricula(t, vs, filename, want, removed)
+
+	// Outra instância lê o .blm gravado; a primeira percebe a alteração feita pela segunda
+	other, err := NewVariableStorage(blockSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkFoundByMatricula(t, other, filename, want, removed)
+	late, err := generator.GenerateFrom(100000301, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := other.AddStudents(filename, late); err != nil {
+		t.Fatal(err)
+	}
+	for _, student := range late {
+		want[student.Matricula] = student
+	}
+	checkFoundByMatricula(t, vs, filename, want, removed)
+}
+
+func TestStaleBloomFileIsIgnored(t *testing.T) {
+	const blockSize = 512
+	vs, err := NewVariableStorage(blockSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	filename := filepath.Join(t.TempDir(), "alunos.dat")
+	generator := domain.NewStudentGenerator()
+	if err := vs.WriteStudents(filename, generator.Generate(100)); err != nil {
+		t.Fatal(err)
+	}
+	bloomFilename := companionFilename(filename, bloomExtension)
+	old, err := os.ReadFile(bloomFilename)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Filtros de outra geração (ex.: restaurados de uma cópia) não descartam o bloco alterado
+	added, err := generator.GenerateFrom(100000101, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := vs.AddStudents(filename, added); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(bloomFilename, old, 0644); err != nil {
+		t.Fatal(err)
+	}
+	reopened, err := NewVariableStorage(blockSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, student := range added {
+		if _, err := reopened.FindStudentByMatricula(filename, student.Matricula); err != nil {
+			t.Fatalf("matrícula %d não encontrada com o .blm desatualizado: %v", student.Matricula, err)
+		}
+	}
+}
+
+func TestBloomStatsCountsSkippedBlocks(t *testing.T) {
+	vs, err := NewVariableStorage(512)
+	if err != nil {
+		t.Fatal(err)
+	}
+	filename := filepath.Join(t.TempDir(), "alunos.dat")
+	students := domain.NewStudentGenerator().Generate(300)
+	if err := vs.WriteStudents(filename, students); err != nil {
+		t.Fatal(err)
+	}
+
+	const absent = 50
+	for i := 0; i < absent; i++ {
+		if _, err := vs.FindStudentByMatricula(filename, 800000000+i); err == nil {
+			t.Fatal("matrícula inexistente encontrada")
+		}
+	}
+	stats, err := vs.BloomStats(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Sem a matrícula no arquivo, todo bloco lido é um falso positivo
+	if stats.Lookups != absent || stats.BlocksRead != stats.FalsePositives || stats.BlocksRead+stats.BlocksSkipped != absent*stats.Blocks {
+		t.Fatalf("estatísticas após %d buscas sem resultado em %d blocos: %+v", absent, stats.Blocks, *stats)
+	}
+	if stats.FalsePositiveRate() > 5 || stats.Hashes != bloomHashes || stats.FilterBytes != bloomFilterBytes(512) || stats.Filters != stats.Blocks {
+		t.Fatalf("estatísticas dos filtros: %+v", *stats)
+	}
+
+	for _, student := range students[:absent] {
+		if _, err := vs.FindStudentByMatricula(filename, student.Matricula); err != nil {
+			t.Fatal(err)
+		}
+	}
+	after, err := vs.BloomStats(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if after.Lookups != 2*absent || after.BlocksRead-stats.BlocksRead < absent {
+		t.Fatalf("estatísticas após %d buscas encontradas: %+v", absent, *after)
+	}
+}
@@ -0,0 +1,500 @@
+package storage
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+)
+
+// Árvore B+ em disco que mapeia uma chave inteira (matrícula, CPF ou CA combinado com o
+// RecordID) para RecordID. O arquivo é dividido em nós do tamanho do bloco do arquivo de
+// dados (com um mínimo para garantir ao menos três entradas por nó); o nó 0 é o cabeçalho:
+// magic (4) + versão (4) + tamanho do nó (4) + raiz (4) + quantidade de nós (4) +
+// entradas (4) + altura (4) + geração (8) do arquivo de dados indexado. Cada nó tem
+// tipo (1) + reservado (1) + quantidade de chaves (2) + próxima folha (4) e, em seguida, as
+// entradas: nas folhas chave (8) + bloco (4) + slot (4); nos nós internos o primeiro
+// filho (4) seguido de pares chave (8) + filho (4)
+const (
+	bptMagic          = "BIDX"
+	bptFormatVersion  = 2
+	bptHeaderSize     = 36
+	bptNodeHeaderSize = 8
+	bptLeafEntrySize  = 16
+	bptChildSize      = 4
+	bptInnerEntrySize = 12
+	bptMinNodeSize    = 64
+
+	bptLeaf  = 1
+	bptInner = 2
+)
+
+var errInvalidIndex = errors.New("arquivo de índice inválido")
+
+type bptNode struct {
+	leaf     bool
+	keys     []int
+	rids     []RecordID
+	children []int
+	next     int
+}
+
+type bplusTree struct {
+	file       *os.File
+	nodeSize   int
+	root       int
+	nodeCount  int
+	entries    int
+	height     int
+	generation uint64
+}
+
+type indexEntry struct {
+	key int
+	rid RecordID
+}
+
+// indexNodeSize usa o tamanho do bloco do arquivo de dados, respeitando o mínimo da árvore
+func indexNodeSize(blockSize int) int {
+	if blockSize < bptMinNodeSize {
+		return bptMinNodeSize
+	}
+	return blockSize
+}
+
+func (t *bplusTree) leafCapacity() int {
+	return (t.nodeSize - bptNodeHeaderSize) / bptLeafEntrySize
+}
+
+func (t *bplusTree) innerCapacity() int {
+	return (t.nodeSize - bptNodeHeaderSize - bptChildSize) / bptInnerEntrySize
+}
+
+// openBPlusTree abre um índice existente; devolve erro se o arquivo não existir ou tiver
+// sido gravado com outro tamanho de nó
+func openBPlusTree(filename string, blockSize int) (*bplusTree, error) {
+	file, err := os.OpenFile(filename, os.O_RDWR, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	data := make([]byte, bptHeaderSize)
+	if _, err := file.ReadAt(data, 0); err != nil || string(data[0:4]) != bptMagic {
+		file.Close()
+		return nil, fmt.Errorf("%s: %w", filename, errInvalidIndex)
+	}
+
+	t := &bplusTree{
+		file:       file,
+		nodeSize:   int(binary.LittleEndian.Uint32(data[8:12])),
+		root:       int(binary.LittleEndian.Uint32(data[12:16])),
+		nodeCount:  int(binary.LittleEndian.Uint32(data[16:20])),
+		entries:    int(binary.LittleEndian.Uint32(data[20:24])),
+		height:     int(binary.LittleEndian.Uint32(data[24:28])),
+		generation: binary.LittleEndian.Uint64(data[28:36]),
+	}
+	if binary.LittleEndian.Uint32(data[4:8]) != bptFormatVersion || t.nodeSize != indexNodeSize(blockSize) {
+		file.Close()
+		return nil, fmt.Errorf("%s: %w", filename, errInvalidIndex)
+	}
+	return t, nil
+}
+
+// createBPlusTree monta a árvore de baixo para cima a partir das entradas, que devem estar
+// ordenadas por chave: as folhas são preenchidas por completo e cada nível interno
+// aponta para os nós do nível anterior
+func createBPlusTree(filename string, blockSize int, generation uint64, entries []indexEntry) (*bplusTree, error) {
+	file, err := os.Create(filename)
+	if err != nil {
+		return nil, fmt.Errorf("erro ao criar índice: %w", err)
+	}
+
+	t := &bplusTree{
+		file:       file,
+		nodeSize:   indexNodeSize(blockSize),
+		nodeCount:  1,
+		generation: generation,
+	}
+
+	type levelNode struct {
+		firstKey int
+		nodeNum  int
+	}
+
+	level := make([]levelNode, 0)
+	leafCap := t.leafCapacity()
+	for start := 0; start < len(entries) || len(level) == 0; start += leafCap {
+		end := start + leafCap
+		if end > len(entries) {
+			end = len(entries)
+		}
+
+		node := &bptNode{leaf: true}
+		for _, entry := range entries[start:end] {
+			node.keys = append(node.keys, entry.key)
+			node.rids = append(node.rids, entry.rid)
+		}
+		if end < len(entries) {
+			node.next = t.nodeCount + 1
+		}
+
+		nodeNum := t.allocNode()
+		if err := t.writeNode(nodeNum, node); err != nil {
+			file.Close()
+			return nil, err
+		}
+
+		firstKey := 0
+		if len(node.keys) > 0 {
+			firstKey = node.keys[0]
+		}
+		level = append(level, levelNode{firstKey, nodeNum})
+	}
+	t.entries = len(entries)
+	t.height = 1
+
+	fanout := t.innerCapacity() + 1
+	for len(level) > 1 {
+		parents := make([]levelNode, 0)
+		for start := 0; start < len(level); start += fanout {
+			end := start + fanout
+			if end > len(level) {
+				end = len(level)
+			}
+
+			node := &bptNode{children: []int{level[start].nodeNum}}
+			for _, child := range level[start+1 : end] {
+				node.keys = append(node.keys, child.firstKey)
+				node.children = append(node.children, child.nodeNum)
+			}
+
+			nodeNum := t.allocNode()
+			if err := t.writeNode(nodeNum, node); err != nil {
+				file.Close()
+				return nil, err
+			}
+			parents = append(parents, levelNode{level[start].firstKey, nodeNum})
+		}
+		level = parents
+		t.height++
+	}
+	t.root = level[0].nodeNum
+
+	if err := t.writeHeader(); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return t, nil
+}
+
+func (t *bplusTree) allocNode() int {
+	nodeNum := t.nodeCount
+	t.nodeCount++
+	return nodeNum
+}
+
+func (t *bplusTree) writeHeader() error {
+	data := make([]byte, t.nodeSize)
+	copy(data[0:4], bptMagic)
+	binary.LittleEndian.PutUint32(data[4:8], bptFormatVersion)
+	binary.LittleEndian.PutUint32(data[8:12], uint32(t.nodeSize))
+	binary.LittleEndian.PutUint32(data[12:16], uint32(t.root))
+	binary.LittleEndian.PutUint32(data[16:20], uint32(t.nodeCount))
+	binary.LittleEndian.PutUint32(data[20:24], uint32(t.entries))
+	binary.LittleEndian.PutUint32(data[24:28], uint32(t.height))
+	binary.LittleEndian.PutUint64(data[28:36], t.generation)
+	if _, err := t.file.WriteAt(data, 0); err != nil {
+		return fmt.Errorf("erro ao gravar cabeçalho do índice: %w", err)
+	}
+	return nil
+}
+
+func (t *bplusTree) readNode(nodeNum int) (*bptNode, error) {
+	if nodeNum <= 0 || nodeNum >= t.nodeCount {
+		return nil, fmt.Errorf("nó %d fora do índice: %w", nodeNum, errInvalidIndex)
+	}
+
+	data := make([]byte, t.nodeSize)
+	if _, err := t.file.ReadAt(data, int64(nodeNum)*int64(t.nodeSize)); err != nil {
+		return nil, fmt.Errorf("erro ao ler nó %d do índice: %w", nodeNum, err)
+	}
+
+	count := int(binary.LittleEndian.Uint16(data[2:4]))
+	node := &bptNode{
+		leaf: data[0] == bptLeaf,
+		next: int(binary.LittleEndian.Uint32(data[4:8])),
+	}
+
+	if node.leaf {
+		if count > t.leafCapacity() {
+			return nil, fmt.Errorf("nó %d do índice corrompido: %w", nodeNum, errInvalidIndex)
+		}
+		for i := 0; i < count; i++ {
+			offset := bptNodeHeaderSize + i*bptLeafEntrySize
+			node.keys = append(node.keys, int(binary.LittleEndian.Uint64(data[offset:offset+8])))
+			node.rids = append(node.rids, RecordID{
+				Block: int(binary.LittleEndian.Uint32(data[offset+8 : offset+12])),
+				Slot:  int(binary.LittleEndian.Uint32(data[offset+12 : offset+16])),
+			})
+		}
+		return node, nil
+	}
+
+	if data[0] != bptInner || count > t.innerCapacity() {
+		return nil, fmt.Errorf("nó %d do índice corrompido: %w", nodeNum, errInvalidIndex)
+	}
+	node.children = append(node.children, int(binary.LittleEndian.Uint32(data[8:12])))
+	for i := 0; i < count; i++ {
+		offset := bptNodeHeaderSize + bptChildSize + i*bptInnerEntrySize
+		node.keys = append(node.keys, int(binary.LittleEndian.Uint64(data[offset:offset+8])))
+		node.children = append(node.children, int(binary.LittleEndian.Uint32(data[offset+8:offset+12])))
+	}
+	return node, nil
+}
+
+func (t *bplusTree) writeNode(nodeNum int, node *bptNode) error {
+	data := make([]byte, t.nodeSize)
+	binary.LittleEndian.PutUint16(data[2:4], uint16(len(node.keys)))
+	binary.LittleEndian.PutUint32(data[4:8], uint32(node.next))
+
+	if node.leaf {
+		data[0] = bptLeaf
+		for i, key := range node.keys {
+			offset := bptNodeHeaderSize + i*bptLeafEntrySize
+			binary.LittleEndian.PutUint64(data[offset:offset+8], uint64(key))
+			binary.LittleEndian.PutUint32(data[offset+8:offset+12], uint32(node.rids[i].Block))
+			binary.LittleEndian.PutUint32(data[offset+12:offset+16], uint32(node.rids[i].Slot))
+		}
+	} else {
+		data[0] = bptInner
+		binary.LittleEndian.PutUint32(data[8:12], uint32(node.children[0]))
+		for i, key := range node.keys {
+			offset := bptNodeHeaderSize + bptChildSize + i*bptInnerEntrySize
+			binary.LittleEndian.PutUint64(data[offset:offset+8], uint64(key))
+			binary.LittleEndian.PutUint32(data[offset+8:offset+12], uint32(node.children[i+1]))
+		}
+	}
+
+	if _, err := t.file.WriteAt(data, int64(nodeNum)*int64(t.nodeSize)); err != nil {
+		return fmt.Errorf("erro ao gravar nó %d do índice: %w", nodeNum, err)
+	}
+	return nil
+}
+
+// childIndex escolhe o filho que cobre a chave: o filho i guarda as chaves entre keys[i-1]
+// (inclusive) e keys[i]
+func (n *bptNode) childIndex(key int) int {
+	return sort.Search(len(n.keys), func(i int) bool { return n.keys[i] > key })
+}
+
+// findLeaf desce da raiz até a folha que deve conter a chave
+func (t *bplusTree) findLeaf(key int) (int, *bptNode, error) {
+	nodeNum := t.root
+	for {
+		node, err := t.readNode(nodeNum)
+		if err != nil {
+			return 0, nil, err
+		}
+		if node.leaf {
+			return nodeNum, node, nil
+		}
+		nodeNum = node.children[node.childIndex(key)]
+	}
+}
+
+// search lê um nó por nível da árvore
+func (t *bplusTree) search(key int) (RecordID, bool, error) {
+	_, leaf, err := t.findLeaf(key)
+	if err != nil {
+		return RecordID{}, false, err
+	}
+
+	i := sort.SearchInts(leaf.keys, key)
+	if i < len(leaf.keys) && leaf.keys[i] == key {
+		return leaf.rids[i], true, nil
+	}
+	return RecordID{}, false, nil
+}
+
+// scanRange percorre, em ordem, as entradas com chave entre lo e hi (inclusive): desce até
+// a folha de lo e segue a lista encadeada de folhas
+func (t *bplusTree) scanRange(lo int, hi int, fn func(key int, rid RecordID) bool) error {
+	_, leaf, err := t.findLeaf(lo)
+	if err != nil {
+		return err
+	}
+
+	for leaves := 0; ; leaves++ {
+		for i, key := range leaf.keys {
+			if key < lo {
+				continue
+			}
+			if key > hi || !fn(key, leaf.rids[i]) {
+				return nil
+			}
+		}
+		if leaf.next == 0 || leaves >= t.nodeCount {
+			return nil
+		}
+		if leaf, err = t.readNode(leaf.next); err != nil {
+			return err
+		}
+	}
+}
+
+// scan percorre todas as entradas em ordem de chave
+func (t *bplusTree) scan(fn func(key int, rid RecordID) bool) error {
+	return t.scanRange(math.MinInt, math.MaxInt, fn)
+}
+
+// insert grava ou substitui a entrada da chave, dividindo os nós cheios no caminho de
+// volta e criando uma nova raiz quando a raiz se divide
+func (t *bplusTree) insert(key int, rid RecordID) error {
+	split, separator, right, err := t.insertAt(t.root, key, rid)
+	if err != nil || !split {
+		return err
+	}
+
+	root := &bptNode{keys: []int{separator}, children: []int{t.root, right}}
+	rootNum := t.allocNode()
+	if err := t.writeNode(rootNum, root); err != nil {
+		return err
+	}
+	t.root = rootNum
+	t.height++
+	return nil
+}
+
+func (t *bplusTree) insertAt(nodeNum int, key int, rid RecordID) (bool, int, int, error) {
+	node, err := t.readNode(nodeNum)
+	if err != nil {
+		return false, 0, 0, err
+	}
+
+	if node.leaf {
+		i := sort.SearchInts(node.keys, key)
+		if i < len(node.keys) && node.keys[i] == key {
+			node.rids[i] = rid
+			return false, 0, 0, t.writeNode(nodeNum, node)
+		}
+
+		node.keys = append(node.keys[:i], append([]int{key}, node.keys[i:]...)...)
+		node.rids = append(node.rids[:i], append([]RecordID{rid}, node.rids[i:]...)...)
+		t.entries++
+		if len(node.keys) <= t.leafCapacity() {
+			return false, 0, 0, t.writeNode(nodeNum, node)
+		}
+
+		mid := len(node.keys) / 2
+		right := &bptNode{
+			leaf: true,
+			keys: append([]int(nil), node.keys[mid:]...),
+			rids: append([]RecordID(nil), node.rids[mid:]...),
+			next: node.next,
+		}
+		rightNum := t.allocNode()
+		node.keys, node.rids, node.next = node.keys[:mid], node.rids[:mid], rightNum
+		if err := t.writeNode(rightNum, right); err != nil {
+			return false, 0, 0, err
+		}
+		return true, right.keys[0], rightNum, t.writeNode(nodeNum, node)
+	}
+
+	i := node.childIndex(key)
+	split, separator, child, err := t.insertAt(node.children[i], key, rid)
+	if err != nil || !split {
+		return false, 0, 0, err
+	}
+
+	node.keys = append(node.keys[:i], append([]int{separator}, node.keys[i:]...)...)
+	node.children = append(node.children[:i+1], append([]int{child}, node.children[i+1:]...)...)
+	if len(node.keys) <= t.innerCapacity() {
+		return false, 0, 0, t.writeNode(nodeNum, node)
+	}
+
+	mid := len(node.keys) / 2
+	right := &bptNode{
+		keys:     append([]int(nil), node.keys[mid+1:]...),
+		children: append([]int(nil), node.children[mid+1:]...),
+	}
+	separator = node.keys[mid]
+	node.keys, node.children = node.keys[:mid], node.children[:mid+1]
+
+	rightNum := t.allocNode()
+	if err := t.writeNode(rightNum, right); err != nil {
+		return false, 0, 0, err
+	}
+	return true, separator, rightNum, t.writeNode(nodeNum, node)
+}
+
+// remove apaga a entrada da folha sem redistribuir nós: folhas podem ficar pouco ocupadas
+// ou vazias até a próxima reconstrução do índice, sem afetar a busca
+func (t *bplusTree) remove(key int) (bool, error) {
+	nodeNum, leaf, err := t.findLeaf(key)
+	if err != nil {
+		return false, err
+	}
+
+	i := sort.SearchInts(leaf.keys, key)
+	if i >= len(leaf.keys) || leaf.keys[i] != key {
+		return false, nil
+	}
+
+	leaf.keys = append(leaf.keys[:i], leaf.keys[i+1:]...)
+	leaf.rids = append(leaf.rids[:i], leaf.rids[i+1:]...)
+	t.entries--
+	return true, t.writeNode(nodeNum, leaf)
+}
+
+func (t *bplusTree) dataGeneration() uint64 {
+	return t.generation
+}
+
+// stats percorre a lista encadeada de folhas a partir da folha mais à esquerda
+func (t *bplusTree) stats() (*IndexStats, error) {
+	stats := &IndexStats{
+		Kind:         IndexBPlusTree,
+		Entries:      t.entries,
+		PageCapacity: t.leafCapacity(),
+		Height:       t.height,
+		Nodes:        t.nodeCount - 1,
+	}
+
+	nodeNum := t.root
+	for {
+		node, err := t.readNode(nodeNum)
+		if err != nil {
+			return nil, err
+		}
+		if node.leaf {
+			break
+		}
+		nodeNum = node.children[0]
+	}
+
+	for leaves := 0; nodeNum != 0 && leaves < t.nodeCount; leaves++ {
+		leaf, err := t.readNode(nodeNum)
+		if err != nil {
+			return nil, err
+		}
+		stats.addPage(len(leaf.keys))
+		nodeNum = leaf.next
+	}
+	return stats, nil
+}
+
+// save registra a geração do arquivo de dados que o índice descreve e fecha o arquivo
+func (t *bplusTree) save(generation uint64) error {
+	t.generation = generation
+	if err := t.writeHeader(); err != nil {
+		t.file.Close()
+		return err
+	}
+	return t.file.Close()
+}
+
+func (t *bplusTree) close() error {
+	return t.file.Close()
+}
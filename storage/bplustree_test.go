@@ -0,0 +1,238 @@
+package storage
+
+import (
+	"aeds2-tp1/domain"
+	"path/filepath"
+	"testing"
+)
+
+// Com blocos de 64 bytes cada folha guarda 3 entradas e cada nó interno 5 filhos, então
+// poucas centenas de chaves já produzem divisões de folhas e de nós internos
+const testIndexBlockSize = 64
+
+// collectKeys devolve as chaves da árvore na ordem percorrida por scan
+func collectKeys(t *testing.T, tree *bplusTree) []int {
+	t.Helper()
+	keys := make([]int, 0)
+	err := tree.scan(func(key int, rid RecordID) bool {
+		keys = append(keys, key)
+		return true
+	})
+	if err != nil {
+		t.Fatalf("scan: %v", err)
+	}
+	return keys
+}
+
+func checkAscending(t *testing.T, keys []int) {
+	t.Helper()
+	for i := 1; i < len(keys); i++ {
+		if keys[i-1] >= keys[i] {
+			t.Fatalf("chaves fora de ordem na posição %d: %d, %d", i, keys[i-1], keys[i])
+		}
+	}
+}
+
+func TestBPlusTreeBulkBuild(t *testing.T) {
+	entries := make([]indexEntry, 0)
+	for key := 0; key < 1000; key += 2 {
+		entries = append(entries, indexEntry{key: key, rid: RecordID{Block: key, Slot: key % 7}})
+	}
+
+	tree, err := createBPlusTree(filepath.Join(t.TempDir(), "a.idx"), testIndexBlockSize, 1, entries)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tree.close()
+
+	if tree.height < 3 {
+		t.Fatalf("altura = %d, esperada pelo menos 3", tree.height)
+	}
+	for key := 0; key < 1000; key++ {
+		rid, ok, err := tree.search(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ok != (key%2 == 0) {
+			t.Fatalf("search(%d) encontrou = %v", key, ok)
+		}
+		if ok && rid != (RecordID{Block: key, Slot: key % 7}) {
+			t.Fatalf("search(%d) = %s", key, rid)
+		}
+	}
+
+	keys := collectKeys(t, tree)
+	if len(keys) != len(entries) {
+		t.Fatalf("scan devolveu %d chaves, esperadas %d", len(keys), len(entries))
+	}
+	checkAscending(t, keys)
+}
+
+func TestBPlusTreeInsertSplitsLeavesAndInnerNodes(t *testing.T) {
+	tree, err := createBPlusTree(filepath.Join(t.TempDir(), "a.idx"), testIndexBlockSize, 1, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tree.close()
+
+	// 7919 é primo com 1000, então as chaves chegam fora de ordem e cobrem 0..999
+	for i := 0; i < 1000; i++ {
+		key := i * 7919 % 1000
+		if err := tree.insert(key, RecordID{Block: key, Slot: 1}); err != nil {
+			t.Fatalf("insert(%d): %v", key, err)
+		}
+	}
+
+	if tree.entries != 1000 {
+		t.Fatalf("entries = %d, esperadas 1000", tree.entries)
+	}
+	if tree.height < 3 {
+		t.Fatalf("altura = %d: os nós internos não se dividiram", tree.height)
+	}
+	for key := 0; key < 1000; key++ {
+		rid, ok, err := tree.search(key)
+		if err != nil || !ok || rid.Block != key {
+			t.Fatalf("search(%d) = %s, %v, %v", key, rid, ok, err)
+		}
+	}
+
+	keys := collectKeys(t, tree)
+	if len(keys) != 1000 {
+		t.Fatalf("scan devolveu %d chaves, esperadas 1000", len(keys))
+	}
+	checkAscending(t, keys)
+
+	// Reinserir uma chave substitui o RecordID sem criar outra entrada
+	if err := tree.insert(500, RecordID{Block: 9, Slot: 9}); err != nil {
+		t.Fatal(err)
+	}
+	if rid, _, _ := tree.search(500); rid != (RecordID{Block: 9, Slot: 9}) || tree.entries != 1000 {
+		t.Fatalf("substituição: %s, entries = %d", rid, tree.entries)
+	}
+}
+
+func TestBPlusTreeRemove(t *testing.T) {
+	tree, err := createBPlusTree(filepath.Join(t.TempDir(), "a.idx"), testIndexBlockSize, 1, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tree.close()
+
+	for key := 0; key < 300; key++ {
+		if err := tree.insert(key, RecordID{Block: key}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for key := 0; key < 300; key += 3 {
+		if ok, err := tree.remove(key); !ok || err != nil {
+			t.Fatalf("remove(%d) = %v, %v", key, ok, err)
+		}
+	}
+	if ok, err := tree.remove(0); ok || err != nil {
+		t.Fatalf("remove de chave ausente = %v, %v", ok, err)
+	}
+
+	for key := 0; key < 300; key++ {
+		_, ok, err := tree.search(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ok != (key%3 != 0) {
+			t.Fatalf("search(%d) encontrou = %v", key, ok)
+		}
+	}
+	keys := collectKeys(t, tree)
+	if len(keys) != 200 || tree.entries != 200 {
+		t.Fatalf("scan devolveu %d chaves, entries = %d, esperadas 200", len(keys), tree.entries)
+	}
+	checkAscending(t, keys)
+}
+
+func TestBPlusTreeReopen(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "a.idx")
+	tree, err := createBPlusTree(filename, testIndexBlockSize, 1, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for key := 999; key >= 0; key-- {
+		if err := tree.insert(key, RecordID{Block: key, Slot: 2}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	height, nodes := tree.height, tree.nodeCount
+	if err := tree.save(9); err != nil {
+		t.Fatal(err)
+	}
+
+	tree, err = openBPlusTree(filename, testIndexBlockSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tree.close()
+
+	if tree.dataGeneration() != 9 || tree.entries != 1000 || tree.height != height || tree.nodeCount != nodes {
+		t.Fatalf("cabeçalho reaberto: geração %d, %d entradas, altura %d, %d nós", tree.dataGeneration(), tree.entries, tree.height, tree.nodeCount)
+	}
+	for key := 0; key < 1000; key++ {
+		rid, ok, err := tree.search(key)
+		if err != nil || !ok || rid != (RecordID{Block: key, Slot: 2}) {
+			t.Fatalf("search(%d) = %s, %v, %v", key, rid, ok, err)
+		}
+	}
+	checkAscending(t, collectKeys(t, tree))
+
+	if _, err := openBPlusTree(filename, 4096); err == nil {
+		t.Fatal("índice aberto com outro tamanho de nó")
+	}
+}
+
+func TestIndexedStorageRebuildsIndexOnGenerationMismatch(t *testing.T) {
+	inner, err := NewFixedStorage(512)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewIndexedStorage(inner)
+	filename := filepath.Join(t.TempDir(), "alunos.dat")
+	students := domain.NewStudentGenerator().Generate(50)
+	if err := s.WriteStudents(filename, students); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.FindStudentByMatricula(filename, students[0].Matricula); err != nil {
+		t.Fatal(err)
+	}
+
+	// Alterar o arquivo sem passar pelo IndexedStorage deixa o índice com a geração antiga
+	if err := inner.DeleteStudent(filename, students[0].Matricula); err != nil {
+		t.Fatal(err)
+	}
+	header, err := ReadFileHeader(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	indexFilename := companionFilename(filename, IndexBPlusTree.extension())
+	tree, err := openBPlusTree(indexFilename, header.BlockSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stale := tree.dataGeneration()
+	tree.close()
+	if stale == header.Generation {
+		t.Fatal("a geração do índice deveria estar desatualizada")
+	}
+
+	if _, err := s.FindStudentByMatricula(filename, students[0].Matricula); err == nil {
+		t.Fatal("aluno removido encontrado pelo índice desatualizado")
+	}
+	if _, err := s.FindStudentByMatricula(filename, students[1].Matricula); err != nil {
+		t.Fatal(err)
+	}
+
+	tree, err = openBPlusTree(indexFilename, header.BlockSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tree.close()
+	if tree.dataGeneration() != header.Generation || tree.entries != 49 {
+		t.Fatalf("índice reconstruído: geração %d (esperada %d), %d entradas", tree.dataGeneration(), header.Generation, tree.entries)
+	}
+}
@@ -0,0 +1,324 @@
+package storage
+
+import (
+	"fmt"
+	"path/filepath"
+	"sync"
+)
+
+// ReplacementPolicy escolhe o quadro reaproveitado quando o buffer pool está cheio
+type ReplacementPolicy int
+
+const (
+	ReplacementLRU ReplacementPolicy = iota
+	ReplacementClock
+)
+
+func (p ReplacementPolicy) String() string {
+	switch p {
+	case ReplacementLRU:
+		return "LRU"
+	case ReplacementClock:
+		return "Clock"
+	}
+	return fmt.Sprintf("política desconhecida (%d)", int(p))
+}
+
+var ReplacementPolicies = []ReplacementPolicy{ReplacementLRU, ReplacementClock}
+
+// DefaultBufferFrames é a quantidade de quadros do buffer pool compartilhado
+const DefaultBufferFrames = 64
+
+type pageKey struct {
+	path  string
+	block int
+}
+
+// bufferFrame guarda um bloco de dados. owner é a abertura que deixou o quadro sujo e que
+// o grava de volta na substituição; blockFile.Close grava os quadros sujos da abertura,
+// então o dono de um quadro sujo está sempre aberto
+type bufferFrame struct {
+	key        pageKey
+	data       []byte
+	valid      bool
+	pins       int
+	dirty      bool
+	owner      *blockFile
+	lastUsed   uint64
+	referenced bool
+}
+
+// BufferPool mantém em memória os blocos de dados mais usados de todos os arquivos .dat,
+// para que leituras repetidas (inclusive dentro de uma mesma operação) não voltem ao disco.
+// Gravações em blocos existentes ficam no quadro, marcado como sujo, até a substituição ou o
+// fechamento do arquivo; gravações que estendem o arquivo vão direto ao disco
+type BufferPool struct {
+	mu     sync.Mutex
+	frames []bufferFrame
+	table  map[pageKey]int
+	policy ReplacementPolicy
+	clock  int
+	tick   uint64
+
+	hits       int64
+	misses     int64
+	evictions  int64
+	writeBacks int64
+}
+
+type BufferPoolStats struct {
+	Frames     int
+	Used       int
+	Dirty      int
+	Policy     ReplacementPolicy
+	Hits       int64
+	Misses     int64
+	Evictions  int64
+	WriteBacks int64
+}
+
+// HitRate é o percentual de leituras de bloco atendidas pelo buffer pool
+func (s BufferPoolStats) HitRate() float64 {
+	total := s.Hits + s.Misses
+	if total == 0 {
+		return 0
+	}
+	return float64(s.Hits) / float64(total) * 100
+}
+
+func newBufferPool(frames int, policy ReplacementPolicy) *BufferPool {
+	return &BufferPool{
+		frames: make([]bufferFrame, frames),
+		table:  make(map[pageKey]int, frames),
+		policy: policy,
+	}
+}
+
+var bufferPool = newBufferPool(DefaultBufferFrames, ReplacementLRU)
+
+// ConfigureBufferPool troca o buffer pool compartilhado, gravando antes os quadros sujos
+func ConfigureBufferPool(frames int, policy ReplacementPolicy) error {
+	if frames < 1 {
+		return fmt.Errorf("o buffer pool precisa de pelo menos 1 quadro")
+	}
+	if policy != ReplacementLRU && policy != ReplacementClock {
+		return fmt.Errorf("política de substituição inválida: %d", int(policy))
+	}
+
+	bufferPool.mu.Lock()
+	defer bufferPool.mu.Unlock()
+	for i := range bufferPool.frames {
+		if bufferPool.frames[i].pins > 0 {
+			return fmt.Errorf("o buffer pool tem quadros em uso")
+		}
+	}
+	for i := range bufferPool.frames {
+		if err := bufferPool.writeBack(&bufferPool.frames[i]); err != nil {
+			return err
+		}
+	}
+
+	pool := newBufferPool(frames, policy)
+	bufferPool.frames, bufferPool.table, bufferPool.policy = pool.frames, pool.table, policy
+	bufferPool.clock, bufferPool.tick = 0, 0
+	bufferPool.hits, bufferPool.misses, bufferPool.evictions, bufferPool.writeBacks = 0, 0, 0, 0
+	return nil
+}
+
+func GetBufferPoolStats() BufferPoolStats {
+	bufferPool.mu.Lock()
+	defer bufferPool.mu.Unlock()
+
+	stats := BufferPoolStats{
+		Frames:     len(bufferPool.frames),
+		Policy:     bufferPool.policy,
+		Hits:       bufferPool.hits,
+		Misses:     bufferPool.misses,
+		Evictions:  bufferPool.evictions,
+		WriteBacks: bufferPool.writeBacks,
+	}
+	for i := range bufferPool.frames {
+		if bufferPool.frames[i].valid {
+			stats.Used++
+			if bufferPool.frames[i].dirty {
+				stats.Dirty++
+			}
+		}
+	}
+	return stats
+}
+
+// poolPath é a chave de um arquivo no buffer pool
+func poolPath(filename string) string {
+	if path, err := filepath.Abs(filename); err == nil {
+		return path
+	}
+	return filepath.Clean(filename)
+}
+
+// pin devolve o quadro do bloco, fixado até unpin. Com load, um bloco ausente é lido do
+// disco; sem load (gravação do bloco inteiro), o quadro começa zerado
+func (p *BufferPool) pin(bf *blockFile, blockNum int, load bool) (*bufferFrame, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	key := pageKey{path: bf.path, block: blockNum}
+	if i, ok := p.table[key]; ok {
+		frame := &p.frames[i]
+		if load {
+			p.hits++
+		}
+		frame.pins++
+		p.touch(frame)
+		return frame, nil
+	}
+
+	i, err := p.victim()
+	if err != nil {
+		return nil, err
+	}
+	frame := &p.frames[i]
+
+	if cap(frame.data) >= bf.blockSize {
+		frame.data = frame.data[:bf.blockSize]
+		clear(frame.data)
+	} else {
+		frame.data = make([]byte, bf.blockSize)
+	}
+	if load {
+		p.misses++
+		if _, err := bf.file.ReadAt(frame.data, bf.blockOffset(blockNum)); err != nil {
+			return nil, err
+		}
+	}
+
+	*frame = bufferFrame{key: key, data: frame.data, valid: true, pins: 1}
+	p.table[key] = i
+	p.touch(frame)
+	return frame, nil
+}
+
+// unpin libera o quadro; com dirty, owner passa a ser responsável por gravá-lo
+func (p *BufferPool) unpin(frame *bufferFrame, owner *blockFile, dirty bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	frame.pins--
+	if dirty {
+		frame.dirty = true
+		frame.owner = owner
+	}
+}
+
+func (p *BufferPool) touch(frame *bufferFrame) {
+	p.tick++
+	frame.lastUsed = p.tick
+	frame.referenced = true
+}
+
+// victim devolve um quadro livre ou, com o pool cheio, o escolhido pela política de
+// substituição, gravando-o antes se estiver sujo
+func (p *BufferPool) victim() (int, error) {
+	for i := range p.frames {
+		if !p.frames[i].valid {
+			return i, nil
+		}
+	}
+
+	i := -1
+	switch p.policy {
+	case ReplacementClock:
+		// Segunda chance: quadros referenciados perdem o bit e são pulados uma vez
+		for step := 0; step < 2*len(p.frames); step++ {
+			frame := &p.frames[p.clock]
+			candidate := p.clock
+			p.clock = (p.clock + 1) % len(p.frames)
+			if frame.pins > 0 {
+				continue
+			}
+			if frame.referenced {
+				frame.referenced = false
+				continue
+			}
+			i = candidate
+			break
+		}
+	default:
+		for j := range p.frames {
+			if p.frames[j].pins == 0 && (i < 0 || p.frames[j].lastUsed < p.frames[i].lastUsed) {
+				i = j
+			}
+		}
+	}
+	if i < 0 {
+		return 0, fmt.Errorf("buffer pool sem quadros livres: todos os %d quadros estão fixados", len(p.frames))
+	}
+
+	frame := &p.frames[i]
+	if err := p.writeBack(frame); err != nil {
+		return 0, err
+	}
+	delete(p.table, frame.key)
+	frame.valid = false
+	p.evictions++
+	return i, nil
+}
+
+func (p *BufferPool) writeBack(frame *bufferFrame) error {
+	if !frame.valid || !frame.dirty {
+		return nil
+	}
+	if _, err := frame.owner.file.WriteAt(frame.data, frame.owner.blockOffset(frame.key.block)); err != nil {
+		return fmt.Errorf("erro ao gravar bloco %d do buffer pool: %w", frame.key.block, err)
+	}
+	frame.dirty = false
+	frame.owner = nil
+	p.writeBacks++
+	return nil
+}
+
+// flush grava os quadros sujos de uma abertura, antes que ela seja fechada
+func (p *BufferPool) flush(bf *blockFile) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for i := range p.frames {
+		if frame := &p.frames[i]; frame.valid && frame.dirty && frame.owner == bf {
+			if err := p.writeBack(frame); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// discard descarta, sem gravar, os quadros do arquivo a partir do bloco from; é usado quando
+// o arquivo é recriado, truncado ou substituído por outro
+func (p *BufferPool) discard(path string, from int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for i := range p.frames {
+		if frame := &p.frames[i]; frame.valid && frame.key.path == path && frame.key.block >= from {
+			delete(p.table, frame.key)
+			*frame = bufferFrame{data: frame.data}
+		}
+	}
+}
+
+// discardBlock descarta o quadro de um bloco regravado direto em disco
+func (p *BufferPool) discardBlock(path string, block int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	key := pageKey{path: path, block: block}
+	if i, ok := p.table[key]; ok {
+		delete(p.table, key)
+		p.frames[i] = bufferFrame{data: p.frames[i].data}
+	}
+}
+
+// invalidateCachedBlocks descarta os blocos em memória de um arquivo renomeado ou removido
+func invalidateCachedBlocks(filename string) {
+	bufferPool.discard(poolPath(filename), 0)
+}
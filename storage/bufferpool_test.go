@@ -0,0 +1,283 @@
+package storage
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const poolTestBlockSize = 64
+
+// newPoolTestFile cria um arquivo com blocks blocos de dados; o bloco i é preenchido com o
+// byte i+1, gravado direto em disco
+func newPoolTestFile(t *testing.T, blocks int) (*blockFile, string) {
+	t.Helper()
+	filename := filepath.Join(t.TempDir(), "pool.dat")
+	bf, err := createBlockFile(filename, ModeFixed, poolTestBlockSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < blocks; i++ {
+		if err := bf.appendBlock(bytes.Repeat([]byte{byte(i + 1)}, poolTestBlockSize)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return bf, filename
+}
+
+// diskBlock lê o bloco direto do arquivo, sem passar pelo buffer pool
+func diskBlock(t *testing.T, filename string, blockNum int) []byte {
+	t.Helper()
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	offset := (blockNum + 1) * poolTestBlockSize
+	return data[offset : offset+poolTestBlockSize]
+}
+
+// touchBlock fixa e libera o bloco, como uma leitura
+func touchBlock(t *testing.T, p *BufferPool, bf *blockFile, blockNum int) {
+	t.Helper()
+	frame, err := p.pin(bf, blockNum, true)
+	if err != nil {
+		t.Fatalf("pin(%d): %v", blockNum, err)
+	}
+	if frame.data[0] != byte(blockNum+1) {
+		t.Fatalf("bloco %d carregado com o byte %d", blockNum, frame.data[0])
+	}
+	p.unpin(frame, bf, false)
+}
+
+func cachedBlocks(p *BufferPool, bf *blockFile) map[int]bool {
+	blocks := make(map[int]bool)
+	for key := range p.table {
+		if key.path == bf.path {
+			blocks[key.block] = true
+		}
+	}
+	return blocks
+}
+
+func checkCachedBlocks(t *testing.T, p *BufferPool, bf *blockFile, want ...int) {
+	t.Helper()
+	got := cachedBlocks(p, bf)
+	if len(got) != len(want) {
+		t.Fatalf("blocos no buffer pool: %v, esperados %v", got, want)
+	}
+	for _, blockNum := range want {
+		if !got[blockNum] {
+			t.Fatalf("blocos no buffer pool: %v, esperados %v", got, want)
+		}
+	}
+}
+
+func TestBufferPoolLRUEvictsLeastRecentlyUsed(t *testing.T) {
+	bf, _ := newPoolTestFile(t, 4)
+	defer bf.Close()
+	p := newBufferPool(3, ReplacementLRU)
+
+	touchBlock(t, p, bf, 0)
+	touchBlock(t, p, bf, 1)
+	touchBlock(t, p, bf, 2)
+	touchBlock(t, p, bf, 0)
+	touchBlock(t, p, bf, 3)
+	checkCachedBlocks(t, p, bf, 0, 2, 3)
+
+	if p.hits != 1 || p.misses != 4 || p.evictions != 1 {
+		t.Fatalf("%d acertos, %d faltas e %d substituições", p.hits, p.misses, p.evictions)
+	}
+}
+
+func TestBufferPoolClockGivesSecondChance(t *testing.T) {
+	bf, _ := newPoolTestFile(t, 5)
+	defer bf.Close()
+	p := newBufferPool(3, ReplacementClock)
+
+	// Todos os quadros estão referenciados: o ponteiro zera os bits de uma volta inteira e
+	// substitui o primeiro quadro, mesmo que o bloco 0 tenha sido usado por último (o LRU
+	// substituiria o bloco 1)
+	touchBlock(t, p, bf, 0)
+	touchBlock(t, p, bf, 1)
+	touchBlock(t, p, bf, 2)
+	touchBlock(t, p, bf, 0)
+	touchBlock(t, p, bf, 3)
+	checkCachedBlocks(t, p, bf, 1, 2, 3)
+
+	// O bloco 1 volta a ser referenciado e ganha uma segunda chance; o 2 é substituído
+	touchBlock(t, p, bf, 1)
+	touchBlock(t, p, bf, 4)
+	checkCachedBlocks(t, p, bf, 1, 3, 4)
+}
+
+func TestBufferPoolRefusesWhenAllFramesArePinned(t *testing.T) {
+	for _, policy := range ReplacementPolicies {
+		bf, _ := newPoolTestFile(t, 3)
+		p := newBufferPool(2, policy)
+
+		first, err := p.pin(bf, 0, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		second, err := p.pin(bf, 1, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := p.pin(bf, 2, true); err == nil {
+			t.Fatalf("%s: quadro fixado substituído", policy)
+		}
+
+		p.unpin(second, bf, false)
+		touchBlock(t, p, bf, 2)
+		checkCachedBlocks(t, p, bf, 0, 2)
+		p.unpin(first, bf, false)
+		bf.Close()
+	}
+}
+
+func TestBufferPoolWritesBackDirtyFrameOnEviction(t *testing.T) {
+	bf, filename := newPoolTestFile(t, 2)
+	defer bf.Close()
+	p := newBufferPool(1, ReplacementLRU)
+
+	frame, err := p.pin(bf, 0, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	copy(frame.data, "alterado")
+	p.unpin(frame, bf, true)
+
+	if bytes.HasPrefix(diskBlock(t, filename, 0), []byte("alterado")) {
+		t.Fatal("quadro sujo gravado antes da substituição")
+	}
+	touchBlock(t, p, bf, 1)
+	if !bytes.HasPrefix(diskBlock(t, filename, 0), []byte("alterado")) {
+		t.Fatal("quadro sujo substituído sem ser gravado")
+	}
+	if p.writeBacks != 1 {
+		t.Fatalf("%d gravações de quadros sujos, esperada 1", p.writeBacks)
+	}
+
+	// Ao voltar para o pool, o bloco é lido de novo do disco com a alteração
+	frame, err = p.pin(bf, 0, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(frame.data, []byte("alterado")) {
+		t.Fatal("bloco relido sem a alteração")
+	}
+	p.unpin(frame, bf, false)
+}
+
+func TestBlockFileCloseWritesBackDirtyFrames(t *testing.T) {
+	created, filename := newPoolTestFile(t, 2)
+	if err := created.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	bf, err := openBlockFile(filename, ModeFixed, poolTestBlockSize, true, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := bf.writeBlock(1, []byte("alterado")); err != nil {
+		t.Fatal(err)
+	}
+	if bytes.HasPrefix(diskBlock(t, filename, 1), []byte("alterado")) {
+		t.Fatal("bloco gravado antes do fechamento")
+	}
+	if err := bf.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(diskBlock(t, filename, 1), []byte("alterado")) {
+		t.Fatal("bloco sujo não gravado no fechamento")
+	}
+	if !cachedBlocks(bufferPool, bf)[1] {
+		t.Fatal("o bloco gravado deveria continuar no buffer pool, limpo")
+	}
+	header, err := ReadFileHeader(filename)
+	if err != nil || header.Generation != 2 {
+		t.Fatalf("geração %d após a segunda abertura que altera o arquivo: %v", header.Generation, err)
+	}
+}
+
+func TestCloseBlockFileReportsWriteBackFailure(t *testing.T) {
+	created, filename := newPoolTestFile(t, 1)
+	if err := created.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	bf, err := openBlockFile(filename, ModeFixed, poolTestBlockSize, true, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer bufferPool.discard(bf.path, 0)
+	if err := bf.writeBlock(0, []byte("alterado")); err != nil {
+		t.Fatal(err)
+	}
+
+	// Com o arquivo já fechado por baixo, a gravação do quadro sujo falha no fechamento
+	bf.file.Close()
+	err = nil
+	closeBlockFile(bf, &err)
+	if err == nil {
+		t.Fatal("falha ao gravar o quadro sujo não devolvida")
+	}
+}
+
+func TestConfigureBufferPoolWritesBackDirtyFrames(t *testing.T) {
+	t.Cleanup(func() {
+		if err := ConfigureBufferPool(DefaultBufferFrames, ReplacementLRU); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	created, filename := newPoolTestFile(t, 3)
+	if err := created.Close(); err != nil {
+		t.Fatal(err)
+	}
+	bf, err := openBlockFile(filename, ModeFixed, poolTestBlockSize, true, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer bf.Close()
+
+	for blockNum := 0; blockNum < 3; blockNum++ {
+		if err := bf.writeBlock(blockNum, []byte("alterado")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if stats := GetBufferPoolStats(); stats.Dirty < 3 {
+		t.Fatalf("%d quadros sujos, esperados pelo menos 3", stats.Dirty)
+	}
+
+	// Um quadro fixado impede a troca do pool
+	frame, err := bufferPool.pin(bf, 0, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ConfigureBufferPool(8, ReplacementClock); err == nil {
+		t.Fatal("buffer pool trocado com um quadro fixado")
+	}
+	bufferPool.unpin(frame, bf, false)
+
+	if err := ConfigureBufferPool(8, ReplacementClock); err != nil {
+		t.Fatal(err)
+	}
+	for blockNum := 0; blockNum < 3; blockNum++ {
+		if !bytes.HasPrefix(diskBlock(t, filename, blockNum), []byte("alterado")) {
+			t.Fatalf("bloco %d sujo descartado na troca do buffer pool", blockNum)
+		}
+	}
+	stats := GetBufferPoolStats()
+	if stats.Frames != 8 || stats.Policy != ReplacementClock || stats.Used != 0 || stats.Dirty != 0 {
+		t.Fatalf("buffer pool após a troca: %+v", stats)
+	}
+
+	if _, err := bf.readBlock(2); err != nil {
+		t.Fatal(err)
+	}
+	if stats := GetBufferPoolStats(); stats.Misses != 1 || stats.Used != 1 {
+		t.Fatalf("leitura após a troca: %+v", stats)
+	}
+}
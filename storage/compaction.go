@@ -0,0 +1,186 @@
+package storage
+
+import "fmt"
+
+// CompactionOptions controla uma passada de compactação incremental. Com MaxBlocks > 0
+// apenas essa quantidade de blocos é processada, permitindo desfragmentar um arquivo
+// grande em várias passadas a partir de CompactionReport.NextBlock
+type CompactionOptions struct {
+	StartBlock  int
+	MaxBlocks   int
+	MergeBlocks bool
+	MergeBelow  float64
+}
+
+type CompactionReport struct {
+	BlocksVisited      int
+	BlocksCompacted    int
+	BlocksMerged       int
+	RecordsMoved       int
+	DeadBytesReclaimed int
+	BlocksTruncated    int
+	NextBlock          int
+	Done               bool
+	// Moves lista os registros que mudaram de bloco ao serem fundidos
+	Moves []RecordMove
+}
+
+// RecordMove é a mudança de RecordID de um registro movido por CompactBlocks
+type RecordMove struct {
+	From RecordID
+	To   RecordID
+}
+
+// DefaultMergeBelow é a ocupação (%) abaixo da qual um bloco é fundido ao bloco anterior
+const DefaultMergeBelow = 50.0
+
+// CompactBlocks desfragmenta o arquivo no próprio lugar, bloco a bloco: remove o espaço de
+// registros removidos de cada página (mantendo os RecordIDs) e, com MergeBlocks, move os
+// registros de um bloco pouco ocupado para o último bloco não vazio quando todos couberem. Blocos
+// vazios no fim do arquivo são descartados. Registros movidos entre blocos recebem novo
+// RecordID, listado em CompactionReport.Moves
+func (vs *VariableStorage) CompactBlocks(filename string, options CompactionOptions) (_ *CompactionReport, err error) {
+	bf, err := openBlockFile(filename, ModeVariable, vs.blockSize, true, false)
+	if err != nil {
+		return nil, err
+	}
+	defer closeBlockFile(bf, &err)
+
+	fsm := vs.loadFreeSpace(bf, filename)
+	totalBlocks := bf.totalBlocks()
+
+	if options.StartBlock < 0 || options.StartBlock > totalBlocks {
+		return nil, fmt.Errorf("bloco inicial %d fora do arquivo (%d blocos)", options.StartBlock, totalBlocks)
+	}
+	if options.MergeBelow <= 0 {
+		options.MergeBelow = DefaultMergeBelow
+	}
+
+	end := totalBlocks
+	if options.MaxBlocks > 0 && options.StartBlock+options.MaxBlocks < end {
+		end = options.StartBlock + options.MaxBlocks
+	}
+
+	report := &CompactionReport{NextBlock: end, Done: end == totalBlocks}
+
+	var previous *slottedPage
+	previousNum := -1
+	for blockNum := options.StartBlock; blockNum < end; blockNum++ {
+		block, err := bf.readBlock(blockNum)
+		if err != nil {
+			return nil, err
+		}
+		page := loadSlottedPage(block)
+		report.BlocksVisited++
+		if page.isOverflow() {
+			continue
+		}
+
+		changed := false
+		if dead := page.deadBytes(); dead > 0 {
+			page.compact()
+			report.BlocksCompacted++
+			report.DeadBytesReclaimed += dead
+			changed = true
+		}
+
+		if options.MergeBlocks && previous != nil && page.slotCount() > 0 &&
+			vs.pageStats(blockNum, page).OccupancyRate < options.MergeBelow {
+			if moves := vs.mergeInto(previous, previousNum, page, blockNum); len(moves) > 0 {
+				if err := bf.writeBlock(previousNum, previous.data); err != nil {
+					return nil, err
+				}
+				fsm.set(previousNum, previous.freeSpace())
+				vs.filters.set(previousNum, vs.pageKeys(previous))
+				report.BlocksMerged++
+				report.RecordsMoved += len(moves)
+				report.Moves = append(report.Moves, moves...)
+				changed = true
+			}
+		}
+
+		if changed {
+			if err := bf.writeBlock(blockNum, page.data); err != nil {
+				return nil, err
+			}
+			fsm.set(blockNum, page.freeSpace())
+			vs.filters.set(blockNum, vs.pageKeys(page))
+		}
+
+		if page.slotCount() > 0 {
+			previous, previousNum = page, blockNum
+		}
+	}
+
+	if report.Done {
+		if err := vs.truncateEmptyBlocks(bf, fsm, report); err != nil {
+			return nil, err
+		}
+	}
+
+	vs.recalculateStatsFromFile(filename)
+	return report, vs.saveFreeSpace(bf)
+}
+
+// mergeInto move todos os registros de source para target, ou nenhum se não couberem;
+// devolve os RecordIDs antigo e novo de cada registro movido
+func (vs *VariableStorage) mergeInto(target *slottedPage, targetNum int, source *slottedPage, sourceNum int) []RecordMove {
+	merged := &slottedPage{data: append([]byte(nil), target.data...)}
+
+	var moves []RecordMove
+	for slot := 0; slot < source.slotCount(); slot++ {
+		record := source.record(slot)
+		if record == nil {
+			continue
+		}
+		newSlot := merged.insert(record)
+		if newSlot < 0 {
+			return nil
+		}
+		moves = append(moves, RecordMove{
+			From: RecordID{Block: sourceNum, Slot: slot},
+			To:   RecordID{Block: targetNum, Slot: newSlot},
+		})
+	}
+
+	copy(target.data, merged.data)
+	for slot := source.slotCount() - 1; slot >= 0; slot-- {
+		source.remove(slot)
+	}
+	source.compact()
+	return moves
+}
+
+func (vs *VariableStorage) truncateEmptyBlocks(bf *blockFile, fsm *freeSpaceMap, report *CompactionReport) error {
+	totalBlocks := bf.totalBlocks()
+	keep := totalBlocks
+	for keep > 0 {
+		block, err := bf.readBlock(keep - 1)
+		if err != nil {
+			return err
+		}
+		if page := loadSlottedPage(block); page.slotCount() > 0 || page.isOverflow() {
+			break
+		}
+		keep--
+	}
+
+	if keep == totalBlocks {
+		return nil
+	}
+	if err := bf.truncate(keep); err != nil {
+		return fmt.Errorf("erro ao truncar arquivo: %w", err)
+	}
+
+	free := make([]int, keep)
+	for blockNum := range free {
+		free[blockNum] = fsm.get(blockNum)
+	}
+	fsm.rebuild(free)
+	vs.filters.resize(keep)
+	if vs.nextFitCursor >= keep {
+		vs.nextFitCursor = 0
+	}
+	report.BlocksTruncated = totalBlocks - keep
+	return nil
+}
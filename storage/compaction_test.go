@@ -0,0 +1,93 @@
+package storage
+
+import (
+	"aeds2-tp1/domain"
+	"path/filepath"
+	"testing"
+)
+
+func checkIndexesConsistent(t *testing.T, s *IndexedStorage, filename string, records int) {
+	t.Helper()
+	verification, err := s.VerifyIndexes(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if verification.Records != records {
+		t.Fatalf("verificação com %d registros, esperados %d", verification.Records, records)
+	}
+	for _, check := range verification.Checks {
+		if !check.Consistent() {
+			t.Fatalf("índice %s: %s, %d órfãs, %d faltando", check.Name, check.Status, len(check.Orphans), len(check.Missing))
+		}
+	}
+}
+
+func TestIndexedCompactBlocksRemapsMovedRecords(t *testing.T) {
+	vs, err := NewVariableStorage(512)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewIndexedStorage(vs)
+	filename := filepath.Join(t.TempDir(), "alunos.dat")
+	students := domain.NewStudentGenerator().Generate(300)
+	if err := s.WriteStudents(filename, students); err != nil {
+		t.Fatal(err)
+	}
+
+	// Três de cada quatro alunos removidos deixam todos os blocos abaixo de 50%
+	live := 0
+	for i, student := range students {
+		if i%4 != 0 {
+			if err := s.DeleteStudent(filename, student.Matricula); err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+		live++
+	}
+	checkIndexesConsistent(t, s, filename, live)
+
+	blocks := fileBlocks(t, filename, 512)
+	options := CompactionOptions{MaxBlocks: blocks / 2, MergeBlocks: true}
+	moved := 0
+	for passes := 0; ; passes++ {
+		report, err := s.CompactBlocks(filename, options)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if report.RecordsMoved != len(report.Moves) {
+			t.Fatalf("%d registros movidos, %d mudanças de RecordID", report.RecordsMoved, len(report.Moves))
+		}
+		moved += report.RecordsMoved
+
+		// Cada passada parcial deixa os índices atualizados, sem reconstrução
+		checkIndexesConsistent(t, s, filename, live)
+		if report.Done {
+			break
+		}
+		if passes > 1 {
+			t.Fatal("compactação em partes não terminou em duas passadas")
+		}
+		options.StartBlock = report.NextBlock
+	}
+	if moved == 0 {
+		t.Fatal("nenhum registro movido entre blocos")
+	}
+
+	for i, student := range students {
+		got, err := s.FindStudentByMatricula(filename, student.Matricula)
+		if i%4 != 0 {
+			if err == nil {
+				t.Fatalf("matrícula removida %d encontrada", student.Matricula)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkSameStudent(t, got, student)
+		if byCPF, err := s.FindStudentByCPF(filename, student.CPF); err != nil || byCPF.Matricula != student.Matricula {
+			t.Fatalf("FindStudentByCPF(%s): %v", student.CPF, err)
+		}
+	}
+}
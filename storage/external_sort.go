@@ -0,0 +1,445 @@
+package storage
+
+import (
+	"aeds2-tp1/entity"
+	"container/heap"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// SortField é a chave de ordenação da ordenação externa
+type SortField int
+
+const (
+	SortByMatricula SortField = iota + 1
+	SortByNome
+	SortByCADesc
+	SortByCursoNome
+)
+
+var SortFields = []SortField{SortByMatricula, SortByNome, SortByCADesc, SortByCursoNome}
+
+func (f SortField) String() string {
+	switch f {
+	case SortByMatricula:
+		return "matrícula"
+	case SortByNome:
+		return "nome"
+	case SortByCADesc:
+		return "CA (decrescente)"
+	case SortByCursoNome:
+		return "curso e nome"
+	}
+	return fmt.Sprintf("campo desconhecido (%d)", int(f))
+}
+
+// suffix identifica o campo no nome do arquivo de saída
+func (f SortField) suffix() string {
+	switch f {
+	case SortByMatricula:
+		return "matricula"
+	case SortByNome:
+		return "nome"
+	case SortByCADesc:
+		return "ca"
+	case SortByCursoNome:
+		return "curso"
+	}
+	return fmt.Sprintf("campo%d", int(f))
+}
+
+// less ordena pelo campo e, nos empates, pela matrícula, para que o resultado não dependa
+// da ordem física. Nomes e cursos são comparados sem diferenciar maiúsculas
+func (f SortField) less(a, b *entity.Student) bool {
+	switch f {
+	case SortByNome:
+		if x, y := strings.ToLower(a.Nome), strings.ToLower(b.Nome); x != y {
+			return x < y
+		}
+	case SortByCADesc:
+		if x, y := caCents(a.CA), caCents(b.CA); x != y {
+			return x > y
+		}
+	case SortByCursoNome:
+		if x, y := cursoKey(a.Curso), cursoKey(b.Curso); x != y {
+			return x < y
+		}
+		if x, y := strings.ToLower(a.Nome), strings.ToLower(b.Nome); x != y {
+			return x < y
+		}
+	}
+	return a.Matricula < b.Matricula
+}
+
+// MinSortMemoryBlocks é o menor orçamento de memória: dois blocos de entrada na
+// intercalação e um de saída
+const MinSortMemoryBlocks = 3
+
+type ExternalSortReport struct {
+	Field        SortField
+	MemoryBlocks int
+	Records      int
+	Runs         int
+	Passes       int
+	BlockReads   int64
+	BlockWrites  int64
+	OutputBlocks int
+	Output       string
+}
+
+// BlockIOs é o total de blocos lidos e gravados, incluindo a leitura do arquivo de origem
+func (r *ExternalSortReport) BlockIOs() int64 {
+	return r.BlockReads + r.BlockWrites
+}
+
+// SortOutputFilename é o arquivo gravado por ExternalSort para o campo (ex.: alunos_por_nome.dat)
+func SortOutputFilename(filename string, field SortField) string {
+	return companionFilename(filename, "_por_"+field.suffix()+".dat")
+}
+
+// externalSorter grava sequências e o arquivo final no formato do armazenamento de tamanho
+// fixo, que tem a mesma quantidade de registros em todos os blocos
+type externalSorter struct {
+	codec  *FixedStorage
+	field  SortField
+	dir    string
+	report *ExternalSortReport
+}
+
+// ExternalSort ordena o arquivo de dados por field com uma intercalação de k caminhos,
+// mantendo em memória no máximo memoryBlocks blocos de registros (no formato de tamanho fixo).
+// A primeira fase lê o arquivo e grava sequências ordenadas de memoryBlocks blocos em
+// arquivos temporários; cada passada intercala até memoryBlocks-1 sequências, com um bloco
+// de cada uma e um bloco de saída, até restar o arquivo output, no modo de tamanho fixo.
+// Se todos os registros couberem na memória, o arquivo é gravado sem passadas de intercalação
+func ExternalSort(source Storage, filename string, output string, field SortField, memoryBlocks int) (*ExternalSortReport, error) {
+	if field < SortByMatricula || field > SortByCursoNome {
+		return nil, fmt.Errorf("campo de ordenação inválido: %d", int(field))
+	}
+	if memoryBlocks < MinSortMemoryBlocks {
+		return nil, fmt.Errorf("a ordenação externa precisa de pelo menos %d blocos de memória", MinSortMemoryBlocks)
+	}
+	if filepath.Clean(output) == filepath.Clean(filename) {
+		return nil, fmt.Errorf("o arquivo ordenado deve ser diferente do arquivo de dados")
+	}
+
+	codec, err := NewFixedStorage(source.GetBlockSize())
+	if err != nil {
+		return nil, fmt.Errorf("ordenação externa: %w", err)
+	}
+
+	dir, err := os.MkdirTemp(filepath.Dir(output), "ordenacao")
+	if err != nil {
+		return nil, fmt.Errorf("erro ao criar diretório temporário: %w", err)
+	}
+	defer os.RemoveAll(dir)
+
+	sorter := &externalSorter{
+		codec: codec,
+		field: field,
+		dir:   dir,
+		report: &ExternalSortReport{
+			Field:        field,
+			MemoryBlocks: memoryBlocks,
+			Output:       output,
+		},
+	}
+
+	readsBefore := blockReads.Load()
+	err = sorter.sort(source, filename, output, memoryBlocks)
+	sorter.report.BlockReads = blockReads.Load() - readsBefore
+	if err != nil {
+		os.Remove(output)
+		invalidateCachedBlocks(output)
+		return nil, err
+	}
+	return sorter.report, nil
+}
+
+func (s *externalSorter) sort(source Storage, filename string, output string, memoryBlocks int) error {
+	runs, err := s.formRuns(source, filename, output, memoryBlocks*(s.codec.blockSize/s.codec.fixedRecordSize))
+	if err != nil || runs == nil {
+		return err
+	}
+
+	fanIn := memoryBlocks - 1
+	for len(runs) > fanIn {
+		s.report.Passes++
+		var next []string
+		for start := 0; start < len(runs); start += fanIn {
+			end := min(start+fanIn, len(runs))
+			run := s.runFilename(s.report.Passes, len(next))
+			if err := s.merge(runs[start:end], run); err != nil {
+				return err
+			}
+			next = append(next, run)
+		}
+		runs = next
+	}
+
+	s.report.Passes++
+	return s.merge(runs, output)
+}
+
+// sortEntry é um registro já serializado no formato de tamanho fixo. A comparação usa o
+// aluno decodificado desses bytes, e as passadas copiam os bytes sem serializá-los de novo,
+// para que o CA gravado (truncado em centésimos) não mude entre as passadas
+type sortEntry struct {
+	student *entity.Student
+	record  []byte
+}
+
+// formRuns grava as sequências iniciais. Quando o arquivo inteiro cabe na memória, grava
+// direto o arquivo de saída e devolve nil
+func (s *externalSorter) formRuns(source Storage, filename string, output string, capacity int) ([]string, error) {
+	buffer := make([]sortEntry, 0, capacity)
+	var runs []string
+	var writeErr error
+
+	flush := func(target string) error {
+		sort.Slice(buffer, func(i, j int) bool { return s.field.less(buffer[i].student, buffer[j].student) })
+		writer, err := s.createRun(target)
+		if err != nil {
+			return err
+		}
+		for _, entry := range buffer {
+			if err := writer.write(entry.record); err != nil {
+				writer.close()
+				return err
+			}
+		}
+		buffer = buffer[:0]
+		return writer.close()
+	}
+
+	err := source.ScanStudents(filename, func(_ RecordID, student *entity.Student) bool {
+		s.report.Records++
+		record := s.codec.serializeStudentFixed(*student)
+		stored, err := s.codec.deserializeStudentFixed(record)
+		if err != nil {
+			writeErr = err
+			return false
+		}
+		buffer = append(buffer, sortEntry{student: stored, record: record})
+		if len(buffer) < capacity {
+			return true
+		}
+		run := s.runFilename(0, len(runs))
+		if writeErr = flush(run); writeErr != nil {
+			return false
+		}
+		runs = append(runs, run)
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	if writeErr != nil {
+		return nil, writeErr
+	}
+
+	if len(runs) == 0 {
+		if s.report.Records > 0 {
+			s.report.Runs = 1
+		}
+		return nil, flush(output)
+	}
+	if len(runs) == 1 && len(buffer) == 0 {
+		s.report.Runs = 1
+		invalidateCachedBlocks(output)
+		invalidateCachedBlocks(runs[0])
+		return nil, os.Rename(runs[0], output)
+	}
+	if len(buffer) > 0 {
+		run := s.runFilename(0, len(runs))
+		if err := flush(run); err != nil {
+			return nil, err
+		}
+		runs = append(runs, run)
+	}
+	s.report.Runs = len(runs)
+	return runs, nil
+}
+
+func (s *externalSorter) runFilename(pass int, index int) string {
+	return filepath.Join(s.dir, fmt.Sprintf("passada%d_seq%d.dat", pass, index))
+}
+
+// merge intercala as sequências em target e remove os arquivos das sequências
+func (s *externalSorter) merge(runs []string, target string) error {
+	readers := &runHeap{less: s.field.less}
+	defer func() {
+		for _, reader := range readers.readers {
+			reader.bf.Close()
+		}
+	}()
+
+	for _, run := range runs {
+		reader, err := s.openRun(run)
+		if err != nil {
+			return err
+		}
+		if err := reader.next(); err != nil {
+			reader.bf.Close()
+			return err
+		}
+		if reader.current == nil {
+			reader.bf.Close()
+			continue
+		}
+		readers.readers = append(readers.readers, reader)
+	}
+	heap.Init(readers)
+
+	writer, err := s.createRun(target)
+	if err != nil {
+		return err
+	}
+	for readers.Len() > 0 {
+		reader := readers.readers[0]
+		if err := writer.write(reader.record); err != nil {
+			writer.close()
+			return err
+		}
+		if err := reader.next(); err != nil {
+			writer.close()
+			return err
+		}
+		if reader.current == nil {
+			heap.Pop(readers)
+			reader.bf.Close()
+		} else {
+			heap.Fix(readers, 0)
+		}
+	}
+	if err := writer.close(); err != nil {
+		return err
+	}
+
+	for _, run := range runs {
+		os.Remove(run)
+		invalidateCachedBlocks(run)
+	}
+	return nil
+}
+
+// runReader percorre uma sequência mantendo apenas o bloco corrente em memória
+type runReader struct {
+	codec       *FixedStorage
+	bf          *blockFile
+	block       []byte
+	blockNum    int
+	totalBlocks int
+	offset      int
+	current     *entity.Student
+	record      []byte
+}
+
+func (s *externalSorter) openRun(filename string) (*runReader, error) {
+	bf, err := openBlockFile(filename, ModeFixed, s.codec.blockSize, false, false)
+	if err != nil {
+		return nil, err
+	}
+	return &runReader{codec: s.codec, bf: bf, blockNum: -1, totalBlocks: bf.totalBlocks()}, nil
+}
+
+// next avança para o próximo registro ativo; no fim da sequência, current fica nil
+func (r *runReader) next() error {
+	recordSize := r.codec.fixedRecordSize
+	for {
+		if r.block == nil || r.offset+recordSize > len(r.block) {
+			if r.blockNum+1 >= r.totalBlocks {
+				r.current = nil
+				return nil
+			}
+			r.blockNum++
+			block, err := r.bf.readBlock(r.blockNum)
+			if err != nil {
+				return fmt.Errorf("erro ao ler sequência: %w", err)
+			}
+			r.block, r.offset = block, 0
+		}
+
+		slot := r.block[r.offset : r.offset+recordSize]
+		r.offset += recordSize
+		if !r.codec.isActiveSlot(slot) {
+			continue
+		}
+		student, err := r.codec.deserializeStudentFixed(slot)
+		if err != nil {
+			return err
+		}
+		r.current, r.record = student, slot
+		return nil
+	}
+}
+
+type runHeap struct {
+	readers []*runReader
+	less    func(a, b *entity.Student) bool
+}
+
+func (h *runHeap) Len() int { return len(h.readers) }
+func (h *runHeap) Less(i, j int) bool {
+	return h.less(h.readers[i].current, h.readers[j].current)
+}
+func (h *runHeap) Swap(i, j int) { h.readers[i], h.readers[j] = h.readers[j], h.readers[i] }
+func (h *runHeap) Push(x any)    { h.readers = append(h.readers, x.(*runReader)) }
+func (h *runHeap) Pop() any {
+	last := h.readers[len(h.readers)-1]
+	h.readers = h.readers[:len(h.readers)-1]
+	return last
+}
+
+// runWriter grava registros em um arquivo de tamanho fixo acumulando um bloco por vez
+type runWriter struct {
+	sorter  *externalSorter
+	bf      *blockFile
+	block   []byte
+	records int
+}
+
+func (s *externalSorter) createRun(filename string) (*runWriter, error) {
+	bf, err := createBlockFile(filename, ModeFixed, s.codec.blockSize)
+	if err != nil {
+		return nil, err
+	}
+	return &runWriter{sorter: s, bf: bf, block: make([]byte, 0, s.codec.blockSize)}, nil
+}
+
+func (w *runWriter) write(record []byte) error {
+	if len(w.block)+len(record) > cap(w.block) {
+		if err := w.flush(); err != nil {
+			return err
+		}
+	}
+	w.block = append(w.block, record...)
+	w.records++
+	return nil
+}
+
+func (w *runWriter) flush() error {
+	if err := w.bf.appendBlock(w.block); err != nil {
+		return fmt.Errorf("erro ao gravar bloco: %w", err)
+	}
+	w.sorter.report.BlockWrites++
+	if w.sorter.report.Output == w.bf.file.Name() {
+		w.sorter.report.OutputBlocks++
+	}
+	w.block = w.block[:0]
+	return nil
+}
+
+func (w *runWriter) close() error {
+	if len(w.block) > 0 {
+		if err := w.flush(); err != nil {
+			w.bf.Close()
+			return err
+		}
+	}
+	w.bf.addRecordCount(w.records)
+	return w.bf.Close()
+}
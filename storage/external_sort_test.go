@@ -0,0 +1,150 @@
+package storage
+
+import (
+	"aeds2-tp1/domain"
+	"aeds2-tp1/entity"
+	"path/filepath"
+	"testing"
+)
+
+// externalSortSource grava os alunos em ordem decrescente de matrícula, para que a ordem
+// física não coincida com o desempate por matrícula, e dá o mesmo CA a metade deles
+func externalSortSource(t *testing.T, count int) (*FixedStorage, string) {
+	t.Helper()
+	students := domain.NewStudentGenerator().Generate(count)
+	for i, j := 0, len(students)-1; i < j; i, j = i+1, j-1 {
+		students[i], students[j] = students[j], students[i]
+	}
+	for i := range students {
+		if i%2 == 0 {
+			students[i].CA = 7.5
+		}
+	}
+
+	fs, err := NewFixedStorage(1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	filename := filepath.Join(t.TempDir(), "alunos.dat")
+	if err := fs.WriteStudents(filename, students); err != nil {
+		t.Fatal(err)
+	}
+	return fs, filename
+}
+
+// expectedPasses repete a conta das passadas de intercalação com memoryBlocks-1 caminhos
+func expectedPasses(runs int, memoryBlocks int) int {
+	if runs <= 1 {
+		return 0
+	}
+	passes := 1
+	for fanIn := memoryBlocks - 1; runs > fanIn; runs = (runs + fanIn - 1) / fanIn {
+		passes++
+	}
+	return passes
+}
+
+func readSortedOutput(t *testing.T, output string) []*entity.Student {
+	t.Helper()
+	fs, err := NewFixedStorage(1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var students []*entity.Student
+	err = fs.ScanStudents(output, func(_ RecordID, student *entity.Student) bool {
+		students = append(students, student)
+		return true
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return students
+}
+
+func TestExternalSortOrdersEveryField(t *testing.T) {
+	codec, err := NewFixedStorage(1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	recordsPerBlock := codec.blockSize / codec.fixedRecordSize
+	capacity := MinSortMemoryBlocks * recordsPerBlock
+
+	cases := []struct {
+		name         string
+		records      int
+		memoryBlocks int
+	}{
+		{"uma sequência em memória", capacity - 1, MinSortMemoryBlocks},
+		{"uma sequência renomeada", capacity, MinSortMemoryBlocks},
+		{"várias passadas", 5*capacity + 1, MinSortMemoryBlocks},
+		{"uma passada", 5*capacity + 1, 8},
+	}
+
+	for _, tc := range cases {
+		source, filename := externalSortSource(t, tc.records+1)
+		// O registro removido não pode aparecer no arquivo ordenado
+		all, err := source.GetAllStudents(filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := source.DeleteStudent(filename, all[0].Matricula); err != nil {
+			t.Fatal(err)
+		}
+
+		runCapacity := tc.memoryBlocks * recordsPerBlock
+		runs := (tc.records + runCapacity - 1) / runCapacity
+		for _, field := range SortFields {
+			output := SortOutputFilename(filename, field)
+			report, err := ExternalSort(source, filename, output, field, tc.memoryBlocks)
+			if err != nil {
+				t.Fatalf("%s, %s: %v", tc.name, field, err)
+			}
+			if report.Records != tc.records || report.Runs != runs || report.Passes != expectedPasses(runs, tc.memoryBlocks) {
+				t.Fatalf("%s, %s: %d registros, %d sequências, %d passadas (esperados %d, %d, %d)",
+					tc.name, field, report.Records, report.Runs, report.Passes, tc.records, runs, expectedPasses(runs, tc.memoryBlocks))
+			}
+
+			got := readSortedOutput(t, output)
+			if len(got) != tc.records {
+				t.Fatalf("%s, %s: arquivo ordenado com %d alunos, esperados %d", tc.name, field, len(got), tc.records)
+			}
+			for i := 1; i < len(got); i++ {
+				// less desempata pela matrícula, então a ordem esperada é estrita
+				if !field.less(got[i-1], got[i]) {
+					t.Fatalf("%s, %s: alunos fora de ordem na posição %d: %d, %d", tc.name, field, i, got[i-1].Matricula, got[i].Matricula)
+				}
+			}
+
+			header, err := ReadFileHeader(output)
+			if err != nil || header.Mode != ModeFixed || header.RecordCount != tc.records {
+				t.Fatalf("%s, %s: cabeçalho do arquivo ordenado %+v, %v", tc.name, field, header, err)
+			}
+			if leftovers, _ := filepath.Glob(filepath.Join(filepath.Dir(filename), "ordenacao*")); len(leftovers) != 0 {
+				t.Fatalf("%s, %s: arquivos temporários esquecidos: %v", tc.name, field, leftovers)
+			}
+		}
+	}
+}
+
+func TestExternalSortBreaksTiesByMatricula(t *testing.T) {
+	source, filename := externalSortSource(t, 200)
+	output := SortOutputFilename(filename, SortByCADesc)
+	if _, err := ExternalSort(source, filename, output, SortByCADesc, MinSortMemoryBlocks); err != nil {
+		t.Fatal(err)
+	}
+
+	ties := 0
+	got := readSortedOutput(t, output)
+	for i := 1; i < len(got); i++ {
+		if caCents(got[i-1].CA) != caCents(got[i].CA) {
+			continue
+		}
+		ties++
+		if got[i-1].Matricula >= got[i].Matricula {
+			t.Fatalf("empate de CA %.2f fora da ordem de matrícula: %d, %d", got[i].CA, got[i-1].Matricula, got[i].Matricula)
+		}
+	}
+	if ties < 99 {
+		t.Fatalf("apenas %d empates de CA no arquivo ordenado", ties)
+	}
+}
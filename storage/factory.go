@@ -0,0 +1,31 @@
+package storage
+
+import "fmt"
+
+func NewStorageForMode(mode StorageMode, blockSize int) (Storage, error) {
+	switch mode {
+	case ModeFixed:
+		return NewFixedStorage(blockSize)
+	case ModeVariable:
+		return NewVariableStorage(blockSize)
+	case ModeVariableFragmented:
+		return NewVariableFragmentedStorage(blockSize)
+	case ModeSorted:
+		return NewSortedStorage(blockSize)
+	}
+	return nil, fmt.Errorf("modo de armazenamento desconhecido: %d", mode)
+}
+
+// OpenStorage escolhe a implementação e o tamanho de bloco a partir do cabeçalho do arquivo
+func OpenStorage(filename string) (Storage, *FileHeader, error) {
+	header, err := ReadFileHeader(filename)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	storageImpl, err := NewStorageForMode(header.Mode, header.BlockSize)
+	if err != nil {
+		return nil, nil, err
+	}
+	return storageImpl, header, nil
+}
@@ -0,0 +1,39 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// temporaryFilename é onde Reorganize monta o arquivo compactado antes de substituir o original
+func temporaryFilename(filename string) string {
+	return companionFilename(filename, "_tmp.dat")
+}
+
+func backupFilename(filename string) string {
+	return companionFilename(filename, "_backup.dat")
+}
+
+// companionFilename devolve o nome de um arquivo auxiliar (ex.: alunos.dat -> alunos.fsm)
+func companionFilename(filename string, ext string) string {
+	return strings.TrimSuffix(filename, ".dat") + ext
+}
+
+// RemoveDataFile apaga o arquivo de dados junto com seus auxiliares (mapa de espaço livre,
+// filtros de Bloom e índices), para que um arquivo novo com o mesmo nome não herde auxiliares
+// de uma geração coincidente
+func RemoveDataFile(filename string) error {
+	if err := os.Remove(filename); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("erro ao remover arquivo: %w", err)
+	}
+	invalidateCachedBlocks(filename)
+
+	for _, ext := range append([]string{".fsm", bloomExtension}, indexExtensions...) {
+		if err := os.Remove(companionFilename(filename, ext)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("erro ao remover arquivo auxiliar: %w", err)
+		}
+	}
+	return nil
+}
@@ -4,13 +4,13 @@ import (
 	"aeds2-tp1/entity"
 	"encoding/binary"
 	"fmt"
-	"os"
 )
 
 type FixedStorage struct {
 	blockSize       int
 	fixedRecordSize int
 	stats           StorageStats
+	keepBackup      bool
 }
 
 func NewFixedStorage(blockSize int) (*FixedStorage, error) {
@@ -24,12 +24,13 @@ func NewFixedStorage(blockSize int) (*FixedStorage, error) {
 	if err := fs.ValidateBlockSize(blockSize); err != nil {
 		return nil, err
 	}
-	
+
+	fs.calculateFixedRecordSize()
 	return fs, nil
 }
 
 func (fs *FixedStorage) ValidateBlockSize(blockSize int) error {
-	minSize := 4 +
+	minSize := 1 + 4 +
 		entity.MaxNomeLength +
 		entity.CPFLength +
 		entity.MaxCursoLength +
@@ -46,7 +47,7 @@ func (fs *FixedStorage) ValidateBlockSize(blockSize int) error {
 }
 
 func (fs *FixedStorage) calculateFixedRecordSize() {
-	fs.fixedRecordSize = 4 +
+	fs.fixedRecordSize = 1 + 4 +
 		entity.MaxNomeLength +
 		entity.CPFLength +
 		entity.MaxCursoLength +
@@ -56,14 +57,16 @@ func (fs *FixedStorage) calculateFixedRecordSize() {
 		8
 }
 
-func (fs *FixedStorage) WriteStudents(filename string, students []entity.Student) error {
-	fs.calculateFixedRecordSize()
-	
-	file, err := os.Create(filename)
+func (fs *FixedStorage) WriteStudents(filename string, students []entity.Student) (err error) {
+	if err := checkBatchMatriculas(students); err != nil {
+		return err
+	}
+
+	bf, err := createBlockFile(filename, ModeFixed, fs.blockSize)
 	if err != nil {
-		return fmt.Errorf("erro ao criar arquivo: %w", err)
+		return err
 	}
-	defer file.Close()
+	defer closeBlockFile(bf, &err)
 
 	currentBlock := make([]byte, 0, fs.blockSize)
 	currentBlockNumber := 0
@@ -75,25 +78,31 @@ func (fs *FixedStorage) WriteStudents(filename string, students []entity.Student
 
 	for i, student := range students {
 		recordData := fs.serializeStudentFixed(student)
-		fs.writeContiguousRecord(&currentBlock, &currentBlockNumber, &blockStats, recordData, file, i == len(students)-1)
+		if err := fs.writeContiguousRecord(&currentBlock, &currentBlockNumber, &blockStats, recordData, bf, i == len(students)-1); err != nil {
+			return err
+		}
 	}
 
 	if len(currentBlock) > 0 {
 		blockStats.OccupancyRate = float64(blockStats.BytesUsed) / float64(blockStats.BytesTotal) * 100
 		fs.stats.BlockStatsList = append(fs.stats.BlockStatsList, blockStats)
-		fs.writeBlock(file, currentBlock)
+		if err := bf.appendBlock(currentBlock); err != nil {
+			return err
+		}
 		fs.stats.TotalBlocks++
 		fs.stats.TotalBytesUsed += blockStats.BytesUsed
 		fs.stats.TotalBytesTotal += blockStats.BytesTotal
 	}
 
+	bf.addRecordCount(len(students))
 	fs.calculateFinalStats()
 	return nil
 }
 
 func (fs *FixedStorage) serializeStudentFixed(student entity.Student) []byte {
 	data := make([]byte, 0, fs.fixedRecordSize)
-	
+	data = append(data, byte(StatusActive))
+
 	matriculaBytes := make([]byte, 4)
 	binary.LittleEndian.PutUint32(matriculaBytes, uint32(student.Matricula))
 	data = append(data, matriculaBytes...)
@@ -162,13 +171,13 @@ func (fs *FixedStorage) serializeStudentFixed(student entity.Student) []byte {
 	data = append(data, anoBytes...)
 	
 	caBytes := make([]byte, 8)
-	binary.LittleEndian.PutUint64(caBytes, uint64(student.CA*100))
+	binary.LittleEndian.PutUint64(caBytes, uint64(caCents(student.CA)))
 	data = append(data, caBytes...)
 	
 	return data
 }
 
-func (fs *FixedStorage) writeContiguousRecord(currentBlock *[]byte, currentBlockNumber *int, blockStats *BlockStats, recordData []byte, file *os.File, isLast bool) {
+func (fs *FixedStorage) writeContiguousRecord(currentBlock *[]byte, currentBlockNumber *int, blockStats *BlockStats, recordData []byte, bf *blockFile, isLast bool) error {
 	recordSize := len(recordData)
 	
 	if len(*currentBlock)+recordSize > fs.blockSize {
@@ -178,7 +187,9 @@ func (fs *FixedStorage) writeContiguousRecord(currentBlock *[]byte, currentBlock
 				fs.stats.PartialBlocks++
 			}
 			fs.stats.BlockStatsList = append(fs.stats.BlockStatsList, *blockStats)
-			fs.writeBlock(file, *currentBlock)
+			if err := bf.appendBlock(*currentBlock); err != nil {
+				return err
+			}
 			fs.stats.TotalBlocks++
 			fs.stats.TotalBytesUsed += blockStats.BytesUsed
 			fs.stats.TotalBytesTotal += blockStats.BytesTotal
@@ -196,12 +207,7 @@ func (fs *FixedStorage) writeContiguousRecord(currentBlock *[]byte, currentBlock
 	*currentBlock = append(*currentBlock, recordData...)
 	blockStats.BytesUsed += recordSize
 	blockStats.RecordsCount++
-}
-
-func (fs *FixedStorage) writeBlock(file *os.File, block []byte) {
-	paddedBlock := make([]byte, fs.blockSize)
-	copy(paddedBlock, block)
-	file.Write(paddedBlock)
+	return nil
 }
 
 func (fs *FixedStorage) calculateFinalStats() {
@@ -216,44 +222,35 @@ func (fs *FixedStorage) GetStats(filename string) StorageStats {
 }
 
 func (fs *FixedStorage) recalculateStatsFromFile(filename string) {
-	fileInfo, err := os.Stat(filename)
+	bf, err := openBlockFile(filename, ModeFixed, fs.blockSize, false, false)
 	if err != nil {
 		return
 	}
+	defer bf.Close()
 
-	totalBlocks := int(fileInfo.Size()) / fs.blockSize
+	totalBlocks := bf.totalBlocks()
 	fs.stats = StorageStats{
 		TotalBlocks:     totalBlocks,
 		TotalBytesTotal: totalBlocks * fs.blockSize,
 		BlockStatsList:  make([]BlockStats, 0),
 	}
 
-	file, err := os.Open(filename)
-	if err != nil {
-		return
-	}
-	defer file.Close()
-
 	totalUsed := 0
 	for blockNum := 0; blockNum < totalBlocks; blockNum++ {
-		block := make([]byte, fs.blockSize)
-		_, err := file.ReadAt(block, int64(blockNum*fs.blockSize))
+		block, err := bf.readBlock(blockNum)
 		if err != nil {
 			continue
 		}
 
 		recordsCount := 0
+		deletedCount := 0
 		offset := 0
 		for offset+fs.fixedRecordSize <= fs.blockSize {
-			if offset+4 > fs.blockSize {
-				break
-			}
-
-			matriculaBytes := block[offset : offset+4]
-			matricula := int(binary.LittleEndian.Uint32(matriculaBytes))
-			
-			if matricula > 0 {
+			slot := block[offset : offset+fs.fixedRecordSize]
+			if fs.isActiveSlot(slot) {
 				recordsCount++
+			} else if slot[0] == StatusDeleted {
+				deletedCount++
 			}
 
 			offset += fs.fixedRecordSize
@@ -269,7 +266,12 @@ func (fs *FixedStorage) recalculateStatsFromFile(filename string) {
 			BytesTotal:    fs.blockSize,
 			OccupancyRate: occupancyRate,
 			RecordsCount:  recordsCount,
+			LiveBytes:     bytesUsed,
+			DeadBytes:     deletedCount * fs.fixedRecordSize,
 		}
+		fs.stats.TotalLiveBytes += blockStats.LiveBytes
+		fs.stats.TotalDeadBytes += blockStats.DeadBytes
+		fs.stats.TotalTombstones += deletedCount
 
 		if occupancyRate < 100 && occupancyRate > 0 {
 			fs.stats.PartialBlocks++
@@ -284,41 +286,55 @@ func (fs *FixedStorage) recalculateStatsFromFile(filename string) {
 	}
 }
 
-func (fs *FixedStorage) FindStudentByMatricula(filename string, matricula int) (*entity.Student, error) {
-	file, err := os.Open(filename)
-	if err != nil {
-		return nil, fmt.Errorf("erro ao abrir arquivo: %w", err)
-	}
-	defer file.Close()
+// FindStudentByCPF percorre o arquivo; IndexedStorage usa o índice de CPF
+func (fs *FixedStorage) FindStudentByCPF(filename string, cpf string) (*entity.Student, error) {
+	return scanForCPF(fs, filename, cpf)
+}
+
+// FindStudentsByCurso percorre o arquivo; IndexedStorage usa o índice de curso
+func (fs *FixedStorage) FindStudentsByCurso(filename string, curso string) ([]*entity.Student, error) {
+	return scanStudentsWhere(fs, filename, sameCurso(curso))
+}
+
+// FindStudentsByAnoIngresso percorre o arquivo; IndexedStorage usa o índice de ano de ingresso
+func (fs *FixedStorage) FindStudentsByAnoIngresso(filename string, ano int) ([]*entity.Student, error) {
+	return scanStudentsWhere(fs, filename, sameAnoIngresso(ano))
+}
+
+// ScanStudentsByCA percorre o arquivo e entrega os alunos com CA entre min e max em ordem de CA
+func (fs *FixedStorage) ScanStudentsByCA(filename string, min float64, max float64, fn func(student *entity.Student) bool) error {
+	return scanByCA(fs, filename, min, max, fn)
+}
 
-	fileInfo, err := file.Stat()
+// ScanStudentsByAnoIngresso percorre o arquivo e entrega os alunos com ano de ingresso entre
+// min e max em ordem de ano
+func (fs *FixedStorage) ScanStudentsByAnoIngresso(filename string, min int, max int, fn func(student *entity.Student) bool) error {
+	return scanByAnoIngresso(fs, filename, min, max, fn)
+}
+
+func (fs *FixedStorage) FindStudentByMatricula(filename string, matricula int) (*entity.Student, error) {
+	bf, err := openBlockFile(filename, ModeFixed, fs.blockSize, false, false)
 	if err != nil {
-		return nil, fmt.Errorf("erro ao obter informações do arquivo: %w", err)
+		return nil, err
 	}
+	defer bf.Close()
 
-	totalBlocks := int(fileInfo.Size()) / fs.blockSize
-	return fs.findStudentFixed(file, totalBlocks, matricula)
+	totalBlocks := bf.totalBlocks()
+	return fs.findStudentFixed(bf, totalBlocks, matricula)
 }
 
-func (fs *FixedStorage) findStudentFixed(file *os.File, totalBlocks int, matricula int) (*entity.Student, error) {
+func (fs *FixedStorage) findStudentFixed(bf *blockFile, totalBlocks int, matricula int) (*entity.Student, error) {
 	for blockNum := 0; blockNum < totalBlocks; blockNum++ {
-		block := make([]byte, fs.blockSize)
-		_, err := file.ReadAt(block, int64(blockNum*fs.blockSize))
+		block, err := bf.readBlock(blockNum)
 		if err != nil {
 			continue
 		}
 
 		offset := 0
 		for offset+fs.fixedRecordSize <= fs.blockSize {
-			if offset+4 > fs.blockSize {
-				break
-			}
-
-			matriculaBytes := block[offset : offset+4]
-			readMatricula := int(binary.LittleEndian.Uint32(matriculaBytes))
-			
-			if readMatricula == matricula {
-				student, err := fs.deserializeStudentFixed(block[offset:offset+fs.fixedRecordSize])
+			slot := block[offset : offset+fs.fixedRecordSize]
+			if fs.isActiveSlot(slot) && fs.slotMatricula(slot) == matricula {
+				student, err := fs.deserializeStudentFixed(slot)
 				if err == nil {
 					return student, nil
 				}
@@ -336,7 +352,7 @@ func (fs *FixedStorage) deserializeStudentFixed(data []byte) (*entity.Student, e
 		return nil, fmt.Errorf("dados insuficientes")
 	}
 
-	offset := 0
+	offset := 1
 
 	matricula := int(binary.LittleEndian.Uint32(data[offset : offset+4]))
 	offset += 4
@@ -401,37 +417,35 @@ func (fs *FixedStorage) GetBlockSize() int {
 	return fs.blockSize
 }
 
-func (fs *FixedStorage) GetAllStudents(filename string) ([]*entity.Student, error) {
-	file, err := os.Open(filename)
-	if err != nil {
-		return nil, fmt.Errorf("erro ao abrir arquivo: %w", err)
-	}
-	defer file.Close()
+// SetReorganizeBackup define se Reorganize preserva o arquivo original em _backup.dat
+func (fs *FixedStorage) SetReorganizeBackup(keep bool) {
+	fs.keepBackup = keep
+}
 
-	fileInfo, err := file.Stat()
+func (fs *FixedStorage) GetAllStudents(filename string) ([]*entity.Student, error) {
+	bf, err := openBlockFile(filename, ModeFixed, fs.blockSize, false, false)
 	if err != nil {
-		return nil, fmt.Errorf("erro ao obter informações do arquivo: %w", err)
+		return nil, err
 	}
+	defer bf.Close()
 
-	totalBlocks := int(fileInfo.Size()) / fs.blockSize
+	totalBlocks := bf.totalBlocks()
 	students := make([]*entity.Student, 0)
 
 	for blockNum := 0; blockNum < totalBlocks; blockNum++ {
-		block := make([]byte, fs.blockSize)
-		_, err := file.ReadAt(block, int64(blockNum*fs.blockSize))
+		block, err := bf.readBlock(blockNum)
 		if err != nil {
 			continue
 		}
 
 		offset := 0
 		for offset+fs.fixedRecordSize <= fs.blockSize {
-			if offset+4 > fs.blockSize {
-				break
-			}
-
-			student, err := fs.deserializeStudentFixed(block[offset:offset+fs.fixedRecordSize])
-			if err == nil && student.Matricula > 0 {
-				students = append(students, student)
+			slot := block[offset : offset+fs.fixedRecordSize]
+			if fs.isActiveSlot(slot) {
+				student, err := fs.deserializeStudentFixed(slot)
+				if err == nil {
+					students = append(students, student)
+				}
 			}
 
 			offset += fs.fixedRecordSize
@@ -441,24 +455,302 @@ func (fs *FixedStorage) GetAllStudents(filename string) ([]*entity.Student, erro
 	return students, nil
 }
 
-func (fs *FixedStorage) AddStudents(filename string, students []entity.Student) error {
-	existingStudents, err := fs.GetAllStudents(filename)
+// AddStudents preenche os slots livres do último bloco e aloca blocos novos no final,
+// gravando apenas os blocos alterados
+func (fs *FixedStorage) AddStudents(filename string, students []entity.Student) (err error) {
+	if err := checkNewMatriculas(fs, filename, students); err != nil {
+		return err
+	}
+	_, err = fs.insertRecords(filename, students)
+	return err
+}
+
+// insertRecords grava o lote com uma única abertura do arquivo, sem verificar as matrículas
+func (fs *FixedStorage) insertRecords(filename string, students []entity.Student) (_ []RecordID, err error) {
+	bf, err := openBlockFile(filename, ModeFixed, fs.blockSize, true, true)
 	if err != nil {
-		return fmt.Errorf("erro ao ler alunos existentes: %w", err)
+		return nil, err
+	}
+	defer closeBlockFile(bf, &err)
+
+	return fs.appendStudents(bf, students)
+}
+
+// appendStudents grava os alunos nos slots livres do último bloco e em blocos novos,
+// devolvendo a posição de cada um
+func (fs *FixedStorage) appendStudents(bf *blockFile, students []entity.Student) ([]RecordID, error) {
+	totalBlocks := bf.totalBlocks()
+	blockNum := totalBlocks - 1
+	block := make([]byte, fs.blockSize)
+	offset := fs.blockSize
+
+	if blockNum >= 0 {
+		var err error
+		block, err = bf.readBlock(blockNum)
+		if err != nil {
+			return nil, fmt.Errorf("erro ao ler último bloco: %w", err)
+		}
+		offset = fs.nextFreeSlot(block, 0)
+	}
+
+	rids := make([]RecordID, 0, len(students))
+	dirty := false
+	for _, student := range students {
+		if offset+fs.fixedRecordSize > fs.blockSize {
+			if dirty {
+				if err := bf.writeBlock(blockNum, block); err != nil {
+					return nil, err
+				}
+			}
+			blockNum++
+			block = make([]byte, fs.blockSize)
+			offset = 0
+		}
+
+		copy(block[offset:], fs.serializeStudentFixed(student))
+		rids = append(rids, RecordID{Block: blockNum, Slot: offset / fs.fixedRecordSize})
+		dirty = true
+		offset = fs.nextFreeSlot(block, offset+fs.fixedRecordSize)
 	}
 
-	allStudents := make([]entity.Student, len(existingStudents))
-	for i, s := range existingStudents {
-		allStudents[i] = *s
+	bf.addRecordCount(len(students))
+	if dirty {
+		if err := bf.writeBlock(blockNum, block); err != nil {
+			return nil, err
+		}
 	}
+	return rids, nil
+}
 
-	allStudents = append(allStudents, students...)
+func (fs *FixedStorage) InsertStudent(filename string, student entity.Student) (RecordID, error) {
+	if err := checkNewMatriculas(fs, filename, []entity.Student{student}); err != nil {
+		return RecordID{}, err
+	}
 
-	err = fs.WriteStudents(filename, allStudents)
+	rids, err := fs.insertRecords(filename, []entity.Student{student})
+	if err != nil {
+		return RecordID{}, err
+	}
+	return rids[0], nil
+}
+
+func (fs *FixedStorage) ScanStudents(filename string, fn func(rid RecordID, student *entity.Student) bool) error {
+	bf, err := openBlockFile(filename, ModeFixed, fs.blockSize, false, false)
 	if err != nil {
 		return err
 	}
+	defer bf.Close()
 
-	fs.calculateFinalStats()
+	totalBlocks := bf.totalBlocks()
+	for blockNum := 0; blockNum < totalBlocks; blockNum++ {
+		block, err := bf.readBlock(blockNum)
+		if err != nil {
+			continue
+		}
+
+		for offset := 0; offset+fs.fixedRecordSize <= fs.blockSize; offset += fs.fixedRecordSize {
+			slot := block[offset : offset+fs.fixedRecordSize]
+			if !fs.isActiveSlot(slot) {
+				continue
+			}
+
+			student, err := fs.deserializeStudentFixed(slot)
+			if err != nil {
+				continue
+			}
+			if !fn(RecordID{Block: blockNum, Slot: offset / fs.fixedRecordSize}, student) {
+				return nil
+			}
+		}
+	}
+	return nil
+}
+
+// slotAt devolve o offset e o conteúdo do slot ativo indicado por rid
+func (fs *FixedStorage) slotAt(bf *blockFile, rid RecordID) (int, []byte, error) {
+	offset := rid.Slot * fs.fixedRecordSize
+	if rid.Block < 0 || rid.Block >= bf.totalBlocks() || rid.Slot < 0 || offset+fs.fixedRecordSize > fs.blockSize {
+		return 0, nil, fmt.Errorf("%w: %s", ErrRecordNotFound, rid)
+	}
+
+	block, err := bf.readBlock(rid.Block)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	slot := block[offset : offset+fs.fixedRecordSize]
+	if !fs.isActiveSlot(slot) {
+		return 0, nil, fmt.Errorf("%w: %s", ErrRecordNotFound, rid)
+	}
+	return offset, slot, nil
+}
+
+func (fs *FixedStorage) GetByRID(filename string, rid RecordID) (*entity.Student, error) {
+	bf, err := openBlockFile(filename, ModeFixed, fs.blockSize, false, false)
+	if err != nil {
+		return nil, err
+	}
+	defer bf.Close()
+
+	_, slot, err := fs.slotAt(bf, rid)
+	if err != nil {
+		return nil, err
+	}
+	return fs.deserializeStudentFixed(slot)
+}
+
+// UpdateByRID sobrescreve o slot; o RecordID nunca muda no armazenamento de tamanho fixo
+func (fs *FixedStorage) UpdateByRID(filename string, rid RecordID, student entity.Student) (RecordID, error) {
+	if err := checkUpdatedMatricula(fs, filename, rid, student); err != nil {
+		return RecordID{}, err
+	}
+	return fs.updateRecord(filename, rid, student)
+}
+
+// updateRecord é o UpdateByRID sem a verificação de matrícula
+func (fs *FixedStorage) updateRecord(filename string, rid RecordID, student entity.Student) (_ RecordID, err error) {
+	bf, err := openBlockFile(filename, ModeFixed, fs.blockSize, true, false)
+	if err != nil {
+		return RecordID{}, err
+	}
+	defer closeBlockFile(bf, &err)
+
+	offset, _, err := fs.slotAt(bf, rid)
+	if err != nil {
+		return RecordID{}, err
+	}
+	return rid, bf.writeAt(rid.Block, offset, fs.serializeStudentFixed(student))
+}
+
+func (fs *FixedStorage) DeleteByRID(filename string, rid RecordID) (err error) {
+	bf, err := openBlockFile(filename, ModeFixed, fs.blockSize, true, false)
+	if err != nil {
+		return err
+	}
+	defer closeBlockFile(bf, &err)
+
+	offset, _, err := fs.slotAt(bf, rid)
+	if err != nil {
+		return err
+	}
+
+	if err := bf.writeAt(rid.Block, offset, []byte{StatusDeleted}); err != nil {
+		return err
+	}
+	bf.addRecordCount(-1)
+	return nil
+}
+
+// nextFreeSlot devolve o offset do primeiro slot livre (nunca utilizado ou marcado como
+// removido) a partir de start. Só o último bloco é examinado nas inserções; slots removidos
+// nos blocos anteriores são recuperados por Reorganize
+func (fs *FixedStorage) nextFreeSlot(block []byte, start int) int {
+	for offset := start; offset+fs.fixedRecordSize <= fs.blockSize; offset += fs.fixedRecordSize {
+		slot := block[offset : offset+fs.fixedRecordSize]
+		if slot[0] == StatusDeleted || (slot[0] == StatusActive && fs.slotMatricula(slot) == 0) {
+			return offset
+		}
+	}
+	return fs.blockSize
+}
+
+func (fs *FixedStorage) isActiveSlot(slot []byte) bool {
+	return slot[0] == StatusActive && fs.slotMatricula(slot) > 0
+}
+
+func (fs *FixedStorage) slotMatricula(slot []byte) int {
+	return int(binary.LittleEndian.Uint32(slot[1:5]))
+}
+
+func (fs *FixedStorage) findStudentSlot(bf *blockFile, totalBlocks int, matricula int) (int, int, error) {
+	for blockNum := 0; blockNum < totalBlocks; blockNum++ {
+		block, err := bf.readBlock(blockNum)
+		if err != nil {
+			continue
+		}
+
+		for offset := 0; offset+fs.fixedRecordSize <= fs.blockSize; offset += fs.fixedRecordSize {
+			slot := block[offset : offset+fs.fixedRecordSize]
+			if fs.isActiveSlot(slot) && fs.slotMatricula(slot) == matricula {
+				return blockNum, offset, nil
+			}
+		}
+	}
+	return -1, -1, fmt.Errorf("aluno com matrícula %d não encontrado", matricula)
+}
+
+// UpdateStudent sempre sobrescreve o slot original, já que todos têm o mesmo tamanho
+func (fs *FixedStorage) UpdateStudent(filename string, updatedStudent entity.Student) (err error) {
+	bf, err := openBlockFile(filename, ModeFixed, fs.blockSize, true, false)
+	if err != nil {
+		return err
+	}
+	defer closeBlockFile(bf, &err)
+
+	totalBlocks := bf.totalBlocks()
+	blockNum, offset, err := fs.findStudentSlot(bf, totalBlocks, updatedStudent.Matricula)
+	if err != nil {
+		return err
+	}
+
+	recordData := fs.serializeStudentFixed(updatedStudent)
+	return bf.writeAt(blockNum, offset, recordData)
+}
+
+func (fs *FixedStorage) DeleteStudent(filename string, matricula int) (err error) {
+	bf, err := openBlockFile(filename, ModeFixed, fs.blockSize, true, false)
+	if err != nil {
+		return err
+	}
+	defer closeBlockFile(bf, &err)
+
+	totalBlocks := bf.totalBlocks()
+	blockNum, offset, err := fs.findStudentSlot(bf, totalBlocks, matricula)
+	if err != nil {
+		return fmt.Errorf("aluno não encontrado")
+	}
+
+	if err := bf.writeAt(blockNum, offset, []byte{StatusDeleted}); err != nil {
+		return err
+	}
+	bf.addRecordCount(-1)
 	return nil
 }
+
+// Reorganize: Compactação física, regravando apenas os slots ativos
+func (fs *FixedStorage) Reorganize(filename string) (*ReorganizationReport, error) {
+	statsBefore := fs.GetStats(filename)
+
+	students, err := fs.GetAllStudents(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	tempFilename := temporaryFilename(filename)
+
+	tempStorage, err := NewFixedStorage(fs.blockSize)
+	if err != nil {
+		return nil, err
+	}
+
+	studentsValue := make([]entity.Student, len(students))
+	for i, s := range students {
+		studentsValue[i] = *s
+	}
+
+	err = tempStorage.WriteStudents(tempFilename, studentsValue)
+	if err != nil {
+		removeTemporaryFiles(tempFilename)
+		return nil, err
+	}
+
+	backup, err := replaceFile(tempFilename, filename, fs.keepBackup, indexExtensions...)
+	if err != nil {
+		return nil, err
+	}
+
+	statsAfter := fs.GetStats(filename)
+	report := newReorganizationReport(statsBefore, statsAfter)
+	report.BackupFilename = backup
+	return report, nil
+}
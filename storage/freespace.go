@@ -0,0 +1,191 @@
+package storage
+
+import (
+	"encoding/binary"
+	"fmt"
+	"os"
+)
+
+// Arquivo .fsm: magic (4) + geração do .dat (8) + quantidade de blocos (4) +
+// bytes livres de cada bloco (4 cada)
+const (
+	freeSpaceMagic      = "FSM1"
+	freeSpaceHeaderSize = 16
+)
+
+// freeSpaceMap guarda os bytes livres de cada bloco em uma árvore de segmentos de
+// máximos, permitindo localizar um bloco com espaço suficiente em O(log n)
+type freeSpaceMap struct {
+	free   []int
+	tree   []int
+	leaves int
+}
+
+func newFreeSpaceMap(free []int) *freeSpaceMap {
+	m := &freeSpaceMap{}
+	m.rebuild(free)
+	return m
+}
+
+func (m *freeSpaceMap) rebuild(free []int) {
+	m.leaves = 1
+	for m.leaves < len(free) {
+		m.leaves *= 2
+	}
+
+	m.free = free
+	m.tree = make([]int, 2*m.leaves)
+	for i, f := range free {
+		m.tree[m.leaves+i] = f
+	}
+	for node := m.leaves - 1; node >= 1; node-- {
+		m.tree[node] = max(m.tree[2*node], m.tree[2*node+1])
+	}
+}
+
+func (m *freeSpaceMap) len() int {
+	return len(m.free)
+}
+
+func (m *freeSpaceMap) get(blockNum int) int {
+	return m.free[blockNum]
+}
+
+func (m *freeSpaceMap) set(blockNum int, free int) {
+	m.free[blockNum] = free
+	node := m.leaves + blockNum
+	m.tree[node] = free
+	for node > 1 {
+		node /= 2
+		m.tree[node] = max(m.tree[2*node], m.tree[2*node+1])
+	}
+}
+
+func (m *freeSpaceMap) append(free int) {
+	if len(m.free) == m.leaves {
+		m.rebuild(append(m.free, free))
+		return
+	}
+	m.free = append(m.free, free)
+	m.set(len(m.free)-1, free)
+}
+
+// firstFit devolve o primeiro bloco com pelo menos need bytes livres, ou -1
+func (m *freeSpaceMap) firstFit(need int) int {
+	if len(m.free) == 0 || m.tree[1] < need {
+		return -1
+	}
+
+	node := 1
+	for node < m.leaves {
+		if m.tree[2*node] >= need {
+			node = 2 * node
+		} else {
+			node = 2*node + 1
+		}
+	}
+	return node - m.leaves
+}
+
+func (m *freeSpaceMap) save(filename string, generation uint64) error {
+	data := make([]byte, freeSpaceHeaderSize+4*len(m.free))
+	copy(data[0:4], freeSpaceMagic)
+	binary.LittleEndian.PutUint64(data[4:12], generation)
+	binary.LittleEndian.PutUint32(data[12:16], uint32(len(m.free)))
+	for i, f := range m.free {
+		binary.LittleEndian.PutUint32(data[freeSpaceHeaderSize+4*i:], uint32(f))
+	}
+
+	if err := os.WriteFile(filename, data, 0644); err != nil {
+		return fmt.Errorf("erro ao gravar mapa de espaço livre: %w", err)
+	}
+	return nil
+}
+
+// loadFreeSpaceMap lê o mapa persistido; devolve nil se estiver ausente, corrompido
+// ou desatualizado em relação à geração e à quantidade de blocos do arquivo de dados
+func loadFreeSpaceMap(filename string, generation uint64, totalBlocks int) *freeSpaceMap {
+	data, err := os.ReadFile(filename)
+	if err != nil || len(data) < freeSpaceHeaderSize || string(data[0:4]) != freeSpaceMagic {
+		return nil
+	}
+
+	if binary.LittleEndian.Uint64(data[4:12]) != generation {
+		return nil
+	}
+
+	count := int(binary.LittleEndian.Uint32(data[12:16]))
+	if count != totalBlocks || len(data) != freeSpaceHeaderSize+4*count {
+		return nil
+	}
+
+	free := make([]int, count)
+	for i := range free {
+		free[i] = int(binary.LittleEndian.Uint32(data[freeSpaceHeaderSize+4*i:]))
+	}
+	return newFreeSpaceMap(free)
+}
+
+// firstFitFrom devolve o primeiro bloco a partir de start com pelo menos need bytes livres, ou -1
+func (m *freeSpaceMap) firstFitFrom(need int, start int) int {
+	return m.search(1, 0, m.leaves, need, start)
+}
+
+func (m *freeSpaceMap) search(node, lo, hi, need, start int) int {
+	if hi <= start || lo >= len(m.free) || m.tree[node] < need {
+		return -1
+	}
+	if hi-lo == 1 {
+		return lo
+	}
+
+	mid := (lo + hi) / 2
+	if found := m.search(2*node, lo, mid, need, start); found >= 0 {
+		return found
+	}
+	return m.search(2*node+1, mid, hi, need, start)
+}
+
+// bestFit devolve o bloco com o menor espaço livre que ainda comporte need bytes, ou -1.
+// A descida descarta as subárvores cujo máximo não comporta need e para no primeiro bloco
+// com exatamente need bytes; no pior caso, com muitos blocos que comportam need, ainda
+// visita O(n) nós
+func (m *freeSpaceMap) bestFit(need int) int {
+	best := -1
+	m.bestFitIn(1, 0, m.leaves, need, &best)
+	return best
+}
+
+// bestFitIn atualiza best com o menor bloco da subárvore que comporta need e devolve true
+// quando encontra um encaixe exato, que encerra a busca
+func (m *freeSpaceMap) bestFitIn(node, lo, hi, need int, best *int) bool {
+	if lo >= len(m.free) || m.tree[node] < need {
+		return false
+	}
+	if hi-lo == 1 {
+		if *best < 0 || m.free[lo] < m.free[*best] {
+			*best = lo
+		}
+		return m.free[lo] == need
+	}
+
+	mid := (lo + hi) / 2
+	return m.bestFitIn(2*node, lo, mid, need, best) || m.bestFitIn(2*node+1, mid, hi, need, best)
+}
+
+// worstFit devolve o bloco com o maior espaço livre, se comportar need bytes, ou -1
+func (m *freeSpaceMap) worstFit(need int) int {
+	if len(m.free) == 0 || m.tree[1] < need {
+		return -1
+	}
+
+	node := 1
+	for node < m.leaves {
+		if m.tree[2*node] == m.tree[node] {
+			node = 2 * node
+		} else {
+			node = 2*node + 1
+		}
+	}
+	return node - m.leaves
+}
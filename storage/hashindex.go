@@ -0,0 +1,482 @@
+package storage
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"os"
+)
+
+// Hash extensível em disco que mapeia matrícula para RecordID. O arquivo é dividido em
+// blocos do tamanho do nó da árvore B+ (indexNodeSize); o bloco 0 é o cabeçalho: magic (4) +
+// tamanho do bloco (4) + profundidade global (4) + quantidade de blocos (4) + entradas (4) +
+// início do diretório (4) + blocos do diretório (4) + geração (8) do arquivo de dados. O
+// diretório tem 2^profundidade global números de bucket (4 bytes cada) em blocos
+// consecutivos; ao crescer além da área atual ele é regravado no fim do arquivo e a área
+// antiga passa a receber buckets novos. Cada bucket tem profundidade local (2) + quantidade
+// de entradas (2) + reservado (4) e as entradas chave + bloco + slot (4 bytes cada), por
+// isso as chaves vão de 0 a math.MaxUint32
+const (
+	hashMagic          = "HIDX"
+	hashHeaderSize     = 36
+	hashBucketHeader   = 8
+	hashEntrySize      = 12
+	hashDirEntrySize   = 4
+	hashMaxGlobalDepth = 20
+)
+
+type hashBucket struct {
+	localDepth int
+	keys       []int
+	rids       []RecordID
+}
+
+type extendibleHash struct {
+	file        *os.File
+	blockSize   int
+	globalDepth int
+	blockCount  int
+	entries     int
+	dirStart    int
+	dirBlocks   int
+	directory   []int
+	dirDirty    bool
+	freeBlocks  []int
+	generation  uint64
+}
+
+// hashKey espalha matrículas sequenciais pelos bits baixos usados pelo diretório
+// (finalizador do MurmurHash3)
+func hashKey(key int) uint32 {
+	h := uint32(key)
+	h ^= h >> 16
+	h *= 0x85ebca6b
+	h ^= h >> 13
+	h *= 0xc2b2ae35
+	h ^= h >> 16
+	return h
+}
+
+func (h *extendibleHash) bucketCapacity() int {
+	return (h.blockSize - hashBucketHeader) / hashEntrySize
+}
+
+func (h *extendibleHash) directorySlot(key int) int {
+	return int(hashKey(key) & (1<<h.globalDepth - 1))
+}
+
+// checkHashKey rejeita chaves que não cabem nos 4 bytes gravados no bucket, que seriam
+// confundidas com outras chaves
+func checkHashKey(key int) error {
+	if key < 0 || uint64(key) > math.MaxUint32 {
+		return fmt.Errorf("chave %d fora da faixa do índice hash (0 a %d)", key, uint32(math.MaxUint32))
+	}
+	return nil
+}
+
+func openExtendibleHash(filename string, blockSize int) (*extendibleHash, error) {
+	file, err := os.OpenFile(filename, os.O_RDWR, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	data := make([]byte, hashHeaderSize)
+	if _, err := file.ReadAt(data, 0); err != nil || string(data[0:4]) != hashMagic {
+		file.Close()
+		return nil, fmt.Errorf("%s: %w", filename, errInvalidIndex)
+	}
+
+	h := &extendibleHash{
+		file:        file,
+		blockSize:   int(binary.LittleEndian.Uint32(data[4:8])),
+		globalDepth: int(binary.LittleEndian.Uint32(data[8:12])),
+		blockCount:  int(binary.LittleEndian.Uint32(data[12:16])),
+		entries:     int(binary.LittleEndian.Uint32(data[16:20])),
+		dirStart:    int(binary.LittleEndian.Uint32(data[20:24])),
+		dirBlocks:   int(binary.LittleEndian.Uint32(data[24:28])),
+		generation:  binary.LittleEndian.Uint64(data[28:36]),
+	}
+	if h.blockSize != indexNodeSize(blockSize) || h.globalDepth > hashMaxGlobalDepth {
+		file.Close()
+		return nil, fmt.Errorf("%s: %w", filename, errInvalidIndex)
+	}
+
+	if err := h.readDirectory(); err != nil {
+		file.Close()
+		return nil, err
+	}
+	h.findFreeBlocks()
+	return h, nil
+}
+
+// findFreeBlocks recupera os blocos de áreas antigas do diretório que ainda não foram
+// reaproveitados: os que não são buckets nem pertencem à área atual do diretório
+func (h *extendibleHash) findFreeBlocks() {
+	used := make([]bool, h.blockCount)
+	used[0] = true
+	for _, blockNum := range h.directory {
+		used[blockNum] = true
+	}
+	for i := 0; i < h.dirBlocks && h.dirStart+i < h.blockCount; i++ {
+		used[h.dirStart+i] = true
+	}
+
+	h.freeBlocks = nil
+	for blockNum := h.blockCount - 1; blockNum > 0; blockNum-- {
+		if !used[blockNum] {
+			h.freeBlocks = append(h.freeBlocks, blockNum)
+		}
+	}
+}
+
+// allocBlock reaproveita um bloco de uma área antiga do diretório ou estende o arquivo
+func (h *extendibleHash) allocBlock() int {
+	if n := len(h.freeBlocks); n > 0 {
+		blockNum := h.freeBlocks[n-1]
+		h.freeBlocks = h.freeBlocks[:n-1]
+		return blockNum
+	}
+	blockNum := h.blockCount
+	h.blockCount++
+	return blockNum
+}
+
+// createExtendibleHash começa com profundidade global 0 (um único bucket) e insere as
+// entradas, dividindo os buckets conforme enchem
+func createExtendibleHash(filename string, blockSize int, generation uint64, entries []indexEntry) (*extendibleHash, error) {
+	file, err := os.Create(filename)
+	if err != nil {
+		return nil, fmt.Errorf("erro ao criar índice: %w", err)
+	}
+
+	h := &extendibleHash{
+		file:       file,
+		blockSize:  indexNodeSize(blockSize),
+		blockCount: 2,
+		directory:  []int{1},
+		dirDirty:   true,
+		generation: generation,
+	}
+	if err := h.writeBucket(1, &hashBucket{}); err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	for _, entry := range entries {
+		if err := h.insert(entry.key, entry.rid); err != nil {
+			file.Close()
+			return nil, err
+		}
+	}
+
+	if err := h.flush(); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return h, nil
+}
+
+func (h *extendibleHash) blockOffset(blockNum int) int64 {
+	return int64(blockNum) * int64(h.blockSize)
+}
+
+func (h *extendibleHash) readDirectory() error {
+	data := make([]byte, h.dirBlocks*h.blockSize)
+	if _, err := h.file.ReadAt(data, h.blockOffset(h.dirStart)); err != nil {
+		return fmt.Errorf("erro ao ler diretório do índice: %w", err)
+	}
+
+	size := 1 << h.globalDepth
+	if size*hashDirEntrySize > len(data) {
+		return errInvalidIndex
+	}
+
+	h.directory = make([]int, size)
+	for i := range h.directory {
+		h.directory[i] = int(binary.LittleEndian.Uint32(data[i*hashDirEntrySize:]))
+		if h.directory[i] <= 0 || h.directory[i] >= h.blockCount {
+			return fmt.Errorf("diretório do índice aponta para o bloco %d: %w", h.directory[i], errInvalidIndex)
+		}
+	}
+	return nil
+}
+
+// writeDirectory regrava o diretório na sua área. Se ele não couber mais, a área é estendida
+// quando está no fim do arquivo; caso contrário uma área nova é alocada no fim e os blocos
+// da antiga são reaproveitados pelos próximos buckets
+func (h *extendibleHash) writeDirectory() error {
+	blocks := (len(h.directory)*hashDirEntrySize + h.blockSize - 1) / h.blockSize
+	if blocks > h.dirBlocks {
+		if h.dirBlocks > 0 && h.dirStart+h.dirBlocks == h.blockCount {
+			h.blockCount = h.dirStart + blocks
+		} else {
+			for i := h.dirBlocks - 1; i >= 0; i-- {
+				h.freeBlocks = append(h.freeBlocks, h.dirStart+i)
+			}
+			h.dirStart = h.blockCount
+			h.blockCount += blocks
+		}
+		h.dirBlocks = blocks
+	}
+
+	data := make([]byte, h.dirBlocks*h.blockSize)
+	for i, bucket := range h.directory {
+		binary.LittleEndian.PutUint32(data[i*hashDirEntrySize:], uint32(bucket))
+	}
+	if _, err := h.file.WriteAt(data, h.blockOffset(h.dirStart)); err != nil {
+		return fmt.Errorf("erro ao gravar diretório do índice: %w", err)
+	}
+	h.dirDirty = false
+	return nil
+}
+
+func (h *extendibleHash) writeHeader() error {
+	data := make([]byte, h.blockSize)
+	copy(data[0:4], hashMagic)
+	binary.LittleEndian.PutUint32(data[4:8], uint32(h.blockSize))
+	binary.LittleEndian.PutUint32(data[8:12], uint32(h.globalDepth))
+	binary.LittleEndian.PutUint32(data[12:16], uint32(h.blockCount))
+	binary.LittleEndian.PutUint32(data[16:20], uint32(h.entries))
+	binary.LittleEndian.PutUint32(data[20:24], uint32(h.dirStart))
+	binary.LittleEndian.PutUint32(data[24:28], uint32(h.dirBlocks))
+	binary.LittleEndian.PutUint64(data[28:36], h.generation)
+	if _, err := h.file.WriteAt(data, 0); err != nil {
+		return fmt.Errorf("erro ao gravar cabeçalho do índice: %w", err)
+	}
+	return nil
+}
+
+// flush grava o diretório, se alterado, e o cabeçalho
+func (h *extendibleHash) flush() error {
+	if h.dirDirty {
+		if err := h.writeDirectory(); err != nil {
+			return err
+		}
+	}
+	return h.writeHeader()
+}
+
+func (h *extendibleHash) readBucket(blockNum int) (*hashBucket, error) {
+	data := make([]byte, h.blockSize)
+	if _, err := h.file.ReadAt(data, h.blockOffset(blockNum)); err != nil {
+		return nil, fmt.Errorf("erro ao ler bucket %d do índice: %w", blockNum, err)
+	}
+
+	count := int(binary.LittleEndian.Uint16(data[2:4]))
+	if count > h.bucketCapacity() {
+		return nil, fmt.Errorf("bucket %d do índice corrompido: %w", blockNum, errInvalidIndex)
+	}
+
+	bucket := &hashBucket{localDepth: int(binary.LittleEndian.Uint16(data[0:2]))}
+	for i := 0; i < count; i++ {
+		offset := hashBucketHeader + i*hashEntrySize
+		bucket.keys = append(bucket.keys, int(binary.LittleEndian.Uint32(data[offset:offset+4])))
+		bucket.rids = append(bucket.rids, RecordID{
+			Block: int(binary.LittleEndian.Uint32(data[offset+4 : offset+8])),
+			Slot:  int(binary.LittleEndian.Uint32(data[offset+8 : offset+12])),
+		})
+	}
+	return bucket, nil
+}
+
+func (h *extendibleHash) writeBucket(blockNum int, bucket *hashBucket) error {
+	data := make([]byte, h.blockSize)
+	binary.LittleEndian.PutUint16(data[0:2], uint16(bucket.localDepth))
+	binary.LittleEndian.PutUint16(data[2:4], uint16(len(bucket.keys)))
+	for i, key := range bucket.keys {
+		offset := hashBucketHeader + i*hashEntrySize
+		binary.LittleEndian.PutUint32(data[offset:offset+4], uint32(key))
+		binary.LittleEndian.PutUint32(data[offset+4:offset+8], uint32(bucket.rids[i].Block))
+		binary.LittleEndian.PutUint32(data[offset+8:offset+12], uint32(bucket.rids[i].Slot))
+	}
+
+	if _, err := h.file.WriteAt(data, h.blockOffset(blockNum)); err != nil {
+		return fmt.Errorf("erro ao gravar bucket %d do índice: %w", blockNum, err)
+	}
+	return nil
+}
+
+func (b *hashBucket) find(key int) int {
+	for i, k := range b.keys {
+		if k == key {
+			return i
+		}
+	}
+	return -1
+}
+
+// search lê um único bucket, apontado pelo diretório em memória
+func (h *extendibleHash) search(key int) (RecordID, bool, error) {
+	if err := checkHashKey(key); err != nil {
+		return RecordID{}, false, err
+	}
+	bucket, err := h.readBucket(h.directory[h.directorySlot(key)])
+	if err != nil {
+		return RecordID{}, false, err
+	}
+
+	if i := bucket.find(key); i >= 0 {
+		return bucket.rids[i], true, nil
+	}
+	return RecordID{}, false, nil
+}
+
+// insert grava ou substitui a entrada da chave; um bucket cheio é dividido (dobrando o
+// diretório quando sua profundidade local alcança a global) até a entrada caber
+func (h *extendibleHash) insert(key int, rid RecordID) error {
+	if err := checkHashKey(key); err != nil {
+		return err
+	}
+	for {
+		blockNum := h.directory[h.directorySlot(key)]
+		bucket, err := h.readBucket(blockNum)
+		if err != nil {
+			return err
+		}
+
+		if i := bucket.find(key); i >= 0 {
+			bucket.rids[i] = rid
+			return h.writeBucket(blockNum, bucket)
+		}
+
+		if len(bucket.keys) < h.bucketCapacity() {
+			bucket.keys = append(bucket.keys, key)
+			bucket.rids = append(bucket.rids, rid)
+			h.entries++
+			return h.writeBucket(blockNum, bucket)
+		}
+
+		if err := h.split(blockNum, bucket); err != nil {
+			return err
+		}
+	}
+}
+
+func (h *extendibleHash) split(blockNum int, bucket *hashBucket) error {
+	if bucket.localDepth == h.globalDepth {
+		if h.globalDepth >= hashMaxGlobalDepth {
+			return fmt.Errorf("índice hash atingiu a profundidade máxima (%d)", hashMaxGlobalDepth)
+		}
+		h.directory = append(h.directory, h.directory...)
+		h.globalDepth++
+	}
+
+	bit := uint32(1) << bucket.localDepth
+	bucket.localDepth++
+	sibling := &hashBucket{localDepth: bucket.localDepth}
+	siblingNum := h.allocBlock()
+
+	keys, rids := bucket.keys, bucket.rids
+	bucket.keys, bucket.rids = nil, nil
+	for i, key := range keys {
+		if hashKey(key)&bit != 0 {
+			sibling.keys = append(sibling.keys, key)
+			sibling.rids = append(sibling.rids, rids[i])
+		} else {
+			bucket.keys = append(bucket.keys, key)
+			bucket.rids = append(bucket.rids, rids[i])
+		}
+	}
+
+	for slot := range h.directory {
+		if h.directory[slot] == blockNum && uint32(slot)&bit != 0 {
+			h.directory[slot] = siblingNum
+		}
+	}
+	h.dirDirty = true
+
+	if err := h.writeBucket(siblingNum, sibling); err != nil {
+		return err
+	}
+	return h.writeBucket(blockNum, bucket)
+}
+
+// remove apaga a entrada do bucket sem fundir buckets nem reduzir o diretório
+func (h *extendibleHash) remove(key int) (bool, error) {
+	if err := checkHashKey(key); err != nil {
+		return false, err
+	}
+	blockNum := h.directory[h.directorySlot(key)]
+	bucket, err := h.readBucket(blockNum)
+	if err != nil {
+		return false, err
+	}
+
+	i := bucket.find(key)
+	if i < 0 {
+		return false, nil
+	}
+	bucket.keys = append(bucket.keys[:i], bucket.keys[i+1:]...)
+	bucket.rids = append(bucket.rids[:i], bucket.rids[i+1:]...)
+	h.entries--
+	return true, h.writeBucket(blockNum, bucket)
+}
+
+// scan percorre as entradas de cada bucket uma vez, sem ordem de chave
+func (h *extendibleHash) scan(fn func(key int, rid RecordID) bool) error {
+	visited := make(map[int]bool)
+	for _, blockNum := range h.directory {
+		if visited[blockNum] {
+			continue
+		}
+		visited[blockNum] = true
+
+		bucket, err := h.readBucket(blockNum)
+		if err != nil {
+			return err
+		}
+		for i, key := range bucket.keys {
+			if !fn(key, bucket.rids[i]) {
+				return nil
+			}
+		}
+	}
+	return nil
+}
+
+func (h *extendibleHash) dataGeneration() uint64 {
+	return h.generation
+}
+
+func (h *extendibleHash) stats() (*IndexStats, error) {
+	stats := &IndexStats{
+		Kind:          IndexExtendibleHash,
+		Entries:       h.entries,
+		PageCapacity:  h.bucketCapacity(),
+		GlobalDepth:   h.globalDepth,
+		DirectorySize: len(h.directory),
+		LocalDepths:   make([]int, h.globalDepth+1),
+	}
+
+	visited := make(map[int]bool)
+	for _, blockNum := range h.directory {
+		if visited[blockNum] {
+			continue
+		}
+		visited[blockNum] = true
+
+		bucket, err := h.readBucket(blockNum)
+		if err != nil {
+			return nil, err
+		}
+		if bucket.localDepth < len(stats.LocalDepths) {
+			stats.LocalDepths[bucket.localDepth]++
+		}
+		stats.addPage(len(bucket.keys))
+	}
+	return stats, nil
+}
+
+// save registra a geração do arquivo de dados que o índice descreve e fecha o arquivo
+func (h *extendibleHash) save(generation uint64) error {
+	h.generation = generation
+	if err := h.flush(); err != nil {
+		h.file.Close()
+		return err
+	}
+	return h.file.Close()
+}
+
+func (h *extendibleHash) close() error {
+	return h.file.Close()
+}
@@ -0,0 +1,182 @@
+package storage
+
+import (
+	"math"
+	"path/filepath"
+	"testing"
+)
+
+// hashTestKey gera matrículas no formato usado pelo gerador de alunos
+func hashTestKey(i int) int {
+	return 100000000 + i
+}
+
+func checkHashContents(t *testing.T, h *extendibleHash, total int, removed func(i int) bool) {
+	t.Helper()
+	for i := 0; i < total; i++ {
+		rid, ok, err := h.search(hashTestKey(i))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ok == removed(i) {
+			t.Fatalf("search(%d) encontrou = %v", hashTestKey(i), ok)
+		}
+		if ok && rid != (RecordID{Block: i, Slot: i % 5}) {
+			t.Fatalf("search(%d) = %s", hashTestKey(i), rid)
+		}
+	}
+}
+
+// checkHashBlocks confere que todo bloco do arquivo é o cabeçalho, um bucket, parte do
+// diretório ou um bloco livre à espera de reaproveitamento
+func checkHashBlocks(t *testing.T, h *extendibleHash) {
+	t.Helper()
+	buckets := make(map[int]bool)
+	for _, blockNum := range h.directory {
+		buckets[blockNum] = true
+	}
+	if got := 1 + len(buckets) + h.dirBlocks + len(h.freeBlocks); got != h.blockCount {
+		t.Fatalf("%d blocos no arquivo, mas %d buckets, %d do diretório e %d livres", h.blockCount, len(buckets), h.dirBlocks, len(h.freeBlocks))
+	}
+	if len(h.freeBlocks) >= h.dirBlocks && h.dirBlocks > 0 {
+		t.Fatalf("%d blocos livres para um diretório de %d blocos", len(h.freeBlocks), h.dirBlocks)
+	}
+}
+
+func TestExtendibleHashSplitsAndDoublesDirectory(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "a.hsh")
+	h, err := createExtendibleHash(filename, testIndexBlockSize, 1, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const total = 3000
+	for i := 0; i < total; i++ {
+		if err := h.insert(hashTestKey(i), RecordID{Block: i, Slot: i % 5}); err != nil {
+			t.Fatalf("insert(%d): %v", hashTestKey(i), err)
+		}
+	}
+
+	// Com 4 entradas por bucket, 3000 chaves exigem centenas de buckets
+	stats, err := h.stats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Entries != total || stats.Pages < total/h.bucketCapacity() {
+		t.Fatalf("%d entradas em %d buckets", stats.Entries, stats.Pages)
+	}
+	if stats.GlobalDepth < 10 || stats.DirectorySize != 1<<stats.GlobalDepth {
+		t.Fatalf("profundidade global %d com diretório de %d posições", stats.GlobalDepth, stats.DirectorySize)
+	}
+	checkHashContents(t, h, total, func(int) bool { return false })
+
+	if err := h.save(7); err != nil {
+		t.Fatal(err)
+	}
+	h, err = openExtendibleHash(filename, testIndexBlockSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h.dataGeneration() != 7 || h.entries != total || h.globalDepth != stats.GlobalDepth {
+		t.Fatalf("cabeçalho reaberto: geração %d, %d entradas, profundidade %d", h.dataGeneration(), h.entries, h.globalDepth)
+	}
+	checkHashContents(t, h, total, func(int) bool { return false })
+
+	removed := func(i int) bool { return i%3 == 0 }
+	for i := 0; i < total; i++ {
+		if !removed(i) {
+			continue
+		}
+		if ok, err := h.remove(hashTestKey(i)); !ok || err != nil {
+			t.Fatalf("remove(%d) = %v, %v", hashTestKey(i), ok, err)
+		}
+	}
+	if ok, err := h.remove(hashTestKey(0)); ok || err != nil {
+		t.Fatalf("remove de chave ausente = %v, %v", ok, err)
+	}
+	checkHashContents(t, h, total, removed)
+
+	if err := h.save(8); err != nil {
+		t.Fatal(err)
+	}
+	h, err = openExtendibleHash(filename, testIndexBlockSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.close()
+	if h.entries != total-total/3 {
+		t.Fatalf("entries = %d, esperadas %d", h.entries, total-total/3)
+	}
+	checkHashContents(t, h, total, removed)
+}
+
+func TestExtendibleHashReusesOldDirectoryBlocks(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "a.hsh")
+	h, err := createExtendibleHash(filename, testIndexBlockSize, 1, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Gravar o diretório após cada lote faz com que ele mude de área várias vezes
+	const total = 4000
+	moved := false
+	for i := 0; i < total; i++ {
+		if err := h.insert(hashTestKey(i), RecordID{Block: i, Slot: i % 5}); err != nil {
+			t.Fatal(err)
+		}
+		if i%50 == 49 {
+			if err := h.flush(); err != nil {
+				t.Fatal(err)
+			}
+			checkHashBlocks(t, h)
+			moved = moved || len(h.freeBlocks) > 0
+		}
+	}
+	if !moved || h.dirBlocks < 4 {
+		t.Fatalf("diretório com %d blocos nunca liberou a área antiga", h.dirBlocks)
+	}
+
+	free := len(h.freeBlocks)
+	if err := h.save(2); err != nil {
+		t.Fatal(err)
+	}
+	h, err = openExtendibleHash(filename, testIndexBlockSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.close()
+	if len(h.freeBlocks) != free {
+		t.Fatalf("%d blocos livres após reabrir, esperados %d", len(h.freeBlocks), free)
+	}
+	checkHashBlocks(t, h)
+	checkHashContents(t, h, total, func(int) bool { return false })
+}
+
+func TestExtendibleHashRejectsKeysOutsideUint32(t *testing.T) {
+	h, err := createExtendibleHash(filepath.Join(t.TempDir(), "a.hsh"), testIndexBlockSize, 1, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.close()
+
+	if err := h.insert(7, RecordID{Block: 1}); err != nil {
+		t.Fatal(err)
+	}
+
+	// 1<<32 + 7 seria gravada como 7 se a chave fosse truncada
+	aliased := int(uint64(math.MaxUint32) + 8)
+	if err := h.insert(aliased, RecordID{Block: 2}); err == nil {
+		t.Fatal("chave acima de MaxUint32 aceita")
+	}
+	if _, _, err := h.search(aliased); err == nil {
+		t.Fatal("busca por chave acima de MaxUint32 aceita")
+	}
+	if _, err := h.remove(-1); err == nil {
+		t.Fatal("remoção de chave negativa aceita")
+	}
+
+	rid, ok, err := h.search(7)
+	if err != nil || !ok || rid.Block != 1 || h.entries != 1 {
+		t.Fatalf("search(7) = %s, %v, %v com %d entradas", rid, ok, err, h.entries)
+	}
+}
@@ -0,0 +1,358 @@
+package storage
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync/atomic"
+	"time"
+)
+
+// O bloco 0 de todo arquivo .dat é reservado para o cabeçalho (superbloco):
+// magic (4) + versão (2) + modo (1) + reservado (1) + tamanho do bloco (4) +
+// quantidade de registros (4) + data de criação em segundos Unix (8) +
+// geração (8), incrementada a cada abertura que altera o arquivo. A versão 1 tinha
+// cabeçalho de 24 bytes, sem a geração; como o bloco 0 é gravado inteiro com zeros após
+// o cabeçalho, esses arquivos são lidos com geração 0 sem mudar de versão
+const (
+	fileMagic         = "AEDS"
+	fileFormatVersion = 2
+	fileHeaderSize    = 32
+)
+
+// minFormatVersion é a versão mais antiga que o modo ainda lê. A versão 2 trocou apenas
+// o layout dos blocos do modo variável contíguo (páginas com slots); nos demais modos os
+// blocos não mudaram e a versão 1 continua válida
+func minFormatVersion(mode StorageMode) int {
+	if mode == ModeVariable {
+		return 2
+	}
+	return 1
+}
+
+type StorageMode uint8
+
+const (
+	ModeFixed StorageMode = iota + 1
+	ModeVariable
+	ModeVariableFragmented
+	ModeSorted
+)
+
+var ErrInvalidHeader = errors.New("arquivo sem cabeçalho válido")
+
+func (m StorageMode) String() string {
+	switch m {
+	case ModeFixed:
+		return "tamanho fixo"
+	case ModeVariable:
+		return "tamanho variável contíguo"
+	case ModeVariableFragmented:
+		return "tamanho variável espalhado"
+	case ModeSorted:
+		return "sequencial ordenado por matrícula"
+	}
+	return fmt.Sprintf("modo desconhecido (%d)", uint8(m))
+}
+
+type FileHeader struct {
+	Version     int
+	Mode        StorageMode
+	BlockSize   int
+	RecordCount int
+	CreatedAt   time.Time
+	Generation  uint64
+}
+
+func (h *FileHeader) encode() []byte {
+	data := make([]byte, fileHeaderSize)
+	copy(data[0:4], fileMagic)
+	binary.LittleEndian.PutUint16(data[4:6], uint16(h.Version))
+	data[6] = byte(h.Mode)
+	binary.LittleEndian.PutUint32(data[8:12], uint32(h.BlockSize))
+	binary.LittleEndian.PutUint32(data[12:16], uint32(h.RecordCount))
+	binary.LittleEndian.PutUint64(data[16:24], uint64(h.CreatedAt.Unix()))
+	binary.LittleEndian.PutUint64(data[24:32], h.Generation)
+	return data
+}
+
+func decodeFileHeader(data []byte) (*FileHeader, error) {
+	if len(data) < fileHeaderSize || string(data[0:4]) != fileMagic {
+		return nil, ErrInvalidHeader
+	}
+
+	header := &FileHeader{
+		Version:     int(binary.LittleEndian.Uint16(data[4:6])),
+		Mode:        StorageMode(data[6]),
+		BlockSize:   int(binary.LittleEndian.Uint32(data[8:12])),
+		RecordCount: int(binary.LittleEndian.Uint32(data[12:16])),
+		CreatedAt:   time.Unix(int64(binary.LittleEndian.Uint64(data[16:24])), 0),
+		Generation:  binary.LittleEndian.Uint64(data[24:32]),
+	}
+
+	if header.Version < minFormatVersion(header.Mode) || header.Version > fileFormatVersion {
+		return nil, fmt.Errorf("versão de formato %d não suportada no modo %s (esperada de %d a %d)",
+			header.Version, header.Mode, minFormatVersion(header.Mode), fileFormatVersion)
+	}
+	if header.BlockSize < fileHeaderSize {
+		return nil, fmt.Errorf("tamanho de bloco inválido no cabeçalho: %d bytes", header.BlockSize)
+	}
+
+	return header, nil
+}
+
+// ReadFileHeader lê apenas o cabeçalho, permitindo descobrir modo e tamanho do bloco
+// de um arquivo existente antes de escolher a implementação de Storage
+func ReadFileHeader(filename string) (*FileHeader, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, fmt.Errorf("erro ao abrir arquivo: %w", err)
+	}
+	defer file.Close()
+
+	data := make([]byte, fileHeaderSize)
+	if _, err := io.ReadFull(file, data); err != nil {
+		return nil, ErrInvalidHeader
+	}
+	return decodeFileHeader(data)
+}
+
+// blockFile é um arquivo de dados aberto; os números de bloco usados pelas
+// implementações de Storage começam em 0 no primeiro bloco após o cabeçalho. Os blocos
+// de dados passam pelo buffer pool compartilhado; o cabeçalho é lido e gravado direto
+type blockFile struct {
+	file        *os.File
+	path        string
+	blockSize   int
+	header      *FileHeader
+	headerDirty bool
+	modified    bool
+}
+
+func createBlockFile(filename string, mode StorageMode, blockSize int) (*blockFile, error) {
+	file, err := os.Create(filename)
+	if err != nil {
+		return nil, fmt.Errorf("erro ao criar arquivo: %w", err)
+	}
+
+	bf := &blockFile{
+		file:      file,
+		path:      poolPath(filename),
+		blockSize: blockSize,
+		header: &FileHeader{
+			Version:   fileFormatVersion,
+			Mode:      mode,
+			BlockSize: blockSize,
+			CreatedAt: time.Now(),
+		},
+	}
+
+	bufferPool.discard(bf.path, 0)
+	if err := bf.writeHeader(); err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	if _, err := file.Seek(int64(blockSize), io.SeekStart); err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	return bf, nil
+}
+
+// openBlockFile abre um arquivo existente validando o cabeçalho contra o modo e o
+// tamanho de bloco esperados; com create, um arquivo inexistente é criado vazio
+func openBlockFile(filename string, mode StorageMode, blockSize int, writable bool, create bool) (*blockFile, error) {
+	if create {
+		if _, err := os.Stat(filename); errors.Is(err, os.ErrNotExist) {
+			return createBlockFile(filename, mode, blockSize)
+		}
+	}
+
+	flag := os.O_RDONLY
+	if writable {
+		flag = os.O_RDWR
+	}
+
+	file, err := os.OpenFile(filename, flag, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("erro ao abrir arquivo: %w", err)
+	}
+
+	data := make([]byte, fileHeaderSize)
+	if _, err := file.ReadAt(data, 0); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("%s: %w", filename, ErrInvalidHeader)
+	}
+
+	header, err := decodeFileHeader(data)
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("%s: %w", filename, err)
+	}
+
+	if header.Mode != mode {
+		file.Close()
+		return nil, fmt.Errorf("arquivo %s foi gravado no modo %s, mas está sendo aberto no modo %s", filename, header.Mode, mode)
+	}
+	if header.BlockSize != blockSize {
+		file.Close()
+		return nil, fmt.Errorf("arquivo %s usa blocos de %d bytes, mas está sendo aberto com blocos de %d bytes", filename, header.BlockSize, blockSize)
+	}
+
+	return &blockFile{
+		file:      file,
+		path:      poolPath(filename),
+		blockSize: blockSize,
+		header:    header,
+	}, nil
+}
+
+func (bf *blockFile) writeHeader() error {
+	block := make([]byte, bf.blockSize)
+	copy(block, bf.header.encode())
+	if _, err := bf.file.WriteAt(block, 0); err != nil {
+		return fmt.Errorf("erro ao gravar cabeçalho: %w", err)
+	}
+	bf.headerDirty = false
+	return nil
+}
+
+// Close grava os blocos sujos desta abertura que estão no buffer pool e o cabeçalho
+// pendente (contagem de registros) e fecha o arquivo
+func (bf *blockFile) Close() error {
+	if err := bufferPool.flush(bf); err != nil {
+		bf.file.Close()
+		return err
+	}
+	if bf.headerDirty {
+		if err := bf.writeHeader(); err != nil {
+			bf.file.Close()
+			return err
+		}
+	}
+	return bf.file.Close()
+}
+
+// closeBlockFile fecha bf ao fim de uma operação que altera o arquivo, usado com defer e o
+// retorno nomeado err: como os blocos sujos só chegam ao disco no fechamento, uma falha ao
+// gravá-los é devolvida se a operação não tiver falhado antes
+func closeBlockFile(bf *blockFile, err *error) {
+	if cerr := bf.Close(); *err == nil {
+		*err = cerr
+	}
+}
+
+func (bf *blockFile) totalBlocks() int {
+	fileInfo, err := bf.file.Stat()
+	if err != nil {
+		return 0
+	}
+	total := int(fileInfo.Size())/bf.blockSize - 1
+	if total < 0 {
+		return 0
+	}
+	return total
+}
+
+func (bf *blockFile) blockOffset(blockNum int) int64 {
+	return int64(blockNum+1) * int64(bf.blockSize)
+}
+
+// blockReads conta os blocos de dados lidos por todas as aberturas, para comparar o custo
+// das organizações de arquivo
+var blockReads atomic.Int64
+
+// readBlock devolve uma cópia do bloco, que o chamador pode alterar livremente
+func (bf *blockFile) readBlock(blockNum int) ([]byte, error) {
+	blockReads.Add(1)
+	frame, err := bufferPool.pin(bf, blockNum, true)
+	if err != nil {
+		return make([]byte, bf.blockSize), err
+	}
+	block := append([]byte(nil), frame.data...)
+	bufferPool.unpin(frame, bf, false)
+	return block, nil
+}
+
+// markModified incrementa a geração na primeira alteração feita por esta abertura,
+// permitindo que arquivos auxiliares (ex.: mapa de espaço livre) detectem que estão desatualizados
+func (bf *blockFile) markModified() {
+	if bf.modified {
+		return
+	}
+	bf.modified = true
+	bf.header.Generation++
+	bf.headerDirty = true
+}
+
+// writeBlock grava o bloco no buffer pool; blocos além do fim do arquivo são gravados
+// direto em disco, para que totalBlocks continue correto
+func (bf *blockFile) writeBlock(blockNum int, block []byte) error {
+	bf.markModified()
+	if blockNum >= bf.totalBlocks() {
+		padded := make([]byte, bf.blockSize)
+		copy(padded, block)
+		bufferPool.discardBlock(bf.path, blockNum)
+		_, err := bf.file.WriteAt(padded, bf.blockOffset(blockNum))
+		return err
+	}
+
+	frame, err := bufferPool.pin(bf, blockNum, false)
+	if err != nil {
+		return err
+	}
+	clear(frame.data[copy(frame.data, block):])
+	bufferPool.unpin(frame, bf, true)
+	return nil
+}
+
+// writeAt grava dados parciais dentro de um bloco (ex.: byte de status)
+func (bf *blockFile) writeAt(blockNum int, offset int, data []byte) error {
+	bf.markModified()
+	frame, err := bufferPool.pin(bf, blockNum, true)
+	if err != nil {
+		return err
+	}
+	copy(frame.data[offset:], data)
+	bufferPool.unpin(frame, bf, true)
+	return nil
+}
+
+// appendBlock grava o próximo bloco na posição corrente do arquivo, direto em disco
+func (bf *blockFile) appendBlock(block []byte) error {
+	bf.markModified()
+	position, err := bf.file.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	bufferPool.discardBlock(bf.path, int(position/int64(bf.blockSize))-1)
+
+	padded := make([]byte, bf.blockSize)
+	copy(padded, block)
+	_, err = bf.file.Write(padded)
+	return err
+}
+
+func (bf *blockFile) seekBlock(blockNum int) error {
+	_, err := bf.file.Seek(bf.blockOffset(blockNum), io.SeekStart)
+	return err
+}
+
+func (bf *blockFile) addRecordCount(delta int) {
+	bf.header.RecordCount += delta
+	if bf.header.RecordCount < 0 {
+		bf.header.RecordCount = 0
+	}
+	bf.headerDirty = true
+}
+
+// truncate descarta os blocos a partir de totalBlocks
+func (bf *blockFile) truncate(totalBlocks int) error {
+	bf.markModified()
+	bufferPool.discard(bf.path, totalBlocks)
+	return bf.file.Truncate(bf.blockOffset(totalBlocks))
+}
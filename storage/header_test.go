@@ -0,0 +1,80 @@
+package storage
+
+import (
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// setFormatVersion troca a versão gravada no cabeçalho, simulando arquivos de outras versões
+func setFormatVersion(t *testing.T, filename string, version int) {
+	t.Helper()
+	file, err := os.OpenFile(filename, os.O_RDWR, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	data := make([]byte, 2)
+	binary.LittleEndian.PutUint16(data, uint16(version))
+	if _, err := file.WriteAt(data, 4); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFileHeaderVersionPerMode(t *testing.T) {
+	dir := t.TempDir()
+	for _, mode := range []StorageMode{ModeFixed, ModeVariable, ModeVariableFragmented, ModeSorted} {
+		filename := filepath.Join(dir, mode.String()+".dat")
+		bf, err := createBlockFile(filename, mode, 128)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := bf.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		for version := 0; version <= fileFormatVersion+1; version++ {
+			setFormatVersion(t, filename, version)
+			header, err := ReadFileHeader(filename)
+			accepted := version >= 1 && version <= fileFormatVersion && (mode != ModeVariable || version == 2)
+			if (err == nil) != accepted {
+				t.Fatalf("%s, versão %d: aceito = %v, esperado %v (%v)", mode, version, err == nil, accepted, err)
+			}
+			if err == nil && header.Version != version {
+				t.Fatalf("%s: versão lida %d, gravada %d", mode, header.Version, version)
+			}
+		}
+	}
+}
+
+func TestFileHeaderKeepsVersionOnRewrite(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "alunos.dat")
+	bf, err := createBlockFile(filename, ModeFixed, 128)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := bf.Close(); err != nil {
+		t.Fatal(err)
+	}
+	setFormatVersion(t, filename, 1)
+
+	// Um arquivo da versão 1 alterado continua na versão 1, com a geração nos bytes antes zerados
+	bf, err = openBlockFile(filename, ModeFixed, 128, true, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := bf.seekBlock(bf.totalBlocks()); err != nil {
+		t.Fatal(err)
+	}
+	if err := bf.appendBlock(make([]byte, 128)); err != nil {
+		t.Fatal(err)
+	}
+	if err := bf.Close(); err != nil {
+		t.Fatal(err)
+	}
+	header, err := ReadFileHeader(filename)
+	if err != nil || header.Version != 1 || header.Generation != 1 {
+		t.Fatalf("cabeçalho após alterar arquivo da versão 1: %+v, %v", header, err)
+	}
+}
@@ -0,0 +1,197 @@
+package storage
+
+import (
+	"aeds2-tp1/entity"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// IndexKind é a estrutura usada pelo índice primário de IndexedStorage
+type IndexKind int
+
+const (
+	IndexBPlusTree IndexKind = iota
+	IndexExtendibleHash
+)
+
+var IndexKinds = []IndexKind{IndexBPlusTree, IndexExtendibleHash}
+
+func (k IndexKind) String() string {
+	switch k {
+	case IndexBPlusTree:
+		return "árvore B+"
+	case IndexExtendibleHash:
+		return "hash extensível"
+	}
+	return fmt.Sprintf("índice desconhecido (%d)", int(k))
+}
+
+// extension é a extensão do arquivo auxiliar do índice (ex.: alunos.idx)
+func (k IndexKind) extension() string {
+	if k == IndexExtendibleHash {
+		return ".hsh"
+	}
+	return ".idx"
+}
+
+// cpfIndexExtension é o arquivo do índice secundário único de CPF, sempre uma árvore B+
+const cpfIndexExtension = ".cpf"
+
+// Arquivos dos índices secundários não únicos: listas de RecordIDs de curso e ano de
+// ingresso e a árvore B+ ordenada por CA
+const (
+	cursoIndexExtension = ".crs"
+	anoIndexExtension   = ".ano"
+	caIndexExtension    = ".ca"
+)
+
+// indexExtensions lista os arquivos de índice que Reorganize descarta junto com o original
+var indexExtensions = []string{
+	IndexBPlusTree.extension(), IndexExtendibleHash.extension(),
+	cpfIndexExtension, cursoIndexExtension, anoIndexExtension, caIndexExtension,
+}
+
+// cpfKey converte o CPF (11 dígitos) na chave numérica do índice
+func cpfKey(cpf string) int {
+	key, err := strconv.ParseInt(cpf, 10, 64)
+	if err != nil {
+		return -1
+	}
+	return int(key)
+}
+
+// cursoKey normaliza o curso para o índice: consultas não diferenciam maiúsculas
+func cursoKey(curso string) string {
+	return strings.ToLower(strings.TrimSpace(curso))
+}
+
+func anoKey(ano int) string {
+	return strconv.Itoa(ano)
+}
+
+// A chave do índice de CA junta o CA em centésimos ao RecordID, para que alunos com o
+// mesmo CA tenham chaves distintas e fiquem na ordem física: CA (10 bits) + bloco (29 bits)
+// + slot (24 bits)
+const (
+	caSlotBits  = 24
+	caBlockBits = 29
+)
+
+// caCents arredonda o CA para centésimos; consultas filtram o valor exato do registro
+func caCents(ca float64) int {
+	return int(math.Round(ca * 100))
+}
+
+// storedCA é o CA como os armazenamentos o gravam (centésimos arredondados, para que
+// regravar um registro não perca um centésimo) e o devolvem na leitura
+func storedCA(ca float64) float64 {
+	return float64(caCents(ca)) / 100
+}
+
+func caKey(ca float64, rid RecordID) (int, error) {
+	if rid.Block >= 1<<caBlockBits || rid.Slot >= 1<<caSlotBits {
+		return 0, fmt.Errorf("RecordID %v fora do alcance do índice de CA", rid)
+	}
+	return caCents(ca)<<(caBlockBits+caSlotBits) | rid.Block<<caSlotBits | rid.Slot, nil
+}
+
+// caKeyRange são as chaves do índice de CA para os CAs entre lo e hi (inclusive), limitados
+// à faixa válida de CA
+func caKeyRange(lo float64, hi float64) (int, int) {
+	lo = math.Max(lo, entity.CA_MIN)
+	hi = math.Min(hi, entity.CA_MAX)
+	return caCents(lo) << (caBlockBits + caSlotBits), (caCents(hi)+1)<<(caBlockBits+caSlotBits) - 1
+}
+
+// DuplicateKeyError indica que o valor de um campo único já pertence a outro aluno
+type DuplicateKeyError struct {
+	Field     string
+	Value     string
+	Matricula int
+}
+
+func (e *DuplicateKeyError) Error() string {
+	if e.Field == "matrícula" {
+		return fmt.Sprintf("matrícula %s já está cadastrada", e.Value)
+	}
+	return fmt.Sprintf("%s %s já pertence ao aluno de matrícula %d", e.Field, e.Value, e.Matricula)
+}
+
+// uniqueIndex mapeia uma chave única (matrícula ou CPF) para RecordID em um arquivo auxiliar
+// que registra a geração do arquivo de dados descrito
+type uniqueIndex interface {
+	search(key int) (RecordID, bool, error)
+	insert(key int, rid RecordID) error
+	remove(key int) (bool, error)
+	scan(fn func(key int, rid RecordID) bool) error
+	dataGeneration() uint64
+	stats() (*IndexStats, error)
+	save(generation uint64) error
+	close() error
+}
+
+// IndexStats descreve a ocupação do índice primário. Páginas são as folhas da árvore B+
+// ou os buckets do hash extensível
+type IndexStats struct {
+	Kind           IndexKind
+	Entries        int
+	Pages          int
+	PageCapacity   int
+	OccupancyRate  float64
+	MinPageEntries int
+	MaxPageEntries int
+
+	// Árvore B+
+	Height int
+	Nodes  int
+
+	// Hash extensível: LocalDepths[d] é a quantidade de buckets com profundidade local d
+	GlobalDepth   int
+	DirectorySize int
+	LocalDepths   []int
+}
+
+// addPage acumula as entradas de uma folha ou bucket nas estatísticas
+func (s *IndexStats) addPage(entries int) {
+	if s.Pages == 0 || entries < s.MinPageEntries {
+		s.MinPageEntries = entries
+	}
+	if entries > s.MaxPageEntries {
+		s.MaxPageEntries = entries
+	}
+	s.Pages++
+	if s.PageCapacity > 0 {
+		s.OccupancyRate = float64(s.Entries) / float64(s.Pages*s.PageCapacity) * 100
+	}
+}
+
+func openPrimaryIndex(kind IndexKind, filename string, blockSize int) (uniqueIndex, error) {
+	indexFilename := companionFilename(filename, kind.extension())
+	if kind == IndexExtendibleHash {
+		return openExtendibleHash(indexFilename, blockSize)
+	}
+	return openBPlusTree(indexFilename, blockSize)
+}
+
+// createPrimaryIndex grava um índice novo com as entradas, ordenadas por chave e sem repetição
+func createPrimaryIndex(kind IndexKind, filename string, blockSize int, generation uint64, entries []indexEntry) (uniqueIndex, error) {
+	indexFilename := companionFilename(filename, kind.extension())
+	if kind == IndexExtendibleHash {
+		return createExtendibleHash(indexFilename, blockSize, generation, entries)
+	}
+	return createBPlusTree(indexFilename, blockSize, generation, entries)
+}
+
+// removeIndexFiles apaga os índices de todos os tipos do arquivo de dados
+func removeIndexFiles(filename string) error {
+	for _, ext := range indexExtensions {
+		if err := os.Remove(companionFilename(filename, ext)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("erro ao remover índice: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,69 @@
+package storage
+
+import (
+	"aeds2-tp1/entity"
+	"testing"
+)
+
+func TestCAKeyBounds(t *testing.T) {
+	maxRID := RecordID{Block: 1<<caBlockBits - 1, Slot: 1<<caSlotBits - 1}
+	for _, rid := range []RecordID{{Block: 1 << caBlockBits}, {Slot: 1 << caSlotBits}} {
+		if _, err := caKey(5, rid); err == nil {
+			t.Fatalf("caKey aceitou o RecordID %v fora do alcance", rid)
+		}
+	}
+
+	// O CA ocupa os bits altos: a ordem das chaves é CA, depois bloco, depois slot
+	key, err := caKey(entity.CA_MAX, maxRID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key < 0 || key>>(caBlockBits+caSlotBits) != 1000 || key>>caSlotBits&(1<<caBlockBits-1) != maxRID.Block || key&(1<<caSlotBits-1) != maxRID.Slot {
+		t.Fatalf("chave %x não separa CA, bloco e slot", key)
+	}
+	ordered := []struct {
+		ca  float64
+		rid RecordID
+	}{
+		{0, RecordID{}}, {0, RecordID{Slot: 1}}, {0, RecordID{Block: 1}}, {0.01, RecordID{}}, {7.5, maxRID}, {7.51, RecordID{}},
+	}
+	previous := -1
+	for _, entry := range ordered {
+		key, err := caKey(entry.ca, entry.rid)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if key <= previous {
+			t.Fatalf("chave de (%.2f, %v) fora de ordem", entry.ca, entry.rid)
+		}
+		previous = key
+	}
+}
+
+func TestCAKeyRangeCoversWholeCents(t *testing.T) {
+	maxRID := RecordID{Block: 1<<caBlockBits - 1, Slot: 1<<caSlotBits - 1}
+	keyOf := func(ca float64, rid RecordID) int {
+		key, err := caKey(ca, rid)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return key
+	}
+
+	lo, hi := caKeyRange(7.5, 8.25)
+	if lo != keyOf(7.5, RecordID{}) || hi != keyOf(8.25, maxRID) {
+		t.Fatalf("faixa [%x, %x] não vai do primeiro RecordID de 7.50 ao último de 8.25", lo, hi)
+	}
+	if keyOf(7.49, maxRID) >= lo || keyOf(8.26, RecordID{}) <= hi {
+		t.Fatal("faixa inclui centésimos vizinhos")
+	}
+
+	// Limites fora da escala são trazidos para CA_MIN e CA_MAX
+	lo, hi = caKeyRange(-3, 42)
+	if lo != keyOf(entity.CA_MIN, RecordID{}) || hi != keyOf(entity.CA_MAX, maxRID) {
+		t.Fatalf("faixa [%x, %x] não foi limitada à escala do CA", lo, hi)
+	}
+	if lo, hi = caKeyRange(9, 8); lo <= hi {
+		t.Fatal("faixa invertida não ficou vazia")
+	}
+}
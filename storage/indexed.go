@@ -0,0 +1,804 @@
+package storage
+
+import (
+	"aeds2-tp1/entity"
+	"fmt"
+	"sort"
+	"strconv"
+)
+
+// IndexedStorage acrescenta a qualquer Storage índices em disco que evitam varrer o arquivo
+// nas consultas por chave e rejeitam matrículas e CPFs repetidos com DuplicateKeyError
+type IndexedStorage struct {
+	Storage
+	kind IndexKind
+}
+
+// indexSet são os índices abertos durante uma operação. Em arquivos antigos com chaves
+// repetidas, os índices únicos apontam para o último registro na ordem física
+// (FindDuplicateMatriculas lista as matrículas repetidas)
+type indexSet struct {
+	// primary leva a matrícula ao RecordID (árvore B+ em .idx ou hash extensível em .hsh)
+	primary uniqueIndex
+	// cpf é a árvore B+ única de CPF (.cpf)
+	cpf uniqueIndex
+	// curso e ano guardam a lista de RecordIDs de cada valor (.crs e .ano)
+	curso *postingIndex
+	ano   *postingIndex
+	// ca é a árvore B+ das consultas por faixa de CA (.ca)
+	ca *bplusTree
+}
+
+func NewIndexedStorage(inner Storage) *IndexedStorage {
+	return &IndexedStorage{Storage: inner}
+}
+
+// Unwrap devolve a implementação de armazenamento indexada
+func (s *IndexedStorage) Unwrap() Storage {
+	return s.Storage
+}
+
+// SetIndexKind troca a estrutura do índice primário; o novo índice é montado na próxima
+// operação que precisar dele
+func (s *IndexedStorage) SetIndexKind(kind IndexKind) {
+	s.kind = kind
+}
+
+func (s *IndexedStorage) GetIndexKind() IndexKind {
+	return s.kind
+}
+
+// IndexStats descreve a ocupação do índice primário do arquivo
+func (s *IndexedStorage) IndexStats(filename string) (*IndexStats, error) {
+	set, err := s.openIndexes(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer set.close()
+	return set.primary.stats()
+}
+
+// openIndexes abre os índices do arquivo. Cada índice guarda a geração do arquivo de dados
+// que descreve; os ausentes ou desatualizados (ex.: alterado por outro programa) são
+// reconstruídos com ScanStudents
+func (s *IndexedStorage) openIndexes(filename string) (*indexSet, error) {
+	header, err := ReadFileHeader(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	set := &indexSet{}
+	if index, err := openPrimaryIndex(s.kind, filename, header.BlockSize); err == nil {
+		if index.dataGeneration() == header.Generation {
+			set.primary = index
+		} else {
+			index.close()
+		}
+	}
+	if index, err := openBPlusTree(companionFilename(filename, cpfIndexExtension), header.BlockSize); err == nil {
+		if index.dataGeneration() == header.Generation {
+			set.cpf = index
+		} else {
+			index.close()
+		}
+	}
+
+	if index, err := openPostingIndex(companionFilename(filename, cursoIndexExtension), header.BlockSize); err == nil {
+		if index.dataGeneration() == header.Generation {
+			set.curso = index
+		} else {
+			index.close()
+		}
+	}
+	if index, err := openPostingIndex(companionFilename(filename, anoIndexExtension), header.BlockSize); err == nil {
+		if index.dataGeneration() == header.Generation {
+			set.ano = index
+		} else {
+			index.close()
+		}
+	}
+
+	if index, err := openBPlusTree(companionFilename(filename, caIndexExtension), header.BlockSize); err == nil {
+		if index.dataGeneration() == header.Generation {
+			set.ca = index
+		} else {
+			index.close()
+		}
+	}
+
+	if set.primary == nil || set.cpf == nil || set.curso == nil || set.ano == nil || set.ca == nil {
+		if err := s.rebuildIndexes(filename, header, set); err != nil {
+			set.close()
+			return nil, err
+		}
+	}
+	return set, nil
+}
+
+// rebuildIndexes monta, com uma única varredura do arquivo, os índices ausentes do conjunto
+func (s *IndexedStorage) rebuildIndexes(filename string, header *FileHeader, set *indexSet) error {
+	primary := make([]indexEntry, 0, header.RecordCount)
+	cpf := make([]indexEntry, 0, header.RecordCount)
+	curso := make([]postingEntry, 0, header.RecordCount)
+	ano := make([]postingEntry, 0, header.RecordCount)
+	ca := make([]indexEntry, 0, header.RecordCount)
+	var keyErr error
+	err := s.Storage.ScanStudents(filename, func(rid RecordID, student *entity.Student) bool {
+		key, err := caKey(student.CA, rid)
+		if err != nil {
+			keyErr = err
+			return false
+		}
+		ca = append(ca, indexEntry{key: key, rid: rid})
+		primary = append(primary, indexEntry{key: student.Matricula, rid: rid})
+		cpf = append(cpf, indexEntry{key: cpfKey(student.CPF), rid: rid})
+		curso = append(curso, postingEntry{key: cursoKey(student.Curso), rid: rid})
+		ano = append(ano, postingEntry{key: anoKey(student.AnoIngresso), rid: rid})
+		return true
+	})
+	if err == nil {
+		err = keyErr
+	}
+	if err != nil {
+		return err
+	}
+
+	if set.primary == nil {
+		set.primary, err = createPrimaryIndex(s.kind, filename, header.BlockSize, header.Generation, uniqueEntries(primary))
+		if err != nil {
+			return err
+		}
+	}
+	if set.cpf == nil {
+		set.cpf, err = createBPlusTree(companionFilename(filename, cpfIndexExtension), header.BlockSize, header.Generation, uniqueEntries(cpf))
+		if err != nil {
+			return err
+		}
+	}
+	if set.curso == nil {
+		set.curso, err = createPostingIndex(companionFilename(filename, cursoIndexExtension), header.BlockSize, header.Generation, curso)
+		if err != nil {
+			return err
+		}
+	}
+	if set.ano == nil {
+		set.ano, err = createPostingIndex(companionFilename(filename, anoIndexExtension), header.BlockSize, header.Generation, ano)
+		if err != nil {
+			return err
+		}
+	}
+	if set.ca == nil {
+		set.ca, err = createBPlusTree(companionFilename(filename, caIndexExtension), header.BlockSize, header.Generation, uniqueEntries(ca))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// uniqueEntries ordena as entradas por chave de forma estável e, com chaves repetidas,
+// mantém a última na ordem física, como aconteceria com inserções sucessivas
+func uniqueEntries(entries []indexEntry) []indexEntry {
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].key < entries[j].key })
+	unique := entries[:0]
+	for _, entry := range entries {
+		if len(unique) > 0 && unique[len(unique)-1].key == entry.key {
+			unique[len(unique)-1] = entry
+			continue
+		}
+		unique = append(unique, entry)
+	}
+	return unique
+}
+
+// save associa os índices à geração do arquivo de dados após a alteração e os fecha
+func (set *indexSet) save(filename string) error {
+	header, err := ReadFileHeader(filename)
+	if err != nil {
+		set.close()
+		return err
+	}
+
+	err = set.primary.save(header.Generation)
+	for _, saveErr := range []error{
+		set.cpf.save(header.Generation),
+		set.curso.save(header.Generation),
+		set.ano.save(header.Generation),
+		set.ca.save(header.Generation),
+	} {
+		if err == nil {
+			err = saveErr
+		}
+	}
+	return err
+}
+
+// close fecha os índices sem atualizar a geração: se o arquivo de dados foi alterado, eles
+// serão reconstruídos na próxima operação
+func (set *indexSet) close() {
+	if set.primary != nil {
+		set.primary.close()
+	}
+	if set.cpf != nil {
+		set.cpf.close()
+	}
+	if set.curso != nil {
+		set.curso.close()
+	}
+	if set.ano != nil {
+		set.ano.close()
+	}
+	if set.ca != nil {
+		set.ca.close()
+	}
+}
+
+// RebuildIndex descarta os índices atuais e os monta novamente a partir do arquivo de dados
+func (s *IndexedStorage) RebuildIndex(filename string) error {
+	header, err := ReadFileHeader(filename)
+	if err != nil {
+		return err
+	}
+
+	set := &indexSet{}
+	if err := s.rebuildIndexes(filename, header, set); err != nil {
+		set.close()
+		return err
+	}
+	set.close()
+	return nil
+}
+
+// lookup devolve o RecordID da matrícula consultando o índice primário
+func (s *IndexedStorage) lookup(filename string, matricula int) (RecordID, error) {
+	set, err := s.openIndexes(filename)
+	if err != nil {
+		return RecordID{}, err
+	}
+	defer set.close()
+
+	rid, found, err := set.primary.search(matricula)
+	if err != nil {
+		return RecordID{}, err
+	}
+	if !found {
+		return RecordID{}, fmt.Errorf("aluno com matrícula %d não encontrado", matricula)
+	}
+	return rid, nil
+}
+
+// checkCPF rejeita o CPF se ele já pertencer a um registro diferente de rid
+func (s *IndexedStorage) checkCPF(filename string, set *indexSet, student entity.Student, rid *RecordID) error {
+	current, found, err := set.cpf.search(cpfKey(student.CPF))
+	if err != nil || !found || (rid != nil && current == *rid) {
+		return err
+	}
+
+	owner, err := s.Storage.GetByRID(filename, current)
+	if err != nil {
+		return err
+	}
+	return &DuplicateKeyError{Field: "CPF", Value: student.CPF, Matricula: owner.Matricula}
+}
+
+// checkMatricula rejeita a matrícula se ela já pertencer a um registro diferente de rid
+func checkMatricula(set *indexSet, student entity.Student, rid *RecordID) error {
+	current, found, err := set.primary.search(student.Matricula)
+	if err != nil || !found || (rid != nil && current == *rid) {
+		return err
+	}
+	return duplicateMatriculaError(student.Matricula)
+}
+
+// checkBatchCPF rejeita lotes com o mesmo CPF em dois alunos
+func checkBatchCPF(students []entity.Student) error {
+	seen := make(map[int]int, len(students))
+	for _, student := range students {
+		if matricula, ok := seen[cpfKey(student.CPF)]; ok {
+			return &DuplicateKeyError{Field: "CPF", Value: student.CPF, Matricula: matricula}
+		}
+		seen[cpfKey(student.CPF)] = student.Matricula
+	}
+	return nil
+}
+
+// WriteStudents cria um arquivo novo, cuja geração recomeça: índices de outro tipo deixados
+// pelo arquivo anterior são apagados para não serem confundidos com índices atuais
+func (s *IndexedStorage) WriteStudents(filename string, students []entity.Student) error {
+	if err := checkBatchMatriculas(students); err != nil {
+		return err
+	}
+	if err := checkBatchCPF(students); err != nil {
+		return err
+	}
+	if err := removeIndexFiles(filename); err != nil {
+		return err
+	}
+	if err := s.Storage.WriteStudents(filename, students); err != nil {
+		return err
+	}
+	return s.RebuildIndex(filename)
+}
+
+func (s *IndexedStorage) FindStudentByMatricula(filename string, matricula int) (*entity.Student, error) {
+	rid, err := s.lookup(filename, matricula)
+	if err != nil {
+		return nil, err
+	}
+	return s.Storage.GetByRID(filename, rid)
+}
+
+func (s *IndexedStorage) FindStudentByCPF(filename string, cpf string) (*entity.Student, error) {
+	set, err := s.openIndexes(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer set.close()
+
+	rid, found, err := set.cpf.search(cpfKey(cpf))
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, fmt.Errorf("aluno com CPF %s não encontrado", cpf)
+	}
+	return s.Storage.GetByRID(filename, rid)
+}
+
+// FindStudentsByCurso lê a lista do curso no índice e só os blocos que contêm esses alunos
+func (s *IndexedStorage) FindStudentsByCurso(filename string, curso string) ([]*entity.Student, error) {
+	return s.findStudentsByPosting(filename, func(set *indexSet) ([]RecordID, error) {
+		return set.curso.list(cursoKey(curso))
+	})
+}
+
+// FindStudentsByAnoIngresso lê a lista do ano no índice e só os blocos que contêm esses alunos
+func (s *IndexedStorage) FindStudentsByAnoIngresso(filename string, ano int) ([]*entity.Student, error) {
+	return s.findStudentsByPosting(filename, func(set *indexSet) ([]RecordID, error) {
+		return set.ano.list(anoKey(ano))
+	})
+}
+
+// findStudentsByPosting lê os registros da lista de RecordIDs na ordem física, como a varredura
+func (s *IndexedStorage) findStudentsByPosting(filename string, list func(set *indexSet) ([]RecordID, error)) ([]*entity.Student, error) {
+	set, err := s.openIndexes(filename)
+	if err != nil {
+		return nil, err
+	}
+	rids, err := list(set)
+	set.close()
+	if err != nil {
+		return nil, err
+	}
+
+	sortRecordIDs(rids)
+	students := make([]*entity.Student, 0, len(rids))
+	for _, rid := range rids {
+		student, err := s.Storage.GetByRID(filename, rid)
+		if err != nil {
+			return nil, err
+		}
+		students = append(students, student)
+	}
+	return students, nil
+}
+
+// sortRecordIDs ordena os RecordIDs na ordem física do arquivo
+func sortRecordIDs(rids []RecordID) {
+	sort.Slice(rids, func(i, j int) bool {
+		if rids[i].Block != rids[j].Block {
+			return rids[i].Block < rids[j].Block
+		}
+		return rids[i].Slot < rids[j].Slot
+	})
+}
+
+// ScanStudentsByCA percorre as folhas da árvore de CA entre as chaves da faixa e entrega os
+// alunos em ordem de CA, lendo só os blocos que os contêm
+func (s *IndexedStorage) ScanStudentsByCA(filename string, min float64, max float64, fn func(student *entity.Student) bool) error {
+	set, err := s.openIndexes(filename)
+	if err != nil {
+		return err
+	}
+
+	var rids []RecordID
+	lo, hi := caKeyRange(min, max)
+	err = set.ca.scanRange(lo, hi, func(_ int, rid RecordID) bool {
+		rids = append(rids, rid)
+		return true
+	})
+	set.close()
+	if err != nil {
+		return err
+	}
+
+	return s.streamRecords(filename, rids, func(student *entity.Student) bool {
+		return student.CA < min || student.CA > max || fn(student)
+	})
+}
+
+// ScanStudentsByAnoIngresso percorre em ordem as chaves do índice de ano dentro da faixa e
+// entrega os alunos de cada ano na ordem física
+func (s *IndexedStorage) ScanStudentsByAnoIngresso(filename string, min int, max int, fn func(student *entity.Student) bool) error {
+	set, err := s.openIndexes(filename)
+	if err != nil {
+		return err
+	}
+
+	var rids []RecordID
+	for _, key := range set.ano.keysBetween(anoKey(min), anoKey(max), lessAnoKey) {
+		list, err := set.ano.list(key)
+		if err != nil {
+			set.close()
+			return err
+		}
+		sortRecordIDs(list)
+		rids = append(rids, list...)
+	}
+	set.close()
+
+	return s.streamRecords(filename, rids, fn)
+}
+
+func lessAnoKey(a, b string) bool {
+	x, _ := strconv.Atoi(a)
+	y, _ := strconv.Atoi(b)
+	return x < y
+}
+
+// streamRecords lê os registros na ordem dos RecordIDs até fn devolver false
+func (s *IndexedStorage) streamRecords(filename string, rids []RecordID, fn func(student *entity.Student) bool) error {
+	for _, rid := range rids {
+		student, err := s.Storage.GetByRID(filename, rid)
+		if err != nil {
+			return err
+		}
+		if !fn(student) {
+			return nil
+		}
+	}
+	return nil
+}
+
+func (s *IndexedStorage) AddStudents(filename string, students []entity.Student) error {
+	_, err := s.insertStudents(filename, students)
+	return err
+}
+
+func (s *IndexedStorage) InsertStudent(filename string, student entity.Student) (RecordID, error) {
+	rids, err := s.insertStudents(filename, []entity.Student{student})
+	if err != nil {
+		return RecordID{}, err
+	}
+	return rids[0], nil
+}
+
+// writer devolve a gravação sem verificação de matrícula do armazenamento indexado
+func (s *IndexedStorage) writer() (recordWriter, error) {
+	writer, ok := s.Storage.(recordWriter)
+	if !ok {
+		return nil, fmt.Errorf("armazenamento %T não aceita gravação indexada", s.Storage)
+	}
+	return writer, nil
+}
+
+// insertStudents valida as matrículas e os CPFs do lote inteiro pelos índices, grava o lote
+// com uma única abertura do arquivo e registra nos índices o RecordID de cada aluno
+func (s *IndexedStorage) insertStudents(filename string, students []entity.Student) ([]RecordID, error) {
+	if err := checkBatchMatriculas(students); err != nil {
+		return nil, err
+	}
+	if err := checkBatchCPF(students); err != nil {
+		return nil, err
+	}
+	if _, err := ReadFileHeader(filename); err != nil {
+		if err := s.WriteStudents(filename, nil); err != nil {
+			return nil, err
+		}
+	}
+
+	writer, err := s.writer()
+	if err != nil {
+		return nil, err
+	}
+
+	set, err := s.openIndexes(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, student := range students {
+		if err := checkMatricula(set, student, nil); err != nil {
+			set.close()
+			return nil, err
+		}
+		if err := s.checkCPF(filename, set, student, nil); err != nil {
+			set.close()
+			return nil, err
+		}
+	}
+
+	rids, err := writer.insertRecords(filename, students)
+	if err != nil {
+		set.close()
+		return nil, err
+	}
+	for i, student := range students {
+		rid := rids[i]
+		if err := set.primary.insert(student.Matricula, rid); err != nil {
+			set.close()
+			return nil, err
+		}
+		if err := set.cpf.insert(cpfKey(student.CPF), rid); err != nil {
+			set.close()
+			return nil, err
+		}
+		if err := set.curso.add(cursoKey(student.Curso), rid); err != nil {
+			set.close()
+			return nil, err
+		}
+		if err := set.ano.add(anoKey(student.AnoIngresso), rid); err != nil {
+			set.close()
+			return nil, err
+		}
+		if err := insertCA(set.ca, storedCA(student.CA), rid); err != nil {
+			set.close()
+			return nil, err
+		}
+	}
+	return rids, set.save(filename)
+}
+
+func (s *IndexedStorage) UpdateStudent(filename string, student entity.Student) error {
+	rid, err := s.lookup(filename, student.Matricula)
+	if err != nil {
+		return err
+	}
+	if _, err := s.UpdateByRID(filename, rid, student); err != nil {
+		return err
+	}
+	return s.checkAutoReorganize(filename)
+}
+
+// UpdateByRID atualiza os índices quando o registro é realocado ou muda de matrícula ou CPF
+func (s *IndexedStorage) UpdateByRID(filename string, rid RecordID, student entity.Student) (RecordID, error) {
+	writer, err := s.writer()
+	if err != nil {
+		return RecordID{}, err
+	}
+	old, err := s.Storage.GetByRID(filename, rid)
+	if err != nil {
+		return RecordID{}, err
+	}
+
+	set, err := s.openIndexes(filename)
+	if err != nil {
+		return RecordID{}, err
+	}
+	if err := checkMatricula(set, student, &rid); err != nil {
+		set.close()
+		return RecordID{}, err
+	}
+	if err := s.checkCPF(filename, set, student, &rid); err != nil {
+		set.close()
+		return RecordID{}, err
+	}
+
+	newRID, err := writer.updateRecord(filename, rid, student)
+	if err != nil {
+		set.close()
+		return RecordID{}, err
+	}
+
+	if err := set.replace(old, student, rid, newRID); err != nil {
+		set.close()
+		return RecordID{}, err
+	}
+	return newRID, set.save(filename)
+}
+
+// replace troca as entradas do registro antigo pelas do registro atualizado
+func (set *indexSet) replace(old *entity.Student, student entity.Student, rid RecordID, newRID RecordID) error {
+	if old.Matricula != student.Matricula {
+		if err := removeEntry(set.primary, old.Matricula, rid); err != nil {
+			return err
+		}
+	}
+	if err := set.primary.insert(student.Matricula, newRID); err != nil {
+		return err
+	}
+
+	if old.CPF != student.CPF {
+		if err := removeEntry(set.cpf, cpfKey(old.CPF), rid); err != nil {
+			return err
+		}
+	}
+	if err := set.cpf.insert(cpfKey(student.CPF), newRID); err != nil {
+		return err
+	}
+
+	if err := replacePosting(set.curso, cursoKey(old.Curso), cursoKey(student.Curso), rid, newRID); err != nil {
+		return err
+	}
+	if err := replacePosting(set.ano, anoKey(old.AnoIngresso), anoKey(student.AnoIngresso), rid, newRID); err != nil {
+		return err
+	}
+
+	if caCents(old.CA) == caCents(storedCA(student.CA)) && rid == newRID {
+		return nil
+	}
+	if err := removeCA(set.ca, old.CA, rid); err != nil {
+		return err
+	}
+	return insertCA(set.ca, storedCA(student.CA), newRID)
+}
+
+func insertCA(index *bplusTree, ca float64, rid RecordID) error {
+	key, err := caKey(ca, rid)
+	if err != nil {
+		return err
+	}
+	return index.insert(key, rid)
+}
+
+func removeCA(index *bplusTree, ca float64, rid RecordID) error {
+	key, err := caKey(ca, rid)
+	if err != nil {
+		return err
+	}
+	_, err = index.remove(key)
+	return err
+}
+
+// replacePosting move o RecordID para a lista da nova chave se a chave ou o RecordID mudou
+func replacePosting(index *postingIndex, oldKey string, key string, rid RecordID, newRID RecordID) error {
+	if oldKey == key && rid == newRID {
+		return nil
+	}
+	if _, err := index.remove(oldKey, rid); err != nil {
+		return err
+	}
+	return index.add(key, newRID)
+}
+
+func (s *IndexedStorage) DeleteStudent(filename string, matricula int) error {
+	rid, err := s.lookup(filename, matricula)
+	if err != nil {
+		return err
+	}
+	if err := s.DeleteByRID(filename, rid); err != nil {
+		return err
+	}
+	return s.checkAutoReorganize(filename)
+}
+
+func (s *IndexedStorage) DeleteByRID(filename string, rid RecordID) error {
+	old, err := s.Storage.GetByRID(filename, rid)
+	if err != nil {
+		return err
+	}
+
+	set, err := s.openIndexes(filename)
+	if err != nil {
+		return err
+	}
+
+	if err := s.Storage.DeleteByRID(filename, rid); err != nil {
+		set.close()
+		return err
+	}
+	if err := removeEntry(set.primary, old.Matricula, rid); err != nil {
+		set.close()
+		return err
+	}
+	if err := removeEntry(set.cpf, cpfKey(old.CPF), rid); err != nil {
+		set.close()
+		return err
+	}
+	if _, err := set.curso.remove(cursoKey(old.Curso), rid); err != nil {
+		set.close()
+		return err
+	}
+	if _, err := set.ano.remove(anoKey(old.AnoIngresso), rid); err != nil {
+		set.close()
+		return err
+	}
+	if err := removeCA(set.ca, old.CA, rid); err != nil {
+		set.close()
+		return err
+	}
+	return set.save(filename)
+}
+
+// removeEntry só apaga a entrada se ela ainda apontar para rid (outra cópia da mesma
+// chave pode ser a indexada)
+func removeEntry(index uniqueIndex, key int, rid RecordID) error {
+	current, found, err := index.search(key)
+	if err != nil || !found || current != rid {
+		return err
+	}
+	_, err = index.remove(key)
+	return err
+}
+
+// Reorganize muda todos os RecordIDs; os índices antigos são descartados junto com o
+// arquivo original e reconstruídos
+func (s *IndexedStorage) Reorganize(filename string) (*ReorganizationReport, error) {
+	report, err := s.Storage.Reorganize(filename)
+	if err != nil {
+		return nil, err
+	}
+	return report, s.RebuildIndex(filename)
+}
+
+// CompactBlocks compacta o armazenamento variável contíguo e aponta as entradas dos registros
+// fundidos em outro bloco para o novo RecordID, mantendo os índices atualizados sem reconstruí-los
+func (s *IndexedStorage) CompactBlocks(filename string, options CompactionOptions) (*CompactionReport, error) {
+	vs, ok := s.Storage.(*VariableStorage)
+	if !ok {
+		return nil, fmt.Errorf("a compactação incremental só se aplica ao armazenamento variável contíguo")
+	}
+
+	set, err := s.openIndexes(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	report, err := vs.CompactBlocks(filename, options)
+	if err != nil {
+		set.close()
+		return nil, err
+	}
+
+	for _, move := range report.Moves {
+		student, err := vs.GetByRID(filename, move.To)
+		if err != nil {
+			set.close()
+			return nil, err
+		}
+		if err := set.move(student, move.From, move.To); err != nil {
+			set.close()
+			return nil, err
+		}
+	}
+	return report, set.save(filename)
+}
+
+// move aponta para to as entradas do registro que estava em from
+func (set *indexSet) move(student *entity.Student, from RecordID, to RecordID) error {
+	if err := moveEntry(set.primary, student.Matricula, from, to); err != nil {
+		return err
+	}
+	if err := moveEntry(set.cpf, cpfKey(student.CPF), from, to); err != nil {
+		return err
+	}
+	if err := replacePosting(set.curso, cursoKey(student.Curso), cursoKey(student.Curso), from, to); err != nil {
+		return err
+	}
+	if err := replacePosting(set.ano, anoKey(student.AnoIngresso), anoKey(student.AnoIngresso), from, to); err != nil {
+		return err
+	}
+	if err := removeCA(set.ca, student.CA, from); err != nil {
+		return err
+	}
+	return insertCA(set.ca, student.CA, to)
+}
+
+// moveEntry só troca a entrada se ela apontar para from (outra cópia da mesma chave pode
+// ser a indexada)
+func moveEntry(index uniqueIndex, key int, from RecordID, to RecordID) error {
+	current, found, err := index.search(key)
+	if err != nil || !found || current != from {
+		return err
+	}
+	return index.insert(key, to)
+}
+
+// checkAutoReorganize mantém a reorganização automática do armazenamento indexado, que as
+// operações por RecordID não disparam
+func (s *IndexedStorage) checkAutoReorganize(filename string) error {
+	if vs, ok := s.Storage.(*VariableStorage); ok {
+		return vs.checkAutoReorganize(filename)
+	}
+	return nil
+}
@@ -0,0 +1,371 @@
+package storage
+
+import (
+	"aeds2-tp1/domain"
+	"aeds2-tp1/entity"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// indexedTestStorages são os armazenamentos que o menu envolve com IndexedStorage
+func indexedTestStorages(t *testing.T) map[string]Storage {
+	t.Helper()
+	fixed, err := NewFixedStorage(1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	variable, err := NewVariableStorage(1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fragmented, err := NewVariableFragmentedStorage(1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sorted, err := NewSortedStorage(1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return map[string]Storage{"fixo": fixed, "variável": variable, "fragmentado": fragmented, "ordenado": sorted}
+}
+
+func TestIndexedAddStudentsWritesBatchInOneOpen(t *testing.T) {
+	for name, inner := range indexedTestStorages(t) {
+		s := NewIndexedStorage(inner)
+		filename := filepath.Join(t.TempDir(), "alunos.dat")
+		generator := domain.NewStudentGenerator()
+		students := generator.Generate(300)
+		if err := s.WriteStudents(filename, students); err != nil {
+			t.Fatal(err)
+		}
+
+		before, err := ReadFileHeader(filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		added, err := generator.GenerateFrom(100000301, 500)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := s.AddStudents(filename, added); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+
+		// Cada abertura que altera o arquivo incrementa a geração uma vez
+		after, err := ReadFileHeader(filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if after.Generation != before.Generation+1 || after.RecordCount != len(students)+len(added) {
+			t.Fatalf("%s: geração %d -> %d e %d registros após inserir o lote", name, before.Generation, after.Generation, after.RecordCount)
+		}
+
+		checkIndexesConsistent(t, s, filename, len(students)+len(added))
+		for _, student := range added {
+			got, err := s.FindStudentByCPF(filename, student.CPF)
+			if err != nil {
+				t.Fatalf("%s: %v", name, err)
+			}
+			checkSameStudent(t, got, student)
+		}
+	}
+}
+
+func TestIndexedFindStudentByCPF(t *testing.T) {
+	for name, inner := range indexedTestStorages(t) {
+		s := NewIndexedStorage(inner)
+		filename := filepath.Join(t.TempDir(), "alunos.dat")
+		students := domain.NewStudentGenerator().Generate(200)
+		if err := s.WriteStudents(filename, students); err != nil {
+			t.Fatal(err)
+		}
+		for _, student := range students {
+			got, err := s.FindStudentByCPF(filename, student.CPF)
+			if err != nil {
+				t.Fatalf("%s: %v", name, err)
+			}
+			checkSameStudent(t, got, student)
+		}
+		if _, err := s.FindStudentByCPF(filename, "00000000000"); err == nil {
+			t.Fatalf("%s: CPF inexistente encontrado", name)
+		}
+
+		// O CPF de outro aluno é rejeitado na inserção e na atualização
+		var keyErr *DuplicateKeyError
+		owner := students[40]
+		added, err := domain.NewStudentGenerator().GenerateFrom(100000201, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		added[0].CPF = owner.CPF
+		if err := s.AddStudents(filename, added); !errors.As(err, &keyErr) || keyErr.Field != "CPF" || keyErr.Matricula != owner.Matricula {
+			t.Fatalf("%s: AddStudents com CPF repetido: %v", name, err)
+		}
+		if _, err := s.FindStudentByMatricula(filename, added[1].Matricula); err == nil {
+			t.Fatalf("%s: lote rejeitado gravado em parte", name)
+		}
+		changed := students[10]
+		changed.CPF = owner.CPF
+		if err := s.UpdateStudent(filename, changed); !errors.As(err, &keyErr) || keyErr.Matricula != owner.Matricula {
+			t.Fatalf("%s: UpdateStudent com CPF de outro aluno: %v", name, err)
+		}
+
+		// Trocar o CPF libera o antigo, que pode ser usado por um novo aluno
+		changed.CPF = added[1].CPF
+		if err := s.UpdateStudent(filename, changed); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if _, err := s.FindStudentByCPF(filename, students[10].CPF); err == nil {
+			t.Fatalf("%s: CPF antigo ainda encontrado após a atualização", name)
+		}
+		if got, err := s.FindStudentByCPF(filename, changed.CPF); err != nil || got.Matricula != changed.Matricula {
+			t.Fatalf("%s: FindStudentByCPF do CPF novo: %v", name, err)
+		}
+
+		if err := s.DeleteStudent(filename, owner.Matricula); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := s.FindStudentByCPF(filename, owner.CPF); err == nil {
+			t.Fatalf("%s: CPF de aluno removido encontrado", name)
+		}
+		added[1].CPF = students[10].CPF
+		if err := s.AddStudents(filename, added); err != nil {
+			t.Fatalf("%s: CPFs liberados recusados: %v", name, err)
+		}
+		for _, student := range added {
+			if got, err := s.FindStudentByCPF(filename, student.CPF); err != nil || got.Matricula != student.Matricula {
+				t.Fatalf("%s: FindStudentByCPF(%s): %v", name, student.CPF, err)
+			}
+		}
+		checkIndexesConsistent(t, s, filename, len(students)+1)
+	}
+}
+
+func TestIndexedWriteStudentsRejectsRepeatedCPF(t *testing.T) {
+	s := NewIndexedStorage(indexedTestStorages(t)["fixo"])
+	students := domain.NewStudentGenerator().Generate(20)
+	students[15].CPF = students[3].CPF
+
+	var keyErr *DuplicateKeyError
+	err := s.WriteStudents(filepath.Join(t.TempDir(), "alunos.dat"), students)
+	if !errors.As(err, &keyErr) || keyErr.Field != "CPF" || keyErr.Matricula != students[3].Matricula {
+		t.Fatalf("lote com CPF repetido: %v", err)
+	}
+}
+
+// scanMatriculas devolve, na ordem física da varredura, as matrículas que atendem a match
+func scanMatriculas(t *testing.T, s Storage, filename string, match func(student *entity.Student) bool) []int {
+	t.Helper()
+	var matriculas []int
+	err := s.ScanStudents(filename, func(_ RecordID, student *entity.Student) bool {
+		if match(student) {
+			matriculas = append(matriculas, student.Matricula)
+		}
+		return true
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return matriculas
+}
+
+func checkMatriculas(t *testing.T, label string, got []*entity.Student, want []int) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("%s: %d alunos, esperados %d", label, len(got), len(want))
+	}
+	for i, student := range got {
+		if student.Matricula != want[i] {
+			t.Fatalf("%s: posição %d com a matrícula %d, esperada %d", label, i, student.Matricula, want[i])
+		}
+	}
+}
+
+func TestIndexedFindStudentsByCursoAndAno(t *testing.T) {
+	for name, inner := range indexedTestStorages(t) {
+		s := NewIndexedStorage(inner)
+		filename := filepath.Join(t.TempDir(), "alunos.dat")
+		students := domain.NewStudentGenerator().Generate(600)
+		if err := s.WriteStudents(filename, students); err != nil {
+			t.Fatal(err)
+		}
+
+		check := func() {
+			t.Helper()
+			cursos := make(map[string]bool)
+			anos := make(map[int]bool)
+			err := s.ScanStudents(filename, func(_ RecordID, student *entity.Student) bool {
+				cursos[student.Curso] = true
+				anos[student.AnoIngresso] = true
+				return true
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// A consulta de curso ignora maiúsculas e espaços nas pontas
+			for curso := range cursos {
+				got, err := s.FindStudentsByCurso(filename, "  "+strings.ToUpper(curso)+" ")
+				if err != nil {
+					t.Fatal(err)
+				}
+				checkMatriculas(t, name+" curso "+curso, got, scanMatriculas(t, s, filename, func(student *entity.Student) bool {
+					return student.Curso == curso
+				}))
+			}
+			for ano := range anos {
+				got, err := s.FindStudentsByAnoIngresso(filename, ano)
+				if err != nil {
+					t.Fatal(err)
+				}
+				checkMatriculas(t, fmt.Sprintf("%s ano %d", name, ano), got, scanMatriculas(t, s, filename, func(student *entity.Student) bool {
+					return student.AnoIngresso == ano
+				}))
+			}
+		}
+		check()
+
+		// Atualizações movem o aluno entre as listas; remoções o tiram delas
+		for i, student := range students[:60] {
+			switch i % 3 {
+			case 0:
+				student.Curso = "Curso Novo"
+				student.AnoIngresso = 2001
+				if err := s.UpdateStudent(filename, student); err != nil {
+					t.Fatalf("%s: %v", name, err)
+				}
+			case 1:
+				student.Nome = strings.Repeat("N", entity.MaxNomeLength)
+				if err := s.UpdateStudent(filename, student); err != nil {
+					t.Fatalf("%s: %v", name, err)
+				}
+			default:
+				if err := s.DeleteStudent(filename, student.Matricula); err != nil {
+					t.Fatalf("%s: %v", name, err)
+				}
+			}
+		}
+		check()
+		if got, err := s.FindStudentsByCurso(filename, "curso novo"); err != nil || len(got) != 20 {
+			t.Fatalf("%s: %d alunos no curso novo, %v", name, len(got), err)
+		}
+		if got, err := s.FindStudentsByCurso(filename, "Inexistente"); err != nil || len(got) != 0 {
+			t.Fatalf("%s: curso inexistente com %d alunos, %v", name, len(got), err)
+		}
+		if got, err := s.FindStudentsByAnoIngresso(filename, 1900); err != nil || len(got) != 0 {
+			t.Fatalf("%s: ano sem alunos com %d alunos, %v", name, len(got), err)
+		}
+	}
+}
+
+// collectScan devolve os alunos entregues por scan até fn parar em limit alunos (0 = todos)
+func collectScan(t *testing.T, limit int, scan func(fn func(student *entity.Student) bool) error) []*entity.Student {
+	t.Helper()
+	var got []*entity.Student
+	err := scan(func(student *entity.Student) bool {
+		got = append(got, student)
+		return limit == 0 || len(got) < limit
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return got
+}
+
+func TestIndexedScanStudentsByCA(t *testing.T) {
+	for name, inner := range indexedTestStorages(t) {
+		s := NewIndexedStorage(inner)
+		filename := filepath.Join(t.TempDir(), "alunos.dat")
+		students := domain.NewStudentGenerator().Generate(500)
+		if err := s.WriteStudents(filename, students); err != nil {
+			t.Fatal(err)
+		}
+		for _, student := range students[:30] {
+			student.CA = entity.CA_MAX
+			if err := s.UpdateStudent(filename, student); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		// Ordem de CA; com o mesmo CA, ordem física
+		byCA := func(min, max float64) []int {
+			byCents := make(map[int][]int)
+			scanMatriculas(t, s, filename, func(student *entity.Student) bool {
+				if student.CA >= min && student.CA <= max {
+					byCents[caCents(student.CA)] = append(byCents[caCents(student.CA)], student.Matricula)
+				}
+				return false
+			})
+			var matriculas []int
+			for cents := 0; cents <= 1000; cents++ {
+				matriculas = append(matriculas, byCents[cents]...)
+			}
+			return matriculas
+		}
+
+		// Limites exatos de registros existentes entram na faixa
+		min, max := storedCA(students[100].CA), storedCA(students[200].CA)
+		if min > max {
+			min, max = max, min
+		}
+		for _, bounds := range [][2]float64{{min, max}, {-1, 11}, {entity.CA_MAX, entity.CA_MAX}, {7.255, 7.5}, {9, 8}} {
+			got := collectScan(t, 0, func(fn func(student *entity.Student) bool) error {
+				return s.ScanStudentsByCA(filename, bounds[0], bounds[1], fn)
+			})
+			checkMatriculas(t, fmt.Sprintf("%s CA em [%.3f, %.3f]", name, bounds[0], bounds[1]), got, byCA(bounds[0], bounds[1]))
+		}
+		if got := collectScan(t, 0, func(fn func(student *entity.Student) bool) error {
+			return s.ScanStudentsByCA(filename, entity.CA_MAX, entity.CA_MAX, fn)
+		}); len(got) < 30 {
+			t.Fatalf("%s: %d alunos com CA máximo, esperados ao menos 30", name, len(got))
+		}
+
+		// fn devolvendo false encerra a varredura
+		all := byCA(entity.CA_MIN, entity.CA_MAX)
+		got := collectScan(t, 7, func(fn func(student *entity.Student) bool) error {
+			return s.ScanStudentsByCA(filename, entity.CA_MIN, entity.CA_MAX, fn)
+		})
+		checkMatriculas(t, name+" 7 primeiros por CA", got, all[:7])
+	}
+}
+
+func TestIndexedScanStudentsByAnoIngresso(t *testing.T) {
+	for name, inner := range indexedTestStorages(t) {
+		s := NewIndexedStorage(inner)
+		filename := filepath.Join(t.TempDir(), "alunos.dat")
+		students := domain.NewStudentGenerator().Generate(400)
+		if err := s.WriteStudents(filename, students); err != nil {
+			t.Fatal(err)
+		}
+		for i, ano := range []int{1999, 2100} {
+			student := students[i]
+			student.AnoIngresso = ano
+			if err := s.UpdateStudent(filename, student); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		byAno := func(min, max int) []int {
+			var matriculas []int
+			for ano := min; ano <= max; ano++ {
+				matriculas = append(matriculas, scanMatriculas(t, s, filename, func(student *entity.Student) bool {
+					return student.AnoIngresso == ano
+				})...)
+			}
+			return matriculas
+		}
+		for _, bounds := range [][2]int{{2017, 2020}, {2020, 2020}, {1990, 2100}, {2030, 2040}} {
+			got := collectScan(t, 0, func(fn func(student *entity.Student) bool) error {
+				return s.ScanStudentsByAnoIngresso(filename, bounds[0], bounds[1], fn)
+			})
+			checkMatriculas(t, fmt.Sprintf("%s anos %d a %d", name, bounds[0], bounds[1]), got, byAno(bounds[0], bounds[1]))
+		}
+		got := collectScan(t, 3, func(fn func(student *entity.Student) bool) error {
+			return s.ScanStudentsByAnoIngresso(filename, 1990, 2100, fn)
+		})
+		checkMatriculas(t, name+" 3 primeiros por ano", got, byAno(1990, 2100)[:3])
+	}
+}
@@ -1,6 +1,25 @@
 package storage
 
-import "aeds2-tp1/entity"
+import (
+	"aeds2-tp1/entity"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// RecordID identifica um registro pela posição física: o bloco e, dentro dele, o número
+// do slot (tamanho fixo e variável contíguo) ou o offset do pedaço inicial (variável
+// espalhado). Permanece válido enquanto o registro não for removido, realocado ou reorganizado
+type RecordID struct {
+	Block int
+	Slot  int
+}
+
+func (r RecordID) String() string {
+	return fmt.Sprintf("(bloco %d, slot %d)", r.Block, r.Slot)
+}
+
+var ErrRecordNotFound = errors.New("nenhum registro ativo no RecordID informado")
 
 type StorageStats struct {
 	TotalBlocks       int
@@ -8,6 +27,9 @@ type StorageStats struct {
 	TotalBytesTotal   int
 	EfficiencyRate    float64
 	PartialBlocks     int
+	TotalLiveBytes    int
+	TotalDeadBytes    int
+	TotalTombstones   int
 	BlockStatsList    []BlockStats
 }
 
@@ -17,6 +39,8 @@ type BlockStats struct {
 	BytesTotal    int
 	OccupancyRate float64
 	RecordsCount  int
+	LiveBytes     int
+	DeadBytes     int
 }
 
 type ReorganizationReport struct {
@@ -28,11 +52,17 @@ type ReorganizationReport struct {
 	EfficiencyAfter  float64
 	EfficiencyGain   float64
 	FreedBlocks      int
+	BackupFilename   string
 }
 
 type Storage interface {
 	WriteStudents(filename string, students []entity.Student) error
 	FindStudentByMatricula(filename string, matricula int) (*entity.Student, error)
+	FindStudentByCPF(filename string, cpf string) (*entity.Student, error)
+	FindStudentsByCurso(filename string, curso string) ([]*entity.Student, error)
+	FindStudentsByAnoIngresso(filename string, ano int) ([]*entity.Student, error)
+	ScanStudentsByCA(filename string, min float64, max float64, fn func(student *entity.Student) bool) error
+	ScanStudentsByAnoIngresso(filename string, min int, max int, fn func(student *entity.Student) bool) error
 	GetAllStudents(filename string) ([]*entity.Student, error)
 	AddStudents(filename string, students []entity.Student) error
 	UpdateStudent(filename string, student entity.Student) error
@@ -41,4 +71,101 @@ type Storage interface {
 	GetStats(filename string) StorageStats
 	ValidateBlockSize(blockSize int) error
 	GetBlockSize() int
+	SetReorganizeBackup(keep bool)
+
+	// InsertStudent e UpdateByRID rejeitam, como AddStudents, a matrícula de outro registro
+	// ativo; sem índice, a verificação percorre o arquivo
+	InsertStudent(filename string, student entity.Student) (RecordID, error)
+	ScanStudents(filename string, fn func(rid RecordID, student *entity.Student) bool) error
+	GetByRID(filename string, rid RecordID) (*entity.Student, error)
+	UpdateByRID(filename string, rid RecordID, student entity.Student) (RecordID, error)
+	DeleteByRID(filename string, rid RecordID) error
+}
+
+// recordWriter é a gravação dos armazenamentos sem a verificação de matrícula, que o
+// IndexedStorage faz pelos índices: inserção em lote com uma única abertura do arquivo e
+// atualização por RecordID
+type recordWriter interface {
+	insertRecords(filename string, students []entity.Student) ([]RecordID, error)
+	updateRecord(filename string, rid RecordID, student entity.Student) (RecordID, error)
+}
+
+// scanForCPF é a busca por CPF dos armazenamentos sem índice: percorre todos os registros
+func scanForCPF(storage Storage, filename string, cpf string) (*entity.Student, error) {
+	var found *entity.Student
+	err := storage.ScanStudents(filename, func(_ RecordID, student *entity.Student) bool {
+		if student.CPF == cpf {
+			found = student
+			return false
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	if found == nil {
+		return nil, fmt.Errorf("aluno com CPF %s não encontrado", cpf)
+	}
+	return found, nil
+}
+
+// scanStudentsWhere é a busca por campo não único dos armazenamentos sem índice: percorre
+// todos os registros e devolve, na ordem física, os que satisfazem match
+func scanStudentsWhere(storage Storage, filename string, match func(student *entity.Student) bool) ([]*entity.Student, error) {
+	var students []*entity.Student
+	err := storage.ScanStudents(filename, func(_ RecordID, student *entity.Student) bool {
+		if match(student) {
+			students = append(students, student)
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	return students, nil
+}
+
+// scanRangeOrdered é a consulta por faixa dos armazenamentos sem índice: percorre todos os
+// registros, ordena os encontrados pela chave (empates na ordem física) e os entrega a fn
+func scanRangeOrdered(storage Storage, filename string, match func(student *entity.Student) bool, less func(a, b *entity.Student) bool, fn func(student *entity.Student) bool) error {
+	students, err := scanStudentsWhere(storage, filename, match)
+	if err != nil {
+		return err
+	}
+
+	sort.SliceStable(students, func(i, j int) bool { return less(students[i], students[j]) })
+	for _, student := range students {
+		if !fn(student) {
+			break
+		}
+	}
+	return nil
+}
+
+func scanByCA(storage Storage, filename string, min float64, max float64, fn func(student *entity.Student) bool) error {
+	return scanRangeOrdered(storage, filename,
+		func(student *entity.Student) bool { return student.CA >= min && student.CA <= max },
+		func(a, b *entity.Student) bool { return a.CA < b.CA },
+		fn)
+}
+
+func scanByAnoIngresso(storage Storage, filename string, min int, max int, fn func(student *entity.Student) bool) error {
+	return scanRangeOrdered(storage, filename,
+		func(student *entity.Student) bool { return student.AnoIngresso >= min && student.AnoIngresso <= max },
+		func(a, b *entity.Student) bool { return a.AnoIngresso < b.AnoIngresso },
+		fn)
+}
+
+// sameCurso compara cursos como o índice de curso: sem diferenciar maiúsculas nem espaços nas pontas
+func sameCurso(curso string) func(student *entity.Student) bool {
+	key := cursoKey(curso)
+	return func(student *entity.Student) bool {
+		return cursoKey(student.Curso) == key
+	}
+}
+
+func sameAnoIngresso(ano int) func(student *entity.Student) bool {
+	return func(student *entity.Student) bool {
+		return student.AnoIngresso == ano
+	}
 }
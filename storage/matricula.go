@@ -0,0 +1,142 @@
+package storage
+
+import (
+	"aeds2-tp1/entity"
+	"errors"
+	"os"
+	"sort"
+	"strconv"
+)
+
+// FirstMatricula é a matrícula do primeiro aluno de um arquivo vazio
+const FirstMatricula = 100000001
+
+// DuplicateMatricula é uma matrícula que aparece em mais de um registro ativo, o que só
+// acontece em arquivos gravados antes de a matrícula ser verificada
+type DuplicateMatricula struct {
+	Matricula int
+	RIDs      []RecordID
+	Students  []*entity.Student
+}
+
+// duplicateMatriculaError é o erro de uma matrícula que já pertence a outro registro
+func duplicateMatriculaError(matricula int) error {
+	return &DuplicateKeyError{Field: "matrícula", Value: strconv.Itoa(matricula), Matricula: matricula}
+}
+
+// checkBatchMatriculas rejeita lotes com a mesma matrícula em dois alunos
+func checkBatchMatriculas(students []entity.Student) error {
+	seen := make(map[int]bool, len(students))
+	for _, student := range students {
+		if seen[student.Matricula] {
+			return duplicateMatriculaError(student.Matricula)
+		}
+		seen[student.Matricula] = true
+	}
+	return nil
+}
+
+// checkNewMatriculas é a verificação de AddStudents e InsertStudent dos armazenamentos sem índice: rejeita
+// o lote se tiver matrículas repetidas ou já presentes no arquivo, que é percorrido uma vez
+func checkNewMatriculas(storage Storage, filename string, students []entity.Student) error {
+	if err := checkBatchMatriculas(students); err != nil {
+		return err
+	}
+	if _, err := os.Stat(filename); errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+
+	batch := make(map[int]bool, len(students))
+	for _, student := range students {
+		batch[student.Matricula] = true
+	}
+
+	duplicate := 0
+	err := storage.ScanStudents(filename, func(_ RecordID, student *entity.Student) bool {
+		if batch[student.Matricula] {
+			duplicate = student.Matricula
+			return false
+		}
+		return true
+	})
+	if err != nil {
+		return err
+	}
+	if duplicate != 0 {
+		return duplicateMatriculaError(duplicate)
+	}
+	return nil
+}
+
+// NextMatricula devolve a matrícula seguinte à maior do arquivo, ou FirstMatricula se o
+// arquivo estiver vazio ou não existir
+func NextMatricula(storage Storage, filename string) (int, error) {
+	if _, err := os.Stat(filename); errors.Is(err, os.ErrNotExist) {
+		return FirstMatricula, nil
+	}
+
+	last := FirstMatricula - 1
+	err := storage.ScanStudents(filename, func(_ RecordID, student *entity.Student) bool {
+		last = max(last, student.Matricula)
+		return true
+	})
+	if err != nil {
+		return 0, err
+	}
+	return last + 1, nil
+}
+
+// checkUpdatedMatricula é a verificação de UpdateByRID dos armazenamentos sem índice: o
+// arquivo só é percorrido se a matrícula for diferente da atual do registro
+func checkUpdatedMatricula(storage Storage, filename string, rid RecordID, student entity.Student) error {
+	current, err := storage.GetByRID(filename, rid)
+	if err != nil {
+		return err
+	}
+	if current.Matricula == student.Matricula {
+		return nil
+	}
+	return checkNewMatriculas(storage, filename, []entity.Student{student})
+}
+
+// FindDuplicateMatriculas percorre o arquivo e devolve, em ordem de matrícula, as matrículas
+// com mais de um registro ativo e os registros de cada uma, na ordem física. A primeira
+// passada só conta os registros de cada matrícula; a segunda lê apenas os repetidos
+func FindDuplicateMatriculas(storage Storage, filename string) ([]DuplicateMatricula, error) {
+	counts := make(map[int]int)
+	err := storage.ScanStudents(filename, func(_ RecordID, student *entity.Student) bool {
+		counts[student.Matricula]++
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	byMatricula := make(map[int]*DuplicateMatricula)
+	for matricula, count := range counts {
+		if count > 1 {
+			byMatricula[matricula] = &DuplicateMatricula{Matricula: matricula}
+		}
+	}
+	if len(byMatricula) == 0 {
+		return nil, nil
+	}
+
+	err = storage.ScanStudents(filename, func(rid RecordID, student *entity.Student) bool {
+		if entry, ok := byMatricula[student.Matricula]; ok {
+			entry.RIDs = append(entry.RIDs, rid)
+			entry.Students = append(entry.Students, student)
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	duplicates := make([]DuplicateMatricula, 0, len(byMatricula))
+	for _, entry := range byMatricula {
+		duplicates = append(duplicates, *entry)
+	}
+	sort.Slice(duplicates, func(i, j int) bool { return duplicates[i].Matricula < duplicates[j].Matricula })
+	return duplicates, nil
+}
@@ -0,0 +1,103 @@
+package storage
+
+import (
+	"aeds2-tp1/domain"
+	"aeds2-tp1/entity"
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+func TestFindDuplicateMatriculasReportsLegacyDuplicates(t *testing.T) {
+	fs, err := NewFixedStorage(1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	filename := filepath.Join(t.TempDir(), "alunos.dat")
+	students := domain.NewStudentGenerator().Generate(100)
+	if err := fs.WriteStudents(filename, students); err != nil {
+		t.Fatal(err)
+	}
+
+	duplicates, err := FindDuplicateMatriculas(fs, filename)
+	if err != nil || len(duplicates) != 0 {
+		t.Fatalf("arquivo sem repetições: %d matrículas duplicadas, %v", len(duplicates), err)
+	}
+
+	// Arquivos gravados antes da verificação: insertRecords grava sem verificar a matrícula
+	repeated := []int{70, 10, 70}
+	for _, i := range repeated {
+		copy := students[i]
+		copy.Nome = "Cópia"
+		if _, err := fs.insertRecords(filename, []entity.Student{copy}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	duplicates, err = FindDuplicateMatriculas(fs, filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(duplicates) != 2 || duplicates[0].Matricula != students[10].Matricula || duplicates[1].Matricula != students[70].Matricula {
+		t.Fatalf("matrículas duplicadas: %+v", duplicates)
+	}
+	for _, entry := range duplicates {
+		if len(entry.RIDs) != len(entry.Students) {
+			t.Fatalf("matrícula %d com %d RIDs e %d alunos", entry.Matricula, len(entry.RIDs), len(entry.Students))
+		}
+		for i, rid := range entry.RIDs {
+			got, err := fs.GetByRID(filename, rid)
+			if err != nil || got.Matricula != entry.Matricula || got.Nome != entry.Students[i].Nome {
+				t.Fatalf("GetByRID(%s) = %+v, %v", rid, got, err)
+			}
+		}
+	}
+	if len(duplicates[0].RIDs) != 2 || len(duplicates[1].RIDs) != 3 {
+		t.Fatalf("%d e %d registros das matrículas duplicadas", len(duplicates[0].RIDs), len(duplicates[1].RIDs))
+	}
+}
+
+func TestRecordIDWritesRejectDuplicateMatricula(t *testing.T) {
+	for name, storage := range indexedTestStorages(t) {
+		filename := filepath.Join(t.TempDir(), "alunos.dat")
+		students := domain.NewStudentGenerator().Generate(50)
+		if err := storage.WriteStudents(filename, students); err != nil {
+			t.Fatal(err)
+		}
+
+		var keyErr *DuplicateKeyError
+		repeated := students[30]
+		repeated.Nome = "Cópia"
+		if _, err := storage.InsertStudent(filename, repeated); !errors.As(err, &keyErr) || keyErr.Matricula != repeated.Matricula {
+			t.Fatalf("%s: InsertStudent com matrícula repetida: %v", name, err)
+		}
+
+		rid := RecordID{Block: -1}
+		err := storage.ScanStudents(filename, func(r RecordID, student *entity.Student) bool {
+			if student.Matricula == students[10].Matricula {
+				rid = r
+			}
+			return rid.Block < 0
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// Trocar a matrícula pela de outro registro é rejeitado; manter a própria, não
+		changed := students[10]
+		changed.Matricula = students[20].Matricula
+		if _, err := storage.UpdateByRID(filename, rid, changed); !errors.As(err, &keyErr) || keyErr.Matricula != changed.Matricula {
+			t.Fatalf("%s: UpdateByRID com matrícula de outro registro: %v", name, err)
+		}
+		renamed := students[10]
+		renamed.Nome = "Nome Atualizado"
+		if _, err := storage.UpdateByRID(filename, rid, renamed); err != nil {
+			t.Fatalf("%s: UpdateByRID mantendo a matrícula: %v", name, err)
+		}
+
+		duplicates, err := FindDuplicateMatriculas(storage, filename)
+		if err != nil || len(duplicates) != 0 {
+			t.Fatalf("%s: %d matrículas duplicadas, %v", name, len(duplicates), err)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package storage
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// Organizations são os modos comparados por CompareOrganizations: arquivos heap, na ordem
+// de inserção, e o sequencial ordenado por matrícula
+var Organizations = []StorageMode{ModeFixed, ModeVariable, ModeVariableFragmented, ModeSorted}
+
+type OrganizationResult struct {
+	Mode             StorageMode
+	Blocks           int
+	EfficiencyRate   float64
+	Lookups          int
+	Found            int
+	LookupBlockReads int64
+	Bloom            *BloomFilterStats
+}
+
+// AverageLookupReads é a quantidade média de blocos lidos por consulta de matrícula
+func (r OrganizationResult) AverageLookupReads() float64 {
+	if r.Lookups == 0 {
+		return 0
+	}
+	return float64(r.LookupBlockReads) / float64(r.Lookups)
+}
+
+// CompareOrganizations aplica a mesma carga a cada modo, sem índices, em arquivos
+// temporários e mede os blocos lidos pelas consultas por matrícula feitas ao final. Modos
+// que não aceitam o tamanho de bloco ficam de fora
+func CompareOrganizations(blockSize int, workload AllocationWorkload, lookups []int) ([]OrganizationResult, error) {
+	dir, err := os.MkdirTemp("", "organizacao")
+	if err != nil {
+		return nil, fmt.Errorf("erro ao criar diretório temporário: %w", err)
+	}
+	defer os.RemoveAll(dir)
+
+	results := make([]OrganizationResult, 0, len(Organizations))
+	for _, mode := range Organizations {
+		storageImpl, err := NewStorageForMode(mode, blockSize)
+		if err != nil {
+			continue
+		}
+
+		filename := filepath.Join(dir, fmt.Sprintf("modo_%d.dat", int(mode)))
+		if err := storageImpl.WriteStudents(filename, workload.Initial); err != nil {
+			return nil, err
+		}
+		for _, matricula := range workload.Deletes {
+			if err := storageImpl.DeleteStudent(filename, matricula); err != nil {
+				return nil, fmt.Errorf("%s: %w", mode, err)
+			}
+		}
+		for _, student := range workload.Updates {
+			if err := storageImpl.UpdateStudent(filename, student); err != nil {
+				return nil, fmt.Errorf("%s: %w", mode, err)
+			}
+		}
+		if err := storageImpl.AddStudents(filename, workload.Inserts); err != nil {
+			return nil, fmt.Errorf("%s: %w", mode, err)
+		}
+
+		result := OrganizationResult{Mode: mode, Lookups: len(lookups)}
+		readsBefore := blockReads.Load()
+		for _, matricula := range lookups {
+			if _, err := storageImpl.FindStudentByMatricula(filename, matricula); err == nil {
+				result.Found++
+			}
+		}
+		result.LookupBlockReads = blockReads.Load() - readsBefore
+		if vs, ok := storageImpl.(*VariableStorage); ok {
+			if result.Bloom, err = vs.BloomStats(filename); err != nil {
+				return nil, err
+			}
+		}
+
+		stats := storageImpl.GetStats(filename)
+		result.Blocks = stats.TotalBlocks
+		result.EfficiencyRate = stats.EfficiencyRate
+		results = append(results, result)
+	}
+
+	return results, nil
+}
@@ -0,0 +1,163 @@
+package storage
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// Registros maiores que uma página vazia são gravados em páginas de overflow: a página de
+// origem guarda apenas um stub [tamanho][StatusOverflow][matrícula u32][tamanho total u32]
+// [primeiro bloco u32] e o registro completo é dividido em uma cadeia de blocos. Cada página
+// de overflow tem o cabeçalho quantidade de slots u16 (sempre 0) + tipo u16 + próximo
+// bloco + 1 u32 (0 encerra a cadeia) + bytes de dados u32
+const (
+	overflowHeaderSize = 12
+	overflowStubSize   = 17
+)
+
+func newOverflowStub(record []byte, firstBlock int) []byte {
+	stub := make([]byte, overflowStubSize)
+	binary.LittleEndian.PutUint32(stub[0:4], uint32(overflowStubSize-4))
+	stub[4] = StatusOverflow
+	copy(stub[5:9], record[5:9])
+	binary.LittleEndian.PutUint32(stub[9:13], uint32(len(record)))
+	binary.LittleEndian.PutUint32(stub[13:17], uint32(firstBlock))
+	return stub
+}
+
+func isOverflowStub(record []byte) bool {
+	return len(record) >= overflowStubSize && record[4] == StatusOverflow
+}
+
+func overflowNext(block []byte) int {
+	return int(binary.LittleEndian.Uint32(block[4:8])) - 1
+}
+
+func overflowLength(block []byte) int {
+	return int(binary.LittleEndian.Uint32(block[8:12]))
+}
+
+// emptyPageFree é o espaço livre de uma página sem registros; só blocos com esse valor no
+// mapa de espaço livre podem virar páginas de overflow
+func (vs *VariableStorage) emptyPageFree() int {
+	return newSlottedPage(vs.blockSize).freeSpace()
+}
+
+// homeRecord devolve o que deve ser gravado na página de origem: o próprio registro, se
+// couber em uma página vazia, ou um stub apontando para a cadeia de overflow recém gravada
+func (vs *VariableStorage) homeRecord(bf *blockFile, fsm *freeSpaceMap, record []byte) ([]byte, error) {
+	if len(record) <= vs.maxRecordSize() {
+		return record, nil
+	}
+
+	firstBlock, err := vs.writeOverflow(bf, fsm, record)
+	if err != nil {
+		return nil, err
+	}
+	return newOverflowStub(record, firstBlock), nil
+}
+
+// writeOverflow grava o registro em uma cadeia de páginas de overflow, reaproveitando
+// blocos vazios antes de estender o arquivo, e devolve o primeiro bloco da cadeia
+func (vs *VariableStorage) writeOverflow(bf *blockFile, fsm *freeSpaceMap, record []byte) (int, error) {
+	chunkSize := vs.blockSize - overflowHeaderSize
+	chunks := (len(record) + chunkSize - 1) / chunkSize
+
+	blocks := make([]int, chunks)
+	emptyFree := vs.emptyPageFree()
+	for i := range blocks {
+		blockNum := fsm.firstFit(emptyFree)
+		if blockNum < 0 {
+			blockNum = fsm.len()
+			fsm.append(0)
+		}
+		fsm.set(blockNum, 0)
+		blocks[i] = blockNum
+	}
+
+	for i, blockNum := range blocks {
+		start := i * chunkSize
+		end := start + chunkSize
+		if end > len(record) {
+			end = len(record)
+		}
+
+		block := make([]byte, vs.blockSize)
+		binary.LittleEndian.PutUint16(block[2:4], pageTypeOverflow)
+		if i+1 < len(blocks) {
+			binary.LittleEndian.PutUint32(block[4:8], uint32(blocks[i+1]+1))
+		}
+		binary.LittleEndian.PutUint32(block[8:12], uint32(end-start))
+		copy(block[overflowHeaderSize:], record[start:end])
+
+		if err := bf.writeBlock(blockNum, block); err != nil {
+			return 0, err
+		}
+	}
+	return blocks[0], nil
+}
+
+// resolveRecord devolve o registro completo, seguindo a cadeia de overflow se for um stub
+func (vs *VariableStorage) resolveRecord(bf *blockFile, record []byte) ([]byte, error) {
+	if !isOverflowStub(record) {
+		return record, nil
+	}
+
+	length := int(binary.LittleEndian.Uint32(record[9:13]))
+	data := make([]byte, 0, length)
+	blockNum := int(binary.LittleEndian.Uint32(record[13:17]))
+	for hops := 0; len(data) < length; hops++ {
+		if blockNum < 0 || hops >= bf.totalBlocks() {
+			return nil, fmt.Errorf("cadeia de overflow incompleta (%d de %d bytes)", len(data), length)
+		}
+
+		block, err := bf.readBlock(blockNum)
+		if err != nil {
+			return nil, err
+		}
+		if !loadSlottedPage(block).isOverflow() {
+			return nil, fmt.Errorf("bloco %d não é uma página de overflow", blockNum)
+		}
+
+		data = append(data, block[overflowHeaderSize:overflowHeaderSize+overflowLength(block)]...)
+		blockNum = overflowNext(block)
+	}
+	return data, nil
+}
+
+// freeOverflow devolve as páginas da cadeia do stub como páginas vazias, disponíveis para
+// novas inserções
+func (vs *VariableStorage) freeOverflow(bf *blockFile, fsm *freeSpaceMap, stub []byte) error {
+	blockNum := int(binary.LittleEndian.Uint32(stub[13:17]))
+	for hops := 0; blockNum >= 0 && hops < bf.totalBlocks(); hops++ {
+		block, err := bf.readBlock(blockNum)
+		if err != nil {
+			return err
+		}
+		if !loadSlottedPage(block).isOverflow() {
+			return nil
+		}
+
+		next := overflowNext(block)
+		empty := newSlottedPage(vs.blockSize)
+		if err := bf.writeBlock(blockNum, empty.data); err != nil {
+			return err
+		}
+		fsm.set(blockNum, empty.freeSpace())
+		blockNum = next
+	}
+	return nil
+}
+
+// overflowStats conta os bytes de dados da página de overflow como ocupados
+func (vs *VariableStorage) overflowStats(blockNum int, page *slottedPage) BlockStats {
+	length := overflowLength(page.data)
+	bytesUsed := overflowHeaderSize + length
+	return BlockStats{
+		BlockNumber:   blockNum,
+		BytesUsed:     bytesUsed,
+		BytesTotal:    vs.blockSize,
+		OccupancyRate: float64(bytesUsed) / float64(vs.blockSize) * 100,
+		LiveBytes:     length,
+	}
+}
@@ -0,0 +1,186 @@
+package storage
+
+import (
+	"aeds2-tp1/domain"
+	"aeds2-tp1/entity"
+	"encoding/binary"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// overflowChains devolve, para cada RecordID com stub, os blocos da sua cadeia de overflow
+func overflowChains(t *testing.T, vs *VariableStorage, filename string) map[RecordID][]int {
+	t.Helper()
+	bf, err := openBlockFile(filename, ModeVariable, vs.blockSize, false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer bf.Close()
+
+	chains := make(map[RecordID][]int)
+	for blockNum := 0; blockNum < bf.totalBlocks(); blockNum++ {
+		block, err := bf.readBlock(blockNum)
+		if err != nil {
+			t.Fatal(err)
+		}
+		page := loadSlottedPage(block)
+		if page.isOverflow() {
+			continue
+		}
+		for slot := 0; slot < page.slotCount(); slot++ {
+			if !page.isLive(slot) || !isOverflowStub(page.record(slot)) {
+				continue
+			}
+			stub := page.record(slot)
+			var chain []int
+			for next := int(binary.LittleEndian.Uint32(stub[13:17])); next >= 0; {
+				chain = append(chain, next)
+				overflow, err := bf.readBlock(next)
+				if err != nil {
+					t.Fatal(err)
+				}
+				next = overflowNext(overflow)
+			}
+			chains[RecordID{Block: blockNum, Slot: slot}] = chain
+		}
+	}
+	return chains
+}
+
+func TestOverflowChainsAcrossSmallBlocks(t *testing.T) {
+	// Com 40 bytes nenhum registro cabe em uma página vazia: todos viram cadeias
+	const blockSize = 40
+	vs, err := NewVariableStorage(blockSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	filename := filepath.Join(t.TempDir(), "alunos.dat")
+	students := domain.NewStudentGenerator().Generate(40)
+	if err := vs.WriteStudents(filename, students); err != nil {
+		t.Fatal(err)
+	}
+	want := make(map[int]entity.Student)
+	for _, student := range students {
+		want[student.Matricula] = student
+	}
+	checkVariableContents(t, vs, filename, want)
+
+	chunkSize := blockSize - overflowHeaderSize
+	chains := overflowChains(t, vs, filename)
+	if len(chains) != len(students) {
+		t.Fatalf("%d cadeias de overflow para %d alunos", len(chains), len(students))
+	}
+	owner := make(map[int]RecordID)
+	for rid, chain := range chains {
+		student, err := vs.GetByRID(filename, rid)
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkSameStudent(t, student, want[student.Matricula])
+		if size := len(vs.serializeStudent(*student)); len(chain) != (size+chunkSize-1)/chunkSize {
+			t.Fatalf("registro de %d bytes em %d páginas de overflow", size, len(chain))
+		}
+		for _, blockNum := range chain {
+			if other, shared := owner[blockNum]; shared {
+				t.Fatalf("bloco %d nas cadeias de %s e %s", blockNum, other, rid)
+			}
+			owner[blockNum] = rid
+		}
+	}
+
+	// Cadeias maiores e menores na atualização; as páginas liberadas são reaproveitadas
+	blocks := fileBlocks(t, filename, blockSize)
+	for i, student := range students[:10] {
+		if i%2 == 0 {
+			student.Nome = strings.Repeat("N", entity.MaxNomeLength)
+		} else {
+			student.Nome = "A"
+		}
+		if err := vs.UpdateStudent(filename, student); err != nil {
+			t.Fatal(err)
+		}
+		want[student.Matricula] = student
+	}
+	checkVariableContents(t, vs, filename, want)
+
+	for _, student := range students[10:20] {
+		if err := vs.DeleteStudent(filename, student.Matricula); err != nil {
+			t.Fatal(err)
+		}
+		delete(want, student.Matricula)
+	}
+	grown := fileBlocks(t, filename, blockSize)
+	added, err := domain.NewStudentGenerator().GenerateFrom(300000001, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, student := range added {
+		if _, err := vs.InsertStudent(filename, student); err != nil {
+			t.Fatal(err)
+		}
+		want[student.Matricula] = student
+	}
+	checkVariableContents(t, vs, filename, want)
+	if got := fileBlocks(t, filename, blockSize); got != grown {
+		t.Fatalf("arquivo passou de %d para %d blocos ao inserir no espaço de 10 cadeias liberadas", grown, got)
+	}
+	if grown < blocks {
+		t.Fatalf("arquivo encolheu de %d para %d blocos sem reorganização", blocks, grown)
+	}
+	if chains := overflowChains(t, vs, filename); len(chains) != len(want) {
+		t.Fatalf("%d cadeias de overflow para %d alunos", len(chains), len(want))
+	}
+}
+
+func TestOverflowChainCorruptionIsReported(t *testing.T) {
+	const blockSize = 40
+	vs, err := NewVariableStorage(blockSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	filename := filepath.Join(t.TempDir(), "alunos.dat")
+	students := domain.NewStudentGenerator().Generate(3)
+	if err := vs.WriteStudents(filename, students); err != nil {
+		t.Fatal(err)
+	}
+	chains := overflowChains(t, vs, filename)
+
+	// relink troca o próximo bloco da primeira página da cadeia (next = -1 encerra a cadeia)
+	relink := func(chain []int, next int) {
+		bf, err := openBlockFile(filename, ModeVariable, blockSize, true, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		block, err := bf.readBlock(chain[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		binary.LittleEndian.PutUint32(block[4:8], uint32(next+1))
+		if err := bf.writeBlock(chain[0], block); err != nil {
+			t.Fatal(err)
+		}
+		if err := bf.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var rids []RecordID
+	for rid, chain := range chains {
+		if len(chain) < 2 {
+			t.Fatalf("cadeia de %d páginas", len(chain))
+		}
+		rids = append(rids, rid)
+	}
+	relink(chains[rids[0]], -1)
+	if _, err := vs.GetByRID(filename, rids[0]); err == nil || !strings.Contains(err.Error(), "incompleta") {
+		t.Fatalf("cadeia encerrada antes do fim: %v", err)
+	}
+	relink(chains[rids[1]], rids[1].Block)
+	if _, err := vs.GetByRID(filename, rids[1]); err == nil || !strings.Contains(err.Error(), "não é uma página de overflow") {
+		t.Fatalf("cadeia apontando para uma página de registros: %v", err)
+	}
+	if _, err := vs.GetByRID(filename, rids[2]); err != nil {
+		t.Fatalf("cadeia intacta: %v", err)
+	}
+}
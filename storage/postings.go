@@ -0,0 +1,434 @@
+package storage
+
+import (
+	"encoding/binary"
+	"fmt"
+	"os"
+	"sort"
+)
+
+// Índice secundário não único em disco: cada valor do campo (chave) tem uma lista de
+// RecordIDs (posting list) gravada em uma cadeia de blocos do tamanho do nó dos demais
+// índices (indexNodeSize). O bloco 0 é o cabeçalho: magic (4) + tamanho do bloco (4) +
+// quantidade de blocos (4) + primeiro bloco livre (4) + início do diretório (4) + blocos
+// do diretório (4) + bytes do diretório (4) + geração (8) do arquivo de dados. O diretório
+// guarda, para cada chave, tamanho (2) + bytes da chave + primeiro bloco da cadeia (4) +
+// quantidade de RecordIDs (4), e é regravado no fim do arquivo quando não cabe na sua área.
+// Cada bloco da cadeia tem próximo bloco (4) + quantidade (2) + reservado (2) e os
+// RecordIDs bloco + slot (4 bytes cada); blocos esvaziados vão para a lista de livres
+const (
+	postingMagic       = "PIDX"
+	postingHeaderSize  = 36
+	postingBlockHeader = 8
+	postingEntrySize   = 8
+)
+
+type postingList struct {
+	head  int
+	count int
+}
+
+type postingBlock struct {
+	next int
+	rids []RecordID
+}
+
+type postingEntry struct {
+	key string
+	rid RecordID
+}
+
+type postingIndex struct {
+	file       *os.File
+	blockSize  int
+	blockCount int
+	freeHead   int
+	dirStart   int
+	dirBlocks  int
+	lists      map[string]*postingList
+	dirDirty   bool
+	generation uint64
+}
+
+func (p *postingIndex) blockCapacity() int {
+	return (p.blockSize - postingBlockHeader) / postingEntrySize
+}
+
+func openPostingIndex(filename string, blockSize int) (*postingIndex, error) {
+	file, err := os.OpenFile(filename, os.O_RDWR, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	data := make([]byte, postingHeaderSize)
+	if _, err := file.ReadAt(data, 0); err != nil || string(data[0:4]) != postingMagic {
+		file.Close()
+		return nil, fmt.Errorf("%s: %w", filename, errInvalidIndex)
+	}
+
+	p := &postingIndex{
+		file:       file,
+		blockSize:  int(binary.LittleEndian.Uint32(data[4:8])),
+		blockCount: int(binary.LittleEndian.Uint32(data[8:12])),
+		freeHead:   int(binary.LittleEndian.Uint32(data[12:16])),
+		dirStart:   int(binary.LittleEndian.Uint32(data[16:20])),
+		dirBlocks:  int(binary.LittleEndian.Uint32(data[20:24])),
+		generation: binary.LittleEndian.Uint64(data[28:36]),
+	}
+	if p.blockSize != indexNodeSize(blockSize) {
+		file.Close()
+		return nil, fmt.Errorf("%s: %w", filename, errInvalidIndex)
+	}
+
+	if err := p.readDirectory(int(binary.LittleEndian.Uint32(data[24:28]))); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return p, nil
+}
+
+// createPostingIndex grava as listas de uma vez, com os blocos de cada chave preenchidos
+// por completo e na ordem das entradas
+func createPostingIndex(filename string, blockSize int, generation uint64, entries []postingEntry) (*postingIndex, error) {
+	file, err := os.Create(filename)
+	if err != nil {
+		return nil, fmt.Errorf("erro ao criar índice: %w", err)
+	}
+
+	p := &postingIndex{
+		file:       file,
+		blockSize:  indexNodeSize(blockSize),
+		blockCount: 1,
+		lists:      make(map[string]*postingList),
+		dirDirty:   true,
+		generation: generation,
+	}
+
+	byKey := make(map[string][]RecordID)
+	for _, entry := range entries {
+		byKey[entry.key] = append(byKey[entry.key], entry.rid)
+	}
+
+	capacity := p.blockCapacity()
+	for key, rids := range byKey {
+		list := &postingList{count: len(rids)}
+		blocks := (len(rids) + capacity - 1) / capacity
+		list.head = p.blockCount
+		for i := 0; i < blocks; i++ {
+			block := &postingBlock{rids: rids[i*capacity : min(len(rids), (i+1)*capacity)]}
+			if i+1 < blocks {
+				block.next = p.blockCount + 1
+			}
+			if err := p.writeBlock(p.blockCount, block); err != nil {
+				file.Close()
+				return nil, err
+			}
+			p.blockCount++
+		}
+		p.lists[key] = list
+	}
+
+	if err := p.flush(); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return p, nil
+}
+
+func (p *postingIndex) blockOffset(blockNum int) int64 {
+	return int64(blockNum) * int64(p.blockSize)
+}
+
+func (p *postingIndex) readDirectory(size int) error {
+	data := make([]byte, size)
+	if _, err := p.file.ReadAt(data, p.blockOffset(p.dirStart)); err != nil && size > 0 {
+		return fmt.Errorf("erro ao ler diretório do índice: %w", err)
+	}
+
+	p.lists = make(map[string]*postingList)
+	for offset := 0; offset < size; {
+		if offset+2 > size {
+			return errInvalidIndex
+		}
+		keyLen := int(binary.LittleEndian.Uint16(data[offset : offset+2]))
+		offset += 2
+		if offset+keyLen+8 > size {
+			return errInvalidIndex
+		}
+
+		key := string(data[offset : offset+keyLen])
+		offset += keyLen
+		p.lists[key] = &postingList{
+			head:  int(binary.LittleEndian.Uint32(data[offset : offset+4])),
+			count: int(binary.LittleEndian.Uint32(data[offset+4 : offset+8])),
+		}
+		offset += 8
+	}
+	return nil
+}
+
+// writeDirectory regrava o diretório na sua área; se ele não couber mais, uma área nova é
+// alocada no fim do arquivo e a antiga fica sem uso até a próxima reconstrução
+func (p *postingIndex) writeDirectory() (int, error) {
+	keys := p.keys()
+	data := make([]byte, 0)
+	for _, key := range keys {
+		list := p.lists[key]
+		data = binary.LittleEndian.AppendUint16(data, uint16(len(key)))
+		data = append(data, key...)
+		data = binary.LittleEndian.AppendUint32(data, uint32(list.head))
+		data = binary.LittleEndian.AppendUint32(data, uint32(list.count))
+	}
+
+	blocks := (len(data) + p.blockSize - 1) / p.blockSize
+	if blocks > p.dirBlocks {
+		p.dirStart = p.blockCount
+		p.dirBlocks = blocks
+		p.blockCount += blocks
+	}
+
+	if _, err := p.file.WriteAt(data, p.blockOffset(p.dirStart)); err != nil {
+		return 0, fmt.Errorf("erro ao gravar diretório do índice: %w", err)
+	}
+	p.dirDirty = false
+	return len(data), nil
+}
+
+// flush grava o diretório e o cabeçalho
+func (p *postingIndex) flush() error {
+	dirBytes, err := p.writeDirectory()
+	if err != nil {
+		return err
+	}
+
+	data := make([]byte, p.blockSize)
+	copy(data[0:4], postingMagic)
+	binary.LittleEndian.PutUint32(data[4:8], uint32(p.blockSize))
+	binary.LittleEndian.PutUint32(data[8:12], uint32(p.blockCount))
+	binary.LittleEndian.PutUint32(data[12:16], uint32(p.freeHead))
+	binary.LittleEndian.PutUint32(data[16:20], uint32(p.dirStart))
+	binary.LittleEndian.PutUint32(data[20:24], uint32(p.dirBlocks))
+	binary.LittleEndian.PutUint32(data[24:28], uint32(dirBytes))
+	binary.LittleEndian.PutUint64(data[28:36], p.generation)
+	if _, err := p.file.WriteAt(data, 0); err != nil {
+		return fmt.Errorf("erro ao gravar cabeçalho do índice: %w", err)
+	}
+	return nil
+}
+
+func (p *postingIndex) readBlock(blockNum int) (*postingBlock, error) {
+	if blockNum <= 0 || blockNum >= p.blockCount {
+		return nil, fmt.Errorf("bloco %d fora do índice: %w", blockNum, errInvalidIndex)
+	}
+
+	data := make([]byte, p.blockSize)
+	if _, err := p.file.ReadAt(data, p.blockOffset(blockNum)); err != nil {
+		return nil, fmt.Errorf("erro ao ler bloco %d do índice: %w", blockNum, err)
+	}
+
+	count := int(binary.LittleEndian.Uint16(data[4:6]))
+	if count > p.blockCapacity() {
+		return nil, fmt.Errorf("bloco %d do índice corrompido: %w", blockNum, errInvalidIndex)
+	}
+
+	block := &postingBlock{next: int(binary.LittleEndian.Uint32(data[0:4]))}
+	for i := 0; i < count; i++ {
+		offset := postingBlockHeader + i*postingEntrySize
+		block.rids = append(block.rids, RecordID{
+			Block: int(binary.LittleEndian.Uint32(data[offset : offset+4])),
+			Slot:  int(binary.LittleEndian.Uint32(data[offset+4 : offset+8])),
+		})
+	}
+	return block, nil
+}
+
+func (p *postingIndex) writeBlock(blockNum int, block *postingBlock) error {
+	data := make([]byte, p.blockSize)
+	binary.LittleEndian.PutUint32(data[0:4], uint32(block.next))
+	binary.LittleEndian.PutUint16(data[4:6], uint16(len(block.rids)))
+	for i, rid := range block.rids {
+		offset := postingBlockHeader + i*postingEntrySize
+		binary.LittleEndian.PutUint32(data[offset:offset+4], uint32(rid.Block))
+		binary.LittleEndian.PutUint32(data[offset+4:offset+8], uint32(rid.Slot))
+	}
+
+	if _, err := p.file.WriteAt(data, p.blockOffset(blockNum)); err != nil {
+		return fmt.Errorf("erro ao gravar bloco %d do índice: %w", blockNum, err)
+	}
+	return nil
+}
+
+// allocBlock reaproveita o primeiro bloco livre ou estende o arquivo
+func (p *postingIndex) allocBlock() (int, error) {
+	if p.freeHead == 0 {
+		blockNum := p.blockCount
+		p.blockCount++
+		return blockNum, nil
+	}
+
+	blockNum := p.freeHead
+	block, err := p.readBlock(blockNum)
+	if err != nil {
+		return 0, err
+	}
+	p.freeHead = block.next
+	return blockNum, nil
+}
+
+func (p *postingIndex) freeBlock(blockNum int) error {
+	if err := p.writeBlock(blockNum, &postingBlock{next: p.freeHead}); err != nil {
+		return err
+	}
+	p.freeHead = blockNum
+	return nil
+}
+
+// keys devolve as chaves em ordem
+func (p *postingIndex) keys() []string {
+	keys := make([]string, 0, len(p.lists))
+	for key := range p.lists {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// keysBetween devolve, em ordem, as chaves entre lo e hi (inclusive) segundo less
+func (p *postingIndex) keysBetween(lo string, hi string, less func(a, b string) bool) []string {
+	var keys []string
+	for key := range p.lists {
+		if !less(key, lo) && !less(hi, key) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool { return less(keys[i], keys[j]) })
+	return keys
+}
+
+func (p *postingIndex) count(key string) int {
+	if list, ok := p.lists[key]; ok {
+		return list.count
+	}
+	return 0
+}
+
+// add acrescenta o RecordID ao primeiro bloco da cadeia da chave; quando ele está cheio,
+// um bloco novo passa a ser o primeiro
+func (p *postingIndex) add(key string, rid RecordID) error {
+	list, ok := p.lists[key]
+	if ok {
+		head, err := p.readBlock(list.head)
+		if err != nil {
+			return err
+		}
+		if len(head.rids) < p.blockCapacity() {
+			head.rids = append(head.rids, rid)
+			list.count++
+			p.dirDirty = true
+			return p.writeBlock(list.head, head)
+		}
+	} else {
+		list = &postingList{}
+		p.lists[key] = list
+	}
+
+	blockNum, err := p.allocBlock()
+	if err != nil {
+		return err
+	}
+	if err := p.writeBlock(blockNum, &postingBlock{next: list.head, rids: []RecordID{rid}}); err != nil {
+		return err
+	}
+	list.head = blockNum
+	list.count++
+	p.dirDirty = true
+	return nil
+}
+
+// remove retira o RecordID da cadeia da chave, liberando o bloco que ficar vazio
+func (p *postingIndex) remove(key string, rid RecordID) (bool, error) {
+	list, ok := p.lists[key]
+	if !ok {
+		return false, nil
+	}
+
+	var prev *postingBlock
+	prevNum := 0
+	for blockNum := list.head; blockNum != 0; {
+		block, err := p.readBlock(blockNum)
+		if err != nil {
+			return false, err
+		}
+
+		for i, current := range block.rids {
+			if current != rid {
+				continue
+			}
+
+			block.rids[i] = block.rids[len(block.rids)-1]
+			block.rids = block.rids[:len(block.rids)-1]
+			list.count--
+			p.dirDirty = true
+
+			if len(block.rids) > 0 {
+				return true, p.writeBlock(blockNum, block)
+			}
+			if prev == nil {
+				list.head = block.next
+			} else {
+				prev.next = block.next
+				if err := p.writeBlock(prevNum, prev); err != nil {
+					return false, err
+				}
+			}
+			if list.count == 0 {
+				delete(p.lists, key)
+			}
+			return true, p.freeBlock(blockNum)
+		}
+
+		prev, prevNum = block, blockNum
+		blockNum = block.next
+	}
+	return false, nil
+}
+
+// list devolve os RecordIDs da chave lendo apenas os blocos da sua cadeia
+func (p *postingIndex) list(key string) ([]RecordID, error) {
+	list, ok := p.lists[key]
+	if !ok {
+		return nil, nil
+	}
+
+	rids := make([]RecordID, 0, list.count)
+	for blockNum, hops := list.head, 0; blockNum != 0; hops++ {
+		if hops >= p.blockCount {
+			return nil, fmt.Errorf("cadeia da chave %q em ciclo: %w", key, errInvalidIndex)
+		}
+		block, err := p.readBlock(blockNum)
+		if err != nil {
+			return nil, err
+		}
+		rids = append(rids, block.rids...)
+		blockNum = block.next
+	}
+	return rids, nil
+}
+
+func (p *postingIndex) dataGeneration() uint64 {
+	return p.generation
+}
+
+// save registra a geração do arquivo de dados que o índice descreve e fecha o arquivo
+func (p *postingIndex) save(generation uint64) error {
+	p.generation = generation
+	if err := p.flush(); err != nil {
+		p.file.Close()
+		return err
+	}
+	return p.file.Close()
+}
+
+func (p *postingIndex) close() error {
+	return p.file.Close()
+}
@@ -0,0 +1,143 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+func averageOccupancy(stats StorageStats) float64 {
+	if stats.TotalBlocks == 0 {
+		return 0.0
+	}
+	sum := 0.0
+	for _, b := range stats.BlockStatsList {
+		sum += b.OccupancyRate
+	}
+	return sum / float64(stats.TotalBlocks)
+}
+
+func newReorganizationReport(statsBefore, statsAfter StorageStats) *ReorganizationReport {
+	return &ReorganizationReport{
+		BlocksBefore:     statsBefore.TotalBlocks,
+		BlocksAfter:      statsAfter.TotalBlocks,
+		OccupancyBefore:  averageOccupancy(statsBefore),
+		OccupancyAfter:   averageOccupancy(statsAfter),
+		EfficiencyBefore: statsBefore.EfficiencyRate,
+		EfficiencyAfter:  statsAfter.EfficiencyRate,
+		EfficiencyGain:   statsAfter.EfficiencyRate - statsBefore.EfficiencyRate,
+		FreedBlocks:      statsBefore.TotalBlocks - statsAfter.TotalBlocks,
+	}
+}
+
+// replaceFile substitui filename pelo arquivo reorganizado de forma atômica: o temporário é
+// sincronizado em disco e renomeado por cima do original, de modo que uma falha no meio
+// deixa o arquivo antigo ou o novo, nunca um arquivo parcial. Com keepBackup o original é
+// preservado em _backup.dat, cujo nome é devolvido. companions são as extensões dos arquivos
+// auxiliares (ex.: ".fsm") gravados junto com o temporário, que também substituem os originais;
+// um auxiliar que o temporário não tem (ex.: os índices) é apenas descartado
+func replaceFile(tempFilename string, filename string, keepBackup bool, companions ...string) (string, error) {
+	if err := syncFile(tempFilename); err != nil {
+		removeTemporaryFiles(tempFilename, companions...)
+		return "", err
+	}
+
+	backup := ""
+	if keepBackup {
+		backup = backupFilename(filename)
+		if err := backupFile(filename, backup); err != nil {
+			removeTemporaryFiles(tempFilename, companions...)
+			return "", err
+		}
+	}
+
+	// Os auxiliares antigos são apagados antes da troca: se o processo parar no meio, eles
+	// serão reconstruídos a partir do arquivo de dados em vez de descrever o arquivo errado
+	for _, ext := range companions {
+		if err := os.Remove(companionFilename(filename, ext)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return "", fmt.Errorf("erro ao remover arquivo auxiliar: %w", err)
+		}
+	}
+
+	if err := os.Rename(tempFilename, filename); err != nil {
+		removeTemporaryFiles(tempFilename, companions...)
+		return "", fmt.Errorf("erro ao substituir arquivo original: %w", err)
+	}
+	invalidateCachedBlocks(filename)
+	invalidateCachedBlocks(tempFilename)
+
+	for _, ext := range companions {
+		err := os.Rename(companionFilename(tempFilename, ext), companionFilename(filename, ext))
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return "", fmt.Errorf("erro ao substituir arquivo auxiliar: %w", err)
+		}
+	}
+
+	syncDir(filepath.Dir(filename))
+	return backup, nil
+}
+
+func removeTemporaryFiles(tempFilename string, companions ...string) {
+	os.Remove(tempFilename)
+	invalidateCachedBlocks(tempFilename)
+	for _, ext := range companions {
+		os.Remove(companionFilename(tempFilename, ext))
+	}
+}
+
+func syncFile(filename string) error {
+	file, err := os.OpenFile(filename, os.O_RDWR, 0644)
+	if err != nil {
+		return fmt.Errorf("erro ao abrir arquivo temporário: %w", err)
+	}
+	defer file.Close()
+
+	if err := file.Sync(); err != nil {
+		return fmt.Errorf("erro ao sincronizar arquivo temporário: %w", err)
+	}
+	return nil
+}
+
+// syncDir garante que a renomeação chegou ao disco; nem todo sistema permite sincronizar
+// diretórios, por isso falhas são ignoradas
+func syncDir(dir string) {
+	d, err := os.Open(dir)
+	if err != nil {
+		return
+	}
+	d.Sync()
+	d.Close()
+}
+
+// backupFile preserva o original com um link físico, copiando o conteúdo quando o
+// sistema de arquivos não suporta links
+func backupFile(filename string, backup string) error {
+	if err := os.Remove(backup); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("erro ao remover cópia de segurança anterior: %w", err)
+	}
+	if err := os.Link(filename, backup); err == nil {
+		return nil
+	}
+
+	src, err := os.Open(filename)
+	if err != nil {
+		return fmt.Errorf("erro ao criar cópia de segurança: %w", err)
+	}
+	defer src.Close()
+
+	dst, err := os.Create(backup)
+	if err != nil {
+		return fmt.Errorf("erro ao criar cópia de segurança: %w", err)
+	}
+	if _, err := io.Copy(dst, src); err != nil {
+		dst.Close()
+		return fmt.Errorf("erro ao criar cópia de segurança: %w", err)
+	}
+	if err := dst.Sync(); err != nil {
+		dst.Close()
+		return fmt.Errorf("erro ao criar cópia de segurança: %w", err)
+	}
+	return dst.Close()
+}
@@ -0,0 +1,313 @@
+package storage
+
+import (
+	"encoding/binary"
+	"sort"
+)
+
+// Página com slots usada pelo VariableStorage: cabeçalho (quantidade de slots u16 +
+// tipo da página u16 + início da área de registros u32), diretório de slots crescendo a partir
+// do início do bloco (offset u32 + tamanho u32 por slot) e registros crescendo a partir do
+// fim. Um slot com tamanho 0 está livre e pode ser reaproveitado por uma nova inserção.
+// A área de registros é sempre coberta por registros [tamanho][status][payload], ativos
+// ou removidos, de modo que os buracos deixados por remoções podem ser percorridos
+const (
+	pageHeaderSize = 8
+	slotEntrySize  = 8
+	minHoleSize    = 5
+)
+
+// Tipos de página; arquivos anteriores às páginas de overflow têm 0 no campo, ou seja,
+// apenas páginas de dados
+const (
+	pageTypeData     = 0
+	pageTypeOverflow = 1
+)
+
+type slottedPage struct {
+	data []byte
+}
+
+func newSlottedPage(blockSize int) *slottedPage {
+	page := &slottedPage{data: make([]byte, blockSize)}
+	page.setRecordStart(blockSize)
+	return page
+}
+
+// loadSlottedPage interpreta um bloco lido do arquivo; um bloco zerado é uma página vazia
+func loadSlottedPage(block []byte) *slottedPage {
+	page := &slottedPage{data: block}
+	if page.recordStart() == 0 && !page.isOverflow() {
+		page.setRecordStart(len(block))
+	}
+	return page
+}
+
+// isOverflow indica uma página de continuação de registro grande (ver overflow.go), que
+// não tem slots nem recebe inserções
+func (p *slottedPage) isOverflow() bool {
+	return binary.LittleEndian.Uint16(p.data[2:4]) == pageTypeOverflow
+}
+
+func (p *slottedPage) slotCount() int {
+	return int(binary.LittleEndian.Uint16(p.data[0:2]))
+}
+
+func (p *slottedPage) setSlotCount(count int) {
+	binary.LittleEndian.PutUint16(p.data[0:2], uint16(count))
+}
+
+func (p *slottedPage) recordStart() int {
+	return int(binary.LittleEndian.Uint32(p.data[4:8]))
+}
+
+func (p *slottedPage) setRecordStart(offset int) {
+	binary.LittleEndian.PutUint32(p.data[4:8], uint32(offset))
+}
+
+func (p *slottedPage) slot(slot int) (int, int) {
+	entry := pageHeaderSize + slot*slotEntrySize
+	offset := int(binary.LittleEndian.Uint32(p.data[entry : entry+4]))
+	length := int(binary.LittleEndian.Uint32(p.data[entry+4 : entry+8]))
+	return offset, length
+}
+
+func (p *slottedPage) setSlot(slot int, offset int, length int) {
+	entry := pageHeaderSize + slot*slotEntrySize
+	binary.LittleEndian.PutUint32(p.data[entry:entry+4], uint32(offset))
+	binary.LittleEndian.PutUint32(p.data[entry+4:entry+8], uint32(length))
+}
+
+func (p *slottedPage) isLive(slot int) bool {
+	if slot < 0 || slot >= p.slotCount() {
+		return false
+	}
+	_, length := p.slot(slot)
+	return length > 0
+}
+
+// record devolve os bytes do registro do slot ([tamanho][status][payload]) ou nil se o slot estiver livre
+func (p *slottedPage) record(slot int) []byte {
+	if !p.isLive(slot) {
+		return nil
+	}
+	offset, length := p.slot(slot)
+	return p.data[offset : offset+length]
+}
+
+func (p *slottedPage) freeSlot() int {
+	for slot := 0; slot < p.slotCount(); slot++ {
+		if _, length := p.slot(slot); length == 0 {
+			return slot
+		}
+	}
+	return -1
+}
+
+func (p *slottedPage) liveBytes() int {
+	total := 0
+	for slot := 0; slot < p.slotCount(); slot++ {
+		_, length := p.slot(slot)
+		total += length
+	}
+	return total
+}
+
+// deadRecords conta os registros removidos ainda presentes na área de registros
+func (p *slottedPage) deadRecords() int {
+	count := 0
+	offset := p.recordStart()
+	for offset+minHoleSize <= len(p.data) {
+		length := 4 + int(binary.LittleEndian.Uint32(p.data[offset:offset+4]))
+		if length < minHoleSize || offset+length > len(p.data) {
+			break
+		}
+		if p.data[offset+4] == StatusDeleted {
+			count++
+		}
+		offset += length
+	}
+	return count
+}
+
+// deadBytes conta os bytes de registros removidos ainda presentes na área de registros
+func (p *slottedPage) deadBytes() int {
+	return len(p.data) - p.recordStart() - p.liveBytes()
+}
+
+func (p *slottedPage) contiguousFree() int {
+	return p.recordStart() - pageHeaderSize - p.slotCount()*slotEntrySize
+}
+
+// freeSpace é o maior registro que cabe na página, considerando a compactação e a
+// entrada de diretório que uma inserção pode precisar
+func (p *slottedPage) freeSpace() int {
+	free := len(p.data) - pageHeaderSize - p.slotCount()*slotEntrySize - p.liveBytes()
+	if p.freeSlot() < 0 {
+		free -= slotEntrySize
+	}
+	if free < 0 {
+		return 0
+	}
+	return free
+}
+
+// insert grava o registro em um slot livre (ou novo), compactando a página se o espaço
+// contíguo não bastar; devolve -1 se o registro não couber
+func (p *slottedPage) insert(record []byte) int {
+	if len(record) > p.freeSpace() {
+		return -1
+	}
+
+	slot := p.freeSlot()
+	if slot < 0 {
+		if p.contiguousFree() < slotEntrySize {
+			p.compact()
+		}
+		slot = p.slotCount()
+		p.setSlotCount(slot + 1)
+		p.setSlot(slot, 0, 0)
+	}
+
+	p.place(slot, record)
+	return slot
+}
+
+// replace troca o registro de um slot ocupado mantendo o mesmo número de slot;
+// devolve false, sem alterar a página, se o novo registro não couber
+func (p *slottedPage) replace(slot int, record []byte) bool {
+	_, oldLength := p.slot(slot)
+	available := len(p.data) - pageHeaderSize - p.slotCount()*slotEntrySize - p.liveBytes() + oldLength
+	if len(record) > available {
+		return false
+	}
+
+	p.remove(slot)
+	if slot >= p.slotCount() {
+		p.setSlotCount(slot + 1)
+	}
+	p.place(slot, record)
+	return true
+}
+
+// place grava o registro no primeiro buraco de registro removido que o comporte; sem
+// buraco, usa o espaço contíguo entre o diretório e a área de registros, compactando a
+// página se necessário
+func (p *slottedPage) place(slot int, record []byte) {
+	if offset, length := p.findHole(len(record)); offset >= 0 {
+		p.fillHole(slot, offset, length, record)
+		return
+	}
+
+	if p.contiguousFree() < len(record) {
+		p.compact()
+	}
+
+	offset := p.recordStart() - len(record)
+	copy(p.data[offset:], record)
+	p.setRecordStart(offset)
+	p.setSlot(slot, offset, len(record))
+}
+
+// findHole percorre a área de registros procurando uma sequência de registros removidos
+// com pelo menos need bytes; sequências vizinhas são fundidas em um único buraco
+func (p *slottedPage) findHole(need int) (int, int) {
+	holeStart, holeLength := -1, 0
+	offset := p.recordStart()
+	for offset+minHoleSize <= len(p.data) {
+		length := 4 + int(binary.LittleEndian.Uint32(p.data[offset:offset+4]))
+		if length < minHoleSize || offset+length > len(p.data) {
+			break
+		}
+
+		if p.data[offset+4] != StatusDeleted {
+			holeStart, holeLength = -1, 0
+			offset += length
+			continue
+		}
+
+		if holeStart < 0 {
+			holeStart = offset
+		}
+		holeLength += length
+		if holeLength >= need {
+			p.setHole(holeStart, holeLength)
+			return holeStart, holeLength
+		}
+		offset += length
+	}
+	return -1, 0
+}
+
+func (p *slottedPage) setHole(offset int, length int) {
+	binary.LittleEndian.PutUint32(p.data[offset:offset+4], uint32(length-4))
+	p.data[offset+4] = StatusDeleted
+}
+
+// fillHole grava o registro no início do buraco; a sobra vira um buraco menor se tiver
+// ao menos minHoleSize bytes, senão é incorporada ao próprio registro
+func (p *slottedPage) fillHole(slot int, offset int, length int, record []byte) {
+	copy(p.data[offset:], record)
+	used := len(record)
+
+	if leftover := length - used; leftover >= minHoleSize {
+		p.setHole(offset+used, leftover)
+	} else {
+		for i := offset + used; i < offset+length; i++ {
+			p.data[i] = 0
+		}
+		binary.LittleEndian.PutUint32(p.data[offset:offset+4], uint32(length-4))
+		used = length
+	}
+
+	p.setSlot(slot, offset, used)
+}
+
+// remove libera o slot e marca o registro como removido; os bytes ficam ocupados até a
+// próxima compactação da página. Slots livres no fim do diretório são descartados
+func (p *slottedPage) remove(slot int) {
+	if !p.isLive(slot) {
+		return
+	}
+	offset, _ := p.slot(slot)
+	p.data[offset+4] = StatusDeleted
+	p.setSlot(slot, 0, 0)
+
+	count := p.slotCount()
+	for count > 0 {
+		if _, length := p.slot(count - 1); length > 0 {
+			break
+		}
+		count--
+	}
+	p.setSlotCount(count)
+}
+
+// compact reagrupa os registros vivos no fim do bloco sem mudar os números de slot,
+// de modo que os RecordIDs continuam válidos
+func (p *slottedPage) compact() {
+	type liveSlot struct {
+		slot, offset, length int
+	}
+
+	live := make([]liveSlot, 0, p.slotCount())
+	for slot := 0; slot < p.slotCount(); slot++ {
+		if offset, length := p.slot(slot); length > 0 {
+			live = append(live, liveSlot{slot, offset, length})
+		}
+	}
+	sort.Slice(live, func(i, j int) bool { return live[i].offset > live[j].offset })
+
+	end := len(p.data)
+	for _, l := range live {
+		end -= l.length
+		copy(p.data[end:end+l.length], p.data[l.offset:l.offset+l.length])
+		p.setSlot(l.slot, end, l.length)
+	}
+
+	directoryEnd := pageHeaderSize + p.slotCount()*slotEntrySize
+	for i := directoryEnd; i < end; i++ {
+		p.data[i] = 0
+	}
+	p.setRecordStart(end)
+}
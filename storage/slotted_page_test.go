@@ -0,0 +1,264 @@
+package storage
+
+import (
+	"aeds2-tp1/domain"
+	"aeds2-tp1/entity"
+	"bytes"
+	"encoding/binary"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// pageTestRecord monta um registro [tamanho][status][payload] com size bytes no total
+func pageTestRecord(fill byte, size int) []byte {
+	record := bytes.Repeat([]byte{fill}, size)
+	binary.LittleEndian.PutUint32(record[0:4], uint32(size-4))
+	record[4] = StatusActive
+	return record
+}
+
+// checkPage confere o conteúdo de cada slot e que a área de registros continua coberta,
+// do início até o fim do bloco, por registros ativos ou removidos
+func checkPage(t *testing.T, page *slottedPage, want map[int][]byte) {
+	t.Helper()
+	for slot := 0; slot < page.slotCount(); slot++ {
+		if page.isLive(slot) != (want[slot] != nil) {
+			t.Fatalf("slot %d ocupado = %v", slot, page.isLive(slot))
+		}
+	}
+	for slot, record := range want {
+		if !bytes.Equal(page.record(slot), record) {
+			t.Fatalf("slot %d com %d bytes, esperados %d", slot, len(page.record(slot)), len(record))
+		}
+	}
+
+	offset := page.recordStart()
+	for offset < len(page.data) {
+		length := 4 + int(binary.LittleEndian.Uint32(page.data[offset:offset+4]))
+		if length < minHoleSize || offset+length > len(page.data) {
+			t.Fatalf("registro inválido de %d bytes no offset %d", length, offset)
+		}
+		offset += length
+	}
+	if live := page.liveBytes(); page.deadBytes() != len(page.data)-page.recordStart()-live {
+		t.Fatalf("%d bytes removidos com %d vivos", page.deadBytes(), live)
+	}
+}
+
+func TestSlottedPageRoundTrip(t *testing.T) {
+	page := newSlottedPage(256)
+	want := make(map[int][]byte)
+	for i, size := range []int{20, 30, 20} {
+		record := pageTestRecord(byte(i+1), size)
+		if slot := page.insert(record); slot != i {
+			t.Fatalf("insert devolveu o slot %d, esperado %d", slot, i)
+		}
+		want[i] = record
+	}
+	checkPage(t, page, want)
+
+	// Crescer: o registro muda de lugar, mas continua no mesmo slot
+	want[1] = pageTestRecord(4, 40)
+	if !page.replace(1, want[1]) {
+		t.Fatal("replace maior recusado")
+	}
+	checkPage(t, page, want)
+	if page.deadBytes() != 30 {
+		t.Fatalf("%d bytes removidos após crescer o registro de 30 bytes", page.deadBytes())
+	}
+
+	// Diminuir: o registro ocupa o buraco deixado pela versão antiga
+	start := page.recordStart()
+	want[2] = pageTestRecord(5, 10)
+	if !page.replace(2, want[2]) {
+		t.Fatal("replace menor recusado")
+	}
+	checkPage(t, page, want)
+	if page.recordStart() != start {
+		t.Fatal("registro menor gravado fora do buraco")
+	}
+
+	// Remover e reaproveitar: o slot livre e os buracos vizinhos recebem a nova inserção
+	page.remove(0)
+	delete(want, 0)
+	checkPage(t, page, want)
+	want[0] = pageTestRecord(6, 25)
+	if slot := page.insert(want[0]); slot != 0 {
+		t.Fatalf("insert após remoção usou o slot %d", slot)
+	}
+	checkPage(t, page, want)
+	if page.recordStart() != start {
+		t.Fatal("inserção não reaproveitou os buracos de registros removidos")
+	}
+
+	before := append([]byte(nil), page.data...)
+	if page.replace(1, pageTestRecord(7, 300)) {
+		t.Fatal("replace maior que o bloco aceito")
+	}
+	if !bytes.Equal(page.data, before) {
+		t.Fatal("replace recusado alterou a página")
+	}
+}
+
+func TestSlottedPageCompactsWhenFull(t *testing.T) {
+	page := newSlottedPage(256)
+	want := make(map[int][]byte)
+	for i := 0; ; i++ {
+		record := pageTestRecord(byte(i+1), 30)
+		slot := page.insert(record)
+		if slot < 0 {
+			break
+		}
+		want[slot] = record
+	}
+	if page.freeSpace() >= 30 {
+		t.Fatalf("insert recusado com %d bytes livres", page.freeSpace())
+	}
+
+	// Os buracos não são vizinhos: o registro maior só cabe depois da compactação
+	for slot := 0; slot < len(want)-1; slot += 2 {
+		page.remove(slot)
+		delete(want, slot)
+	}
+	record := pageTestRecord(99, 80)
+	slot := page.insert(record)
+	if slot != 0 {
+		t.Fatalf("insert após remoções devolveu o slot %d", slot)
+	}
+	want[slot] = record
+	checkPage(t, page, want)
+	if page.deadBytes() != 0 {
+		t.Fatalf("%d bytes removidos após a compactação", page.deadBytes())
+	}
+}
+
+// checkSameStudent compara os campos gravados; o CA é gravado em centésimos
+func checkSameStudent(t *testing.T, got *entity.Student, want entity.Student) {
+	t.Helper()
+	if got.Matricula != want.Matricula || got.Nome != want.Nome || got.CPF != want.CPF || got.Curso != want.Curso ||
+		got.FiliacaoMae != want.FiliacaoMae || got.FiliacaoPai != want.FiliacaoPai || got.AnoIngresso != want.AnoIngresso ||
+		math.Abs(got.CA-want.CA) > 0.005 {
+		t.Fatalf("aluno lido %+v, esperado %+v", *got, want)
+	}
+}
+
+func checkVariableContents(t *testing.T, vs *VariableStorage, filename string, want map[int]entity.Student) {
+	t.Helper()
+	all, err := vs.GetAllStudents(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != len(want) {
+		t.Fatalf("GetAllStudents devolveu %d alunos, esperados %d", len(all), len(want))
+	}
+	for _, student := range all {
+		checkSameStudent(t, student, want[student.Matricula])
+	}
+}
+
+func fileBlocks(t *testing.T, filename string, blockSize int) int {
+	t.Helper()
+	info, err := os.Stat(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return int(info.Size())/blockSize - 1
+}
+
+func TestVariableStorageUpdateGrowShrinkDelete(t *testing.T) {
+	const blockSize = 128
+	vs, err := NewVariableStorage(blockSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	filename := filepath.Join(t.TempDir(), "alunos.dat")
+	students := domain.NewStudentGenerator().Generate(30)
+	if err := vs.WriteStudents(filename, students); err != nil {
+		t.Fatal(err)
+	}
+	want := make(map[int]entity.Student)
+	for _, student := range students {
+		want[student.Matricula] = student
+	}
+
+	target := students[5]
+	rid, err := vs.LocateStudent(filename, target.Matricula)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Com o nome máximo o registro não cabe em uma página vazia e vai para o overflow
+	grown := target
+	grown.Nome = strings.Repeat("N", entity.MaxNomeLength)
+	if len(vs.serializeStudent(grown)) <= vs.maxRecordSize() {
+		t.Fatal("registro de teste cabe em uma página vazia")
+	}
+	blocks := fileBlocks(t, filename, blockSize)
+	if rid, err = vs.UpdateByRID(filename, rid, grown); err != nil {
+		t.Fatal(err)
+	}
+	want[target.Matricula] = grown
+	checkVariableContents(t, vs, filename, want)
+	withOverflow := fileBlocks(t, filename, blockSize)
+	if withOverflow <= blocks {
+		t.Fatal("registro grande gravado sem páginas de overflow")
+	}
+
+	// Voltar ao tamanho normal libera a cadeia, que é reaproveitada pelo próximo registro grande
+	shrunk := target
+	shrunk.Nome = "A"
+	if rid, err = vs.UpdateByRID(filename, rid, shrunk); err != nil {
+		t.Fatal(err)
+	}
+	want[target.Matricula] = shrunk
+	checkVariableContents(t, vs, filename, want)
+
+	other := students[20]
+	otherRID, err := vs.LocateStudent(filename, other.Matricula)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other.Nome = strings.Repeat("M", entity.MaxNomeLength)
+	if _, err := vs.UpdateByRID(filename, otherRID, other); err != nil {
+		t.Fatal(err)
+	}
+	want[other.Matricula] = other
+	checkVariableContents(t, vs, filename, want)
+	if got := fileBlocks(t, filename, blockSize); got != withOverflow {
+		t.Fatalf("arquivo com %d blocos após reaproveitar a cadeia liberada, esperados %d", got, withOverflow)
+	}
+
+	if err := vs.DeleteByRID(filename, rid); err != nil {
+		t.Fatal(err)
+	}
+	delete(want, target.Matricula)
+	if _, err := vs.GetByRID(filename, rid); err == nil {
+		t.Fatal("GetByRID encontrou o registro removido")
+	}
+	if _, err := vs.FindStudentByMatricula(filename, target.Matricula); err == nil {
+		t.Fatal("matrícula removida encontrada")
+	}
+
+	// Outra instância lê o mapa de espaço livre gravado e reaproveita o espaço removido
+	reopened, err := NewVariableStorage(blockSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	generated, err := domain.NewStudentGenerator().GenerateFrom(200000001, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	added := generated[0]
+	added.Nome = "B"
+	if _, err := reopened.InsertStudent(filename, added); err != nil {
+		t.Fatal(err)
+	}
+	want[added.Matricula] = added
+	checkVariableContents(t, reopened, filename, want)
+	if got := fileBlocks(t, filename, blockSize); got != withOverflow {
+		t.Fatalf("arquivo com %d blocos após inserir no espaço removido, esperados %d", got, withOverflow)
+	}
+}
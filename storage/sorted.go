@@ -0,0 +1,649 @@
+package storage
+
+import (
+	"aeds2-tp1/entity"
+	"encoding/binary"
+	"fmt"
+	"sort"
+)
+
+// SortedStorage é um arquivo sequencial ordenado por matrícula, com registros de tamanho
+// fixo no mesmo formato de FixedStorage. O bloco 0 guarda a quantidade de blocos da área
+// principal (4 bytes); os blocos 1..N formam a área principal, com os registros em ordem
+// de matrícula, e os blocos seguintes formam a área de overflow, que recebe as inserções
+// na ordem de chegada. A busca por matrícula faz busca binária nos blocos da área principal
+// e, se não encontrar, percorre o overflow. Remoções apenas marcam o slot, preservando a
+// ordem; Reorganize intercala o overflow na área principal
+type SortedStorage struct {
+	codec           *FixedStorage
+	blockSize       int
+	recordsPerBlock int
+	stats           StorageStats
+	keepBackup      bool
+}
+
+const sortedMetaBlock = 0
+
+// SortedAreaStats descreve a divisão do arquivo entre área principal e overflow
+type SortedAreaStats struct {
+	MainBlocks      int
+	MainRecords     int
+	OverflowBlocks  int
+	OverflowRecords int
+}
+
+func NewSortedStorage(blockSize int) (*SortedStorage, error) {
+	codec, err := NewFixedStorage(blockSize)
+	if err != nil {
+		return nil, err
+	}
+
+	return &SortedStorage{
+		codec:           codec,
+		blockSize:       blockSize,
+		recordsPerBlock: blockSize / codec.fixedRecordSize,
+		stats: StorageStats{
+			BlockStatsList: make([]BlockStats, 0),
+		},
+	}, nil
+}
+
+func (ss *SortedStorage) ValidateBlockSize(blockSize int) error {
+	return ss.codec.ValidateBlockSize(blockSize)
+}
+
+func (ss *SortedStorage) GetBlockSize() int {
+	return ss.blockSize
+}
+
+// SetReorganizeBackup define se Reorganize preserva o arquivo original em _backup.dat
+func (ss *SortedStorage) SetReorganizeBackup(keep bool) {
+	ss.keepBackup = keep
+}
+
+func (ss *SortedStorage) open(filename string, writable bool) (*blockFile, int, error) {
+	bf, err := openBlockFile(filename, ModeSorted, ss.blockSize, writable, writable)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if bf.totalBlocks() == 0 {
+		if !writable {
+			return bf, 0, nil
+		}
+		if err := ss.writeMainBlocks(bf, 0); err != nil {
+			bf.Close()
+			return nil, 0, err
+		}
+		return bf, 0, nil
+	}
+
+	meta, err := bf.readBlock(sortedMetaBlock)
+	if err != nil {
+		bf.Close()
+		return nil, 0, fmt.Errorf("erro ao ler bloco de controle: %w", err)
+	}
+	mainBlocks := int(binary.LittleEndian.Uint32(meta[0:4]))
+	if mainBlocks >= bf.totalBlocks() {
+		mainBlocks = bf.totalBlocks() - 1
+	}
+	return bf, mainBlocks, nil
+}
+
+func (ss *SortedStorage) writeMainBlocks(bf *blockFile, mainBlocks int) error {
+	meta := make([]byte, ss.blockSize)
+	binary.LittleEndian.PutUint32(meta[0:4], uint32(mainBlocks))
+	return bf.writeBlock(sortedMetaBlock, meta)
+}
+
+// WriteStudents grava todos os alunos na área principal, ordenados por matrícula
+func (ss *SortedStorage) WriteStudents(filename string, students []entity.Student) (err error) {
+	if err := checkBatchMatriculas(students); err != nil {
+		return err
+	}
+
+	sorted := append([]entity.Student(nil), students...)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Matricula < sorted[j].Matricula })
+
+	bf, err := createBlockFile(filename, ModeSorted, ss.blockSize)
+	if err != nil {
+		return err
+	}
+	defer closeBlockFile(bf, &err)
+
+	mainBlocks := (len(sorted) + ss.recordsPerBlock - 1) / ss.recordsPerBlock
+	if err := ss.writeMainBlocks(bf, mainBlocks); err != nil {
+		return err
+	}
+
+	for blockNum := 1; blockNum <= mainBlocks; blockNum++ {
+		block := make([]byte, ss.blockSize)
+		start := (blockNum - 1) * ss.recordsPerBlock
+		for i, student := range sorted[start:min(len(sorted), start+ss.recordsPerBlock)] {
+			copy(block[i*ss.codec.fixedRecordSize:], ss.codec.serializeStudentFixed(student))
+		}
+		if err := bf.writeBlock(blockNum, block); err != nil {
+			return fmt.Errorf("erro ao gravar bloco %d: %w", blockNum, err)
+		}
+	}
+
+	bf.addRecordCount(len(sorted))
+	return nil
+}
+
+func (ss *SortedStorage) slot(block []byte, i int) []byte {
+	offset := i * ss.codec.fixedRecordSize
+	return block[offset : offset+ss.codec.fixedRecordSize]
+}
+
+// lastKey é a maior matrícula gravada no bloco, inclusive de slots removidos, que mantêm a
+// matrícula para preservar a ordem da área principal
+func (ss *SortedStorage) lastKey(block []byte) int {
+	for i := ss.recordsPerBlock - 1; i >= 0; i-- {
+		if key := ss.codec.slotMatricula(ss.slot(block, i)); key > 0 {
+			return key
+		}
+	}
+	return 0
+}
+
+// locate procura o registro ativo da matrícula: busca binária pelo primeiro bloco da área
+// principal cuja maior matrícula não é menor que a procurada, seguida dos blocos vizinhos
+// com a mesma matrícula e, por fim, da área de overflow
+func (ss *SortedStorage) locate(bf *blockFile, mainBlocks int, matricula int) (RecordID, []byte, error) {
+	read := make(map[int][]byte)
+	readBlock := func(blockNum int) ([]byte, error) {
+		if block, ok := read[blockNum]; ok {
+			return block, nil
+		}
+		block, err := bf.readBlock(blockNum)
+		if err != nil {
+			return nil, fmt.Errorf("erro ao ler bloco %d: %w", blockNum, err)
+		}
+		read[blockNum] = block
+		return block, nil
+	}
+
+	lo, hi := 1, mainBlocks+1
+	for lo < hi {
+		mid := (lo + hi) / 2
+		block, err := readBlock(mid)
+		if err != nil {
+			return RecordID{}, nil, err
+		}
+		if ss.lastKey(block) < matricula {
+			lo = mid + 1
+		} else {
+			hi = mid
+		}
+	}
+
+mainArea:
+	for blockNum := lo; blockNum <= mainBlocks; blockNum++ {
+		block, err := readBlock(blockNum)
+		if err != nil {
+			return RecordID{}, nil, err
+		}
+		for i := 0; i < ss.recordsPerBlock; i++ {
+			slot := ss.slot(block, i)
+			key := ss.codec.slotMatricula(slot)
+			if key > matricula {
+				break mainArea
+			}
+			if key == matricula && ss.codec.isActiveSlot(slot) {
+				return RecordID{Block: blockNum, Slot: i}, slot, nil
+			}
+		}
+	}
+
+	for blockNum := mainBlocks + 1; blockNum < bf.totalBlocks(); blockNum++ {
+		block, err := bf.readBlock(blockNum)
+		if err != nil {
+			return RecordID{}, nil, fmt.Errorf("erro ao ler bloco %d: %w", blockNum, err)
+		}
+		for i := 0; i < ss.recordsPerBlock; i++ {
+			slot := ss.slot(block, i)
+			if ss.codec.isActiveSlot(slot) && ss.codec.slotMatricula(slot) == matricula {
+				return RecordID{Block: blockNum, Slot: i}, slot, nil
+			}
+		}
+	}
+
+	return RecordID{}, nil, fmt.Errorf("aluno com matrícula %d não encontrado", matricula)
+}
+
+func (ss *SortedStorage) FindStudentByMatricula(filename string, matricula int) (*entity.Student, error) {
+	bf, mainBlocks, err := ss.open(filename, false)
+	if err != nil {
+		return nil, err
+	}
+	defer bf.Close()
+
+	_, slot, err := ss.locate(bf, mainBlocks, matricula)
+	if err != nil {
+		return nil, err
+	}
+	return ss.codec.deserializeStudentFixed(slot)
+}
+
+// FindStudentByCPF percorre o arquivo; IndexedStorage usa o índice de CPF
+func (ss *SortedStorage) FindStudentByCPF(filename string, cpf string) (*entity.Student, error) {
+	return scanForCPF(ss, filename, cpf)
+}
+
+// FindStudentsByCurso percorre o arquivo; IndexedStorage usa o índice de curso
+func (ss *SortedStorage) FindStudentsByCurso(filename string, curso string) ([]*entity.Student, error) {
+	return scanStudentsWhere(ss, filename, sameCurso(curso))
+}
+
+// FindStudentsByAnoIngresso percorre o arquivo; IndexedStorage usa o índice de ano de ingresso
+func (ss *SortedStorage) FindStudentsByAnoIngresso(filename string, ano int) ([]*entity.Student, error) {
+	return scanStudentsWhere(ss, filename, sameAnoIngresso(ano))
+}
+
+// ScanStudentsByCA percorre o arquivo e entrega os alunos com CA entre min e max em ordem de CA
+func (ss *SortedStorage) ScanStudentsByCA(filename string, min float64, max float64, fn func(student *entity.Student) bool) error {
+	return scanByCA(ss, filename, min, max, fn)
+}
+
+// ScanStudentsByAnoIngresso percorre o arquivo e entrega os alunos com ano de ingresso entre
+// min e max em ordem de ano
+func (ss *SortedStorage) ScanStudentsByAnoIngresso(filename string, min int, max int, fn func(student *entity.Student) bool) error {
+	return scanByAnoIngresso(ss, filename, min, max, fn)
+}
+
+// ScanStudents percorre a área principal e depois o overflow, na ordem física
+func (ss *SortedStorage) ScanStudents(filename string, fn func(rid RecordID, student *entity.Student) bool) error {
+	bf, _, err := ss.open(filename, false)
+	if err != nil {
+		return err
+	}
+	defer bf.Close()
+
+	for blockNum := 1; blockNum < bf.totalBlocks(); blockNum++ {
+		block, err := bf.readBlock(blockNum)
+		if err != nil {
+			continue
+		}
+
+		for i := 0; i < ss.recordsPerBlock; i++ {
+			slot := ss.slot(block, i)
+			if !ss.codec.isActiveSlot(slot) {
+				continue
+			}
+
+			student, err := ss.codec.deserializeStudentFixed(slot)
+			if err != nil {
+				continue
+			}
+			if !fn(RecordID{Block: blockNum, Slot: i}, student) {
+				return nil
+			}
+		}
+	}
+	return nil
+}
+
+// GetAllStudents devolve os alunos em ordem de matrícula, intercalando a área principal com
+// o overflow ordenado em memória
+func (ss *SortedStorage) GetAllStudents(filename string) ([]*entity.Student, error) {
+	bf, mainBlocks, err := ss.open(filename, false)
+	if err != nil {
+		return nil, err
+	}
+	bf.Close()
+
+	main := make([]*entity.Student, 0)
+	overflow := make([]*entity.Student, 0)
+	err = ss.ScanStudents(filename, func(rid RecordID, student *entity.Student) bool {
+		if rid.Block <= mainBlocks {
+			main = append(main, student)
+		} else {
+			overflow = append(overflow, student)
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(overflow, func(i, j int) bool { return overflow[i].Matricula < overflow[j].Matricula })
+	students := make([]*entity.Student, 0, len(main)+len(overflow))
+	for len(main) > 0 || len(overflow) > 0 {
+		if len(overflow) == 0 || (len(main) > 0 && main[0].Matricula <= overflow[0].Matricula) {
+			students, main = append(students, main[0]), main[1:]
+		} else {
+			students, overflow = append(students, overflow[0]), overflow[1:]
+		}
+	}
+	return students, nil
+}
+
+func (ss *SortedStorage) AddStudents(filename string, students []entity.Student) (err error) {
+	if err := checkNewMatriculas(ss, filename, students); err != nil {
+		return err
+	}
+	_, err = ss.insertRecords(filename, students)
+	return err
+}
+
+// insertRecords grava o lote na área de overflow com uma única abertura do arquivo, sem
+// verificar as matrículas
+func (ss *SortedStorage) insertRecords(filename string, students []entity.Student) (_ []RecordID, err error) {
+	bf, mainBlocks, err := ss.open(filename, true)
+	if err != nil {
+		return nil, err
+	}
+	defer closeBlockFile(bf, &err)
+
+	return ss.appendOverflow(bf, mainBlocks, students)
+}
+
+func (ss *SortedStorage) InsertStudent(filename string, student entity.Student) (RecordID, error) {
+	if err := checkNewMatriculas(ss, filename, []entity.Student{student}); err != nil {
+		return RecordID{}, err
+	}
+
+	rids, err := ss.insertRecords(filename, []entity.Student{student})
+	if err != nil {
+		return RecordID{}, err
+	}
+	return rids[0], nil
+}
+
+// appendOverflow grava os alunos nos slots livres do último bloco de overflow e em blocos
+// novos no fim do arquivo; a área principal nunca recebe inserções
+func (ss *SortedStorage) appendOverflow(bf *blockFile, mainBlocks int, students []entity.Student) ([]RecordID, error) {
+	blockNum := bf.totalBlocks() - 1
+	block := make([]byte, ss.blockSize)
+	offset := ss.blockSize
+
+	if blockNum > mainBlocks {
+		var err error
+		block, err = bf.readBlock(blockNum)
+		if err != nil {
+			return nil, fmt.Errorf("erro ao ler último bloco: %w", err)
+		}
+		offset = ss.codec.nextFreeSlot(block, 0)
+	}
+
+	rids := make([]RecordID, 0, len(students))
+	dirty := false
+	for _, student := range students {
+		if offset+ss.codec.fixedRecordSize > ss.blockSize {
+			if dirty {
+				if err := bf.writeBlock(blockNum, block); err != nil {
+					return nil, err
+				}
+			}
+			blockNum++
+			block = make([]byte, ss.blockSize)
+			offset = 0
+		}
+
+		copy(block[offset:], ss.codec.serializeStudentFixed(student))
+		rids = append(rids, RecordID{Block: blockNum, Slot: offset / ss.codec.fixedRecordSize})
+		dirty = true
+		offset = ss.codec.nextFreeSlot(block, offset+ss.codec.fixedRecordSize)
+	}
+
+	bf.addRecordCount(len(students))
+	if dirty {
+		if err := bf.writeBlock(blockNum, block); err != nil {
+			return nil, err
+		}
+	}
+	return rids, nil
+}
+
+// slotAt devolve o conteúdo do slot ativo indicado por rid
+func (ss *SortedStorage) slotAt(bf *blockFile, rid RecordID) ([]byte, error) {
+	if rid.Block <= sortedMetaBlock || rid.Block >= bf.totalBlocks() || rid.Slot < 0 || rid.Slot >= ss.recordsPerBlock {
+		return nil, fmt.Errorf("%w: %s", ErrRecordNotFound, rid)
+	}
+
+	block, err := bf.readBlock(rid.Block)
+	if err != nil {
+		return nil, err
+	}
+
+	slot := ss.slot(block, rid.Slot)
+	if !ss.codec.isActiveSlot(slot) {
+		return nil, fmt.Errorf("%w: %s", ErrRecordNotFound, rid)
+	}
+	return slot, nil
+}
+
+func (ss *SortedStorage) GetByRID(filename string, rid RecordID) (*entity.Student, error) {
+	bf, _, err := ss.open(filename, false)
+	if err != nil {
+		return nil, err
+	}
+	defer bf.Close()
+
+	slot, err := ss.slotAt(bf, rid)
+	if err != nil {
+		return nil, err
+	}
+	return ss.codec.deserializeStudentFixed(slot)
+}
+
+// UpdateByRID sobrescreve o slot, exceto quando um registro da área principal muda de
+// matrícula: ele é removido e regravado no overflow para não quebrar a ordem
+func (ss *SortedStorage) UpdateByRID(filename string, rid RecordID, student entity.Student) (RecordID, error) {
+	if err := checkUpdatedMatricula(ss, filename, rid, student); err != nil {
+		return RecordID{}, err
+	}
+	return ss.updateRecord(filename, rid, student)
+}
+
+// updateRecord é o UpdateByRID sem a verificação de matrícula
+func (ss *SortedStorage) updateRecord(filename string, rid RecordID, student entity.Student) (_ RecordID, err error) {
+	bf, mainBlocks, err := ss.open(filename, true)
+	if err != nil {
+		return RecordID{}, err
+	}
+	defer closeBlockFile(bf, &err)
+
+	return ss.updateAt(bf, mainBlocks, rid, student)
+}
+
+func (ss *SortedStorage) updateAt(bf *blockFile, mainBlocks int, rid RecordID, student entity.Student) (RecordID, error) {
+	slot, err := ss.slotAt(bf, rid)
+	if err != nil {
+		return RecordID{}, err
+	}
+
+	offset := rid.Slot * ss.codec.fixedRecordSize
+	if rid.Block > mainBlocks || ss.codec.slotMatricula(slot) == student.Matricula {
+		return rid, bf.writeAt(rid.Block, offset, ss.codec.serializeStudentFixed(student))
+	}
+
+	if err := bf.writeAt(rid.Block, offset, []byte{StatusDeleted}); err != nil {
+		return RecordID{}, err
+	}
+	bf.addRecordCount(-1)
+	rids, err := ss.appendOverflow(bf, mainBlocks, []entity.Student{student})
+	if err != nil {
+		return RecordID{}, err
+	}
+	return rids[0], nil
+}
+
+func (ss *SortedStorage) UpdateStudent(filename string, student entity.Student) (err error) {
+	bf, mainBlocks, err := ss.open(filename, true)
+	if err != nil {
+		return err
+	}
+	defer closeBlockFile(bf, &err)
+
+	rid, _, err := ss.locate(bf, mainBlocks, student.Matricula)
+	if err != nil {
+		return err
+	}
+	_, err = ss.updateAt(bf, mainBlocks, rid, student)
+	return err
+}
+
+func (ss *SortedStorage) DeleteByRID(filename string, rid RecordID) (err error) {
+	bf, _, err := ss.open(filename, true)
+	if err != nil {
+		return err
+	}
+	defer closeBlockFile(bf, &err)
+
+	if _, err := ss.slotAt(bf, rid); err != nil {
+		return err
+	}
+	return ss.deleteAt(bf, rid)
+}
+
+// deleteAt marca o slot como removido, mantendo a matrícula que ordena a área principal
+func (ss *SortedStorage) deleteAt(bf *blockFile, rid RecordID) error {
+	if err := bf.writeAt(rid.Block, rid.Slot*ss.codec.fixedRecordSize, []byte{StatusDeleted}); err != nil {
+		return err
+	}
+	bf.addRecordCount(-1)
+	return nil
+}
+
+func (ss *SortedStorage) DeleteStudent(filename string, matricula int) (err error) {
+	bf, mainBlocks, err := ss.open(filename, true)
+	if err != nil {
+		return err
+	}
+	defer closeBlockFile(bf, &err)
+
+	rid, _, err := ss.locate(bf, mainBlocks, matricula)
+	if err != nil {
+		return fmt.Errorf("aluno não encontrado")
+	}
+	return ss.deleteAt(bf, rid)
+}
+
+// AreaStats conta blocos e registros ativos da área principal e do overflow
+func (ss *SortedStorage) AreaStats(filename string) (*SortedAreaStats, error) {
+	bf, mainBlocks, err := ss.open(filename, false)
+	if err != nil {
+		return nil, err
+	}
+	totalBlocks := bf.totalBlocks()
+	bf.Close()
+
+	stats := &SortedAreaStats{MainBlocks: mainBlocks, OverflowBlocks: max(0, totalBlocks-1-mainBlocks)}
+	err = ss.ScanStudents(filename, func(rid RecordID, _ *entity.Student) bool {
+		if rid.Block <= mainBlocks {
+			stats.MainRecords++
+		} else {
+			stats.OverflowRecords++
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	return stats, nil
+}
+
+func (ss *SortedStorage) GetStats(filename string) StorageStats {
+	ss.recalculateStatsFromFile(filename)
+	return ss.stats
+}
+
+// recalculateStatsFromFile considera apenas os blocos de dados, sem o bloco de controle
+func (ss *SortedStorage) recalculateStatsFromFile(filename string) {
+	bf, _, err := ss.open(filename, false)
+	if err != nil {
+		return
+	}
+	defer bf.Close()
+
+	totalBlocks := max(0, bf.totalBlocks()-1)
+	ss.stats = StorageStats{
+		TotalBlocks:     totalBlocks,
+		TotalBytesTotal: totalBlocks * ss.blockSize,
+		BlockStatsList:  make([]BlockStats, 0),
+	}
+
+	for blockNum := 1; blockNum <= totalBlocks; blockNum++ {
+		block, err := bf.readBlock(blockNum)
+		if err != nil {
+			continue
+		}
+
+		recordsCount := 0
+		deletedCount := 0
+		for i := 0; i < ss.recordsPerBlock; i++ {
+			slot := ss.slot(block, i)
+			if ss.codec.isActiveSlot(slot) {
+				recordsCount++
+			} else if slot[0] == StatusDeleted {
+				deletedCount++
+			}
+		}
+
+		bytesUsed := recordsCount * ss.codec.fixedRecordSize
+		occupancyRate := float64(bytesUsed) / float64(ss.blockSize) * 100
+		blockStats := BlockStats{
+			BlockNumber:   blockNum - 1,
+			BytesUsed:     bytesUsed,
+			BytesTotal:    ss.blockSize,
+			OccupancyRate: occupancyRate,
+			RecordsCount:  recordsCount,
+			LiveBytes:     bytesUsed,
+			DeadBytes:     deletedCount * ss.codec.fixedRecordSize,
+		}
+		ss.stats.TotalBytesUsed += bytesUsed
+		ss.stats.TotalLiveBytes += blockStats.LiveBytes
+		ss.stats.TotalDeadBytes += blockStats.DeadBytes
+		ss.stats.TotalTombstones += deletedCount
+
+		if occupancyRate < 100 && occupancyRate > 0 {
+			ss.stats.PartialBlocks++
+		}
+
+		ss.stats.BlockStatsList = append(ss.stats.BlockStatsList, blockStats)
+	}
+
+	if ss.stats.TotalBytesTotal > 0 {
+		ss.stats.EfficiencyRate = float64(ss.stats.TotalBytesUsed) / float64(ss.stats.TotalBytesTotal) * 100
+	}
+}
+
+// Reorganize intercala o overflow na área principal e descarta os registros removidos
+func (ss *SortedStorage) Reorganize(filename string) (*ReorganizationReport, error) {
+	statsBefore := ss.GetStats(filename)
+
+	students, err := ss.GetAllStudents(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	tempFilename := temporaryFilename(filename)
+
+	tempStorage, err := NewSortedStorage(ss.blockSize)
+	if err != nil {
+		return nil, err
+	}
+
+	studentsValue := make([]entity.Student, len(students))
+	for i, s := range students {
+		studentsValue[i] = *s
+	}
+
+	err = tempStorage.WriteStudents(tempFilename, studentsValue)
+	if err != nil {
+		removeTemporaryFiles(tempFilename)
+		return nil, err
+	}
+
+	backup, err := replaceFile(tempFilename, filename, ss.keepBackup, indexExtensions...)
+	if err != nil {
+		return nil, err
+	}
+
+	statsAfter := ss.GetStats(filename)
+	report := newReorganizationReport(statsBefore, statsAfter)
+	report.BackupFilename = backup
+	return report, nil
+}
@@ -0,0 +1,254 @@
+package storage
+
+import (
+	"aeds2-tp1/domain"
+	"aeds2-tp1/entity"
+	"math/bits"
+	"path/filepath"
+	"testing"
+)
+
+// sortedTestStudents gera alunos com matrículas pares, deixando as ímpares para inserções
+// que caem entre registros da área principal
+func sortedTestStudents(count int) []entity.Student {
+	students := domain.NewStudentGenerator().Generate(count)
+	for i := range students {
+		students[i].Matricula = 100000000 + 2*(i+1)
+	}
+	return students
+}
+
+func newSortedTestFile(t *testing.T, students []entity.Student) (*SortedStorage, string) {
+	t.Helper()
+	ss, err := NewSortedStorage(512)
+	if err != nil {
+		t.Fatal(err)
+	}
+	filename := filepath.Join(t.TempDir(), "alunos.dat")
+	if err := ss.WriteStudents(filename, students); err != nil {
+		t.Fatal(err)
+	}
+	return ss, filename
+}
+
+func locateRID(t *testing.T, ss *SortedStorage, filename string, matricula int) RecordID {
+	t.Helper()
+	found := false
+	var rid RecordID
+	err := ss.ScanStudents(filename, func(r RecordID, student *entity.Student) bool {
+		if student.Matricula == matricula {
+			rid, found = r, true
+		}
+		return !found
+	})
+	if err != nil || !found {
+		t.Fatalf("matrícula %d não encontrada na varredura: %v", matricula, err)
+	}
+	return rid
+}
+
+func checkSortedOrder(t *testing.T, ss *SortedStorage, filename string, want int) {
+	t.Helper()
+	all, err := ss.GetAllStudents(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != want {
+		t.Fatalf("GetAllStudents devolveu %d alunos, esperados %d", len(all), want)
+	}
+	for i := 1; i < len(all); i++ {
+		if all[i-1].Matricula >= all[i].Matricula {
+			t.Fatalf("alunos fora de ordem na posição %d: %d, %d", i, all[i-1].Matricula, all[i].Matricula)
+		}
+	}
+}
+
+func TestSortedStorageBinarySearchSkipsTombstones(t *testing.T) {
+	students := sortedTestStudents(400)
+	ss, filename := newSortedTestFile(t, students)
+
+	// Remove blocos inteiros da área principal e slots espalhados pelos demais
+	deleted := make(map[int]bool)
+	for i := range students {
+		if i < 3*ss.recordsPerBlock || i%4 == 0 {
+			if err := ss.DeleteStudent(filename, students[i].Matricula); err != nil {
+				t.Fatal(err)
+			}
+			deleted[students[i].Matricula] = true
+		}
+	}
+
+	area, err := ss.AreaStats(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if area.OverflowBlocks != 0 {
+		t.Fatalf("remoções criaram %d blocos de overflow", area.OverflowBlocks)
+	}
+
+	// Busca binária nos blocos da área principal mais o bloco de controle
+	maxReads := int64(bits.Len(uint(area.MainBlocks)) + 2)
+	for _, student := range students {
+		before := blockReads.Load()
+		got, err := ss.FindStudentByMatricula(filename, student.Matricula)
+		reads := blockReads.Load() - before
+		if deleted[student.Matricula] {
+			if err == nil {
+				t.Fatalf("matrícula removida %d encontrada", student.Matricula)
+			}
+			continue
+		}
+		if err != nil || got.Nome != student.Nome {
+			t.Fatalf("FindStudentByMatricula(%d): %v", student.Matricula, err)
+		}
+		if reads > maxReads {
+			t.Fatalf("busca por %d leu %d blocos de %d da área principal", student.Matricula, reads, area.MainBlocks)
+		}
+	}
+	checkSortedOrder(t, ss, filename, len(students)-len(deleted))
+}
+
+func TestSortedStorageOverflowLookup(t *testing.T) {
+	students := sortedTestStudents(200)
+	ss, filename := newSortedTestFile(t, students)
+
+	// Matrículas ímpares ficam entre registros da área principal, mas vão para o overflow
+	added := domain.NewStudentGenerator().Generate(30)
+	for i := range added {
+		added[i].Matricula = 100000001 + 14*i
+	}
+	if err := ss.AddStudents(filename, added[:20]); err != nil {
+		t.Fatal(err)
+	}
+	for _, student := range added[20:] {
+		if _, err := ss.InsertStudent(filename, student); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	area, err := ss.AreaStats(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if area.MainRecords != len(students) || area.OverflowRecords != len(added) || area.OverflowBlocks == 0 {
+		t.Fatalf("área principal com %d registros, overflow com %d em %d blocos", area.MainRecords, area.OverflowRecords, area.OverflowBlocks)
+	}
+
+	for _, student := range append(students, added...) {
+		got, err := ss.FindStudentByMatricula(filename, student.Matricula)
+		if err != nil || got.Nome != student.Nome {
+			t.Fatalf("FindStudentByMatricula(%d): %v", student.Matricula, err)
+		}
+	}
+	if _, err := ss.FindStudentByMatricula(filename, 100000003); err == nil {
+		t.Fatal("matrícula inexistente encontrada")
+	}
+
+	// A busca sequencial do overflow ignora slots removidos
+	if err := ss.DeleteStudent(filename, added[29].Matricula); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ss.FindStudentByMatricula(filename, added[29].Matricula); err == nil {
+		t.Fatal("matrícula removida do overflow encontrada")
+	}
+	checkSortedOrder(t, ss, filename, len(students)+len(added)-1)
+}
+
+func TestSortedStorageUpdateByRIDMovesChangedMatriculaToOverflow(t *testing.T) {
+	students := sortedTestStudents(200)
+	ss, filename := newSortedTestFile(t, students)
+
+	original := students[50]
+	rid := locateRID(t, ss, filename, original.Matricula)
+
+	// Mesma matrícula: o slot é sobrescrito no lugar
+	renamed := original
+	renamed.Nome = "Nome Atualizado"
+	newRID, err := ss.UpdateByRID(filename, rid, renamed)
+	if err != nil || newRID != rid {
+		t.Fatalf("UpdateByRID sem mudar a matrícula = %s, %v (esperado %s)", newRID, err, rid)
+	}
+
+	// Matrícula nova: o registro sai da área principal para não quebrar a ordem
+	moved := renamed
+	moved.Matricula = 100000001
+	newRID, err = ss.UpdateByRID(filename, rid, moved)
+	if err != nil {
+		t.Fatal(err)
+	}
+	area, err := ss.AreaStats(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if newRID.Block <= area.MainBlocks || area.MainRecords != len(students)-1 || area.OverflowRecords != 1 {
+		t.Fatalf("registro movido para %s; área principal com %d registros e overflow com %d", newRID, area.MainRecords, area.OverflowRecords)
+	}
+
+	if _, err := ss.FindStudentByMatricula(filename, original.Matricula); err == nil {
+		t.Fatal("matrícula antiga ainda encontrada")
+	}
+	got, err := ss.GetByRID(filename, newRID)
+	if err != nil || got.Matricula != moved.Matricula || got.Nome != moved.Nome {
+		t.Fatalf("GetByRID(%s) = %+v, %v", newRID, got, err)
+	}
+	if got, err := ss.FindStudentByMatricula(filename, moved.Matricula); err != nil || got.Nome != moved.Nome {
+		t.Fatalf("FindStudentByMatricula(%d): %v", moved.Matricula, err)
+	}
+	if _, err := ss.GetByRID(filename, rid); err == nil {
+		t.Fatal("o slot antigo da área principal continua ativo")
+	}
+	checkSortedOrder(t, ss, filename, len(students))
+}
+
+func TestSortedStorageReorganizeMergesOverflow(t *testing.T) {
+	students := sortedTestStudents(300)
+	ss, filename := newSortedTestFile(t, students)
+
+	added := domain.NewStudentGenerator().Generate(60)
+	for i := range added {
+		added[i].Matricula = 100000601 - 10*i
+	}
+	if err := ss.AddStudents(filename, added); err != nil {
+		t.Fatal(err)
+	}
+	for _, student := range students[:40] {
+		if err := ss.DeleteStudent(filename, student.Matricula); err != nil {
+			t.Fatal(err)
+		}
+	}
+	live := len(students) - 40 + len(added)
+
+	if _, err := ss.Reorganize(filename); err != nil {
+		t.Fatal(err)
+	}
+
+	area, err := ss.AreaStats(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if area.OverflowBlocks != 0 || area.OverflowRecords != 0 || area.MainRecords != live {
+		t.Fatalf("após Reorganize: %d registros na área principal, %d no overflow em %d blocos", area.MainRecords, area.OverflowRecords, area.OverflowBlocks)
+	}
+	if want := (live + ss.recordsPerBlock - 1) / ss.recordsPerBlock; area.MainBlocks != want {
+		t.Fatalf("área principal com %d blocos, esperados %d", area.MainBlocks, want)
+	}
+
+	// A ordem física da área principal passa a incluir os registros do overflow
+	previous := 0
+	err = ss.ScanStudents(filename, func(_ RecordID, student *entity.Student) bool {
+		if student.Matricula <= previous {
+			t.Fatalf("ordem física quebrada: %d depois de %d", student.Matricula, previous)
+		}
+		previous = student.Matricula
+		return true
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, student := range append(students[40:], added...) {
+		if _, err := ss.FindStudentByMatricula(filename, student.Matricula); err != nil {
+			t.Fatal(err)
+		}
+	}
+	checkSortedOrder(t, ss, filename, live)
+}
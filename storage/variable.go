@@ -4,17 +4,35 @@ import (
 	"aeds2-tp1/entity"
 	"encoding/binary"
 	"fmt"
-	"os"
 )
 
 const (
-	StatusActive  = 0
-	StatusDeleted = 1
+	StatusActive   = 0
+	StatusDeleted  = 1
+	StatusOverflow = 2
 )
 
 type VariableStorage struct {
 	blockSize int
 	stats      StorageStats
+
+	fsm           *freeSpaceMap
+	fsmFilename   string
+	fsmGeneration uint64
+
+	filters           *blockFilters
+	filtersFilename   string
+	filtersGeneration uint64
+	bloom             bloomCounters
+
+	policy        AllocationPolicy
+	nextFitCursor int
+
+	keepBackup bool
+
+	autoReorganize   AutoReorganizePolicy
+	onAutoReorganize func(report *ReorganizationReport)
+	opsSinceReorg    int
 }
 
 func NewVariableStorage(blockSize int) (*VariableStorage, error) {
@@ -32,59 +50,130 @@ func NewVariableStorage(blockSize int) (*VariableStorage, error) {
 	return vs, nil
 }
 
+// SetAllocationPolicy define como AddStudents e as realocações de UpdateStudent escolhem
+// o bloco de destino; o padrão é First Fit
+func (vs *VariableStorage) SetAllocationPolicy(policy AllocationPolicy) {
+	vs.policy = policy
+	vs.nextFitCursor = 0
+}
+
+func (vs *VariableStorage) GetAllocationPolicy() AllocationPolicy {
+	return vs.policy
+}
+
+// ValidateBlockSize exige apenas espaço para o stub de um registro em overflow: registros
+// que não cabem em uma página vazia continuam em páginas de overflow
 func (vs *VariableStorage) ValidateBlockSize(blockSize int) error {
-	minSize := 4 + 1 +
-		4 + entity.MaxNomeLength +
-		entity.CPFLength +
-		4 + entity.MaxCursoLength +
-		4 + entity.MaxFiliacaoLength +
-		4 + entity.MaxFiliacaoLength +
-		4 +
-		8
+	minSize := pageHeaderSize + slotEntrySize + overflowStubSize
 	
 	if blockSize < minSize {
-		return fmt.Errorf("tamanho do bloco (%d bytes) é menor que o tamanho mínimo necessário para um registro variável (%d bytes)", blockSize, minSize)
+		return fmt.Errorf("tamanho do bloco (%d bytes) é menor que o tamanho mínimo necessário para o stub de um registro variável (%d bytes)", blockSize, minSize)
 	}
 	
 	return nil
 }
 
-func (vs *VariableStorage) WriteStudents(filename string, students []entity.Student) error {
-	file, err := os.Create(filename)
+func (vs *VariableStorage) WriteStudents(filename string, students []entity.Student) (err error) {
+	if err := checkBatchMatriculas(students); err != nil {
+		return err
+	}
+
+	bf, err := createBlockFile(filename, ModeVariable, vs.blockSize)
 	if err != nil {
-		return fmt.Errorf("erro ao criar arquivo: %w", err)
+		return err
 	}
-	defer file.Close()
+	defer closeBlockFile(bf, &err)
 
-	currentBlock := make([]byte, 0, vs.blockSize)
-	currentBlockNumber := 0
-	blockStats := BlockStats{
-		BlockNumber: currentBlockNumber,
-		BytesUsed:   0,
-		BytesTotal:  vs.blockSize,
+	vs.stats = StorageStats{
+		BlockStatsList: make([]BlockStats, 0),
 	}
 
-	for i, student := range students {
+	free := make([]int, 0)
+	vs.filters = newBlockFilters(bloomFilterBytes(vs.blockSize), 0)
+	vs.filtersFilename = filename
+	overflow := make([][]byte, 0)
+	page := newSlottedPage(vs.blockSize)
+	for _, student := range students {
 		recordData := vs.serializeStudent(student)
 		
-		if len(recordData) > vs.blockSize {
-			return fmt.Errorf("registro do aluno %d (matrícula: %d) excede o tamanho do bloco (%d bytes > %d bytes). Aumente o tamanho do bloco", i+1, student.Matricula, len(recordData), vs.blockSize)
+		// Registros maiores que uma página são gravados depois, em páginas de overflow
+		if len(recordData) > vs.maxRecordSize() {
+			overflow = append(overflow, recordData)
+			continue
 		}
 		
-		vs.writeContiguousRecord(&currentBlock, &currentBlockNumber, &blockStats, recordData, file, i == len(students)-1)
+		if page.insert(recordData) < 0 {
+			if err := vs.flushPage(bf, page); err != nil {
+				return err
+			}
+			vs.filters.set(len(free), vs.pageKeys(page))
+			free = append(free, page.freeSpace())
+			page = newSlottedPage(vs.blockSize)
+			page.insert(recordData)
+		}
 	}
 
-	if len(currentBlock) > 0 {
-		blockStats.OccupancyRate = float64(blockStats.BytesUsed) / float64(blockStats.BytesTotal) * 100
-		vs.stats.BlockStatsList = append(vs.stats.BlockStatsList, blockStats)
-		vs.writeBlock(file, currentBlock)
-		vs.stats.TotalBlocks++
-		vs.stats.TotalBytesUsed += blockStats.BytesUsed
-		vs.stats.TotalBytesTotal += blockStats.BytesTotal
+	if page.slotCount() > 0 {
+		if err := vs.flushPage(bf, page); err != nil {
+			return err
+		}
+		vs.filters.set(len(free), vs.pageKeys(page))
+		free = append(free, page.freeSpace())
 	}
 
+	bf.addRecordCount(len(students))
 	vs.calculateFinalStats()
-	return nil
+
+	vs.fsm = newFreeSpaceMap(free)
+	vs.fsmFilename = filename
+	if _, err := vs.insertRecordData(bf, vs.fsm, overflow); err != nil {
+		return err
+	}
+	return vs.saveFreeSpace(bf)
+}
+
+// flushPage grava a página como próximo bloco do arquivo e acumula suas estatísticas
+func (vs *VariableStorage) flushPage(bf *blockFile, page *slottedPage) error {
+	blockStats := vs.pageStats(len(vs.stats.BlockStatsList), page)
+	if blockStats.OccupancyRate < 100 {
+		vs.stats.PartialBlocks++
+	}
+	vs.stats.BlockStatsList = append(vs.stats.BlockStatsList, blockStats)
+	vs.stats.TotalBlocks++
+	vs.stats.TotalBytesUsed += blockStats.BytesUsed
+	vs.stats.TotalBytesTotal += blockStats.BytesTotal
+	return bf.appendBlock(page.data)
+}
+
+func (vs *VariableStorage) pageStats(blockNum int, page *slottedPage) BlockStats {
+	recordsCount := 0
+	for slot := 0; slot < page.slotCount(); slot++ {
+		if page.isLive(slot) {
+			recordsCount++
+		}
+	}
+
+	// Bytes de registros removidos não contam como ocupados: a próxima inserção no bloco
+	// pode reaproveitá-los
+	bytesUsed := 0
+	if page.slotCount() > 0 {
+		bytesUsed = pageHeaderSize + page.slotCount()*slotEntrySize + page.liveBytes()
+	}
+
+	return BlockStats{
+		BlockNumber:   blockNum,
+		BytesUsed:     bytesUsed,
+		BytesTotal:    vs.blockSize,
+		OccupancyRate: float64(bytesUsed) / float64(vs.blockSize) * 100,
+		RecordsCount:  recordsCount,
+		LiveBytes:     page.liveBytes(),
+		DeadBytes:     page.deadBytes(),
+	}
+}
+
+// maxRecordSize é o maior registro que cabe em uma página vazia
+func (vs *VariableStorage) maxRecordSize() int {
+	return vs.blockSize - pageHeaderSize - slotEntrySize
 }
 
 func (vs *VariableStorage) serializeStudent(student entity.Student) []byte {
@@ -126,7 +215,7 @@ func (vs *VariableStorage) serializeStudent(student entity.Student) []byte {
 	payload = append(payload, anoBytes...)
 	
 	caBytes := make([]byte, 8)
-	binary.LittleEndian.PutUint64(caBytes, uint64(student.CA*100))
+	binary.LittleEndian.PutUint64(caBytes, uint64(caCents(student.CA)))
 	payload = append(payload, caBytes...)
 	
 	totalSize := uint32(1 + len(payload))
@@ -143,41 +232,6 @@ func (vs *VariableStorage) serializeStudent(student entity.Student) []byte {
 	return finalData
 }
 
-func (vs *VariableStorage) writeContiguousRecord(currentBlock *[]byte, currentBlockNumber *int, blockStats *BlockStats, recordData []byte, file *os.File, isLast bool) {
-	recordSize := len(recordData)
-	
-	if len(*currentBlock)+recordSize > vs.blockSize {
-		if len(*currentBlock) > 0 {
-			blockStats.OccupancyRate = float64(blockStats.BytesUsed) / float64(blockStats.BytesTotal) * 100
-			if blockStats.OccupancyRate < 100 {
-				vs.stats.PartialBlocks++
-			}
-			vs.stats.BlockStatsList = append(vs.stats.BlockStatsList, *blockStats)
-			vs.writeBlock(file, *currentBlock)
-			vs.stats.TotalBlocks++
-			vs.stats.TotalBytesUsed += blockStats.BytesUsed
-			vs.stats.TotalBytesTotal += blockStats.BytesTotal
-		}
-		
-		*currentBlock = make([]byte, 0, vs.blockSize)
-		*currentBlockNumber++
-		*blockStats = BlockStats{
-			BlockNumber: *currentBlockNumber,
-			BytesUsed:   0,
-			BytesTotal:  vs.blockSize,
-		}
-	}
-	
-	*currentBlock = append(*currentBlock, recordData...)
-	blockStats.BytesUsed += recordSize
-	blockStats.RecordsCount++
-}
-
-func (vs *VariableStorage) writeBlock(file *os.File, block []byte) {
-	paddedBlock := make([]byte, vs.blockSize)
-	copy(paddedBlock, block)
-	file.Write(paddedBlock)
-}
 
 func (vs *VariableStorage) calculateFinalStats() {
 	if vs.stats.TotalBytesTotal > 0 {
@@ -191,73 +245,45 @@ func (vs *VariableStorage) GetStats(filename string) StorageStats {
 }
 
 func (vs *VariableStorage) recalculateStatsFromFile(filename string) {
-	fileInfo, err := os.Stat(filename)
+	bf, err := openBlockFile(filename, ModeVariable, vs.blockSize, false, false)
 	if err != nil {
 		return
 	}
+	defer bf.Close()
 
-	totalBlocks := int(fileInfo.Size()) / vs.blockSize
+	totalBlocks := bf.totalBlocks()
 	vs.stats = StorageStats{
 		TotalBlocks:     totalBlocks,
 		TotalBytesTotal: totalBlocks * vs.blockSize,
 		BlockStatsList:  make([]BlockStats, 0),
 	}
 
-	file, err := os.Open(filename)
-	if err != nil {
-		return
-	}
-	defer file.Close()
-
 	totalUsed := 0
 	for blockNum := 0; blockNum < totalBlocks; blockNum++ {
-		block := make([]byte, vs.blockSize)
-		_, err := file.ReadAt(block, int64(blockNum*vs.blockSize))
+		block, err := bf.readBlock(blockNum)
 		if err != nil {
 			continue
 		}
 
-		bytesUsed := 0
-		recordsCount := 0
-		offset := 0
-		for offset < vs.blockSize {
-			if offset+4 > vs.blockSize {
-				break
-			}
-			
-			if block[offset] == 0 && block[offset+1] == 0 && block[offset+2] == 0 && block[offset+3] == 0 {
-				break
-			}
-
-			student, bytesConsumed, err := vs.deserializeStudentFromBlock(block, offset)
-			if err != nil {
-				if bytesConsumed > 0 {
-					offset += bytesConsumed
-					continue
-				}
-				break
-			}
-
-			if student != nil {
-				recordsCount++
+		page := loadSlottedPage(block)
+		if page.isOverflow() {
+			blockStats := vs.overflowStats(blockNum, page)
+			totalUsed += blockStats.BytesUsed
+			vs.stats.TotalLiveBytes += blockStats.LiveBytes
+			vs.stats.BlockStatsList = append(vs.stats.BlockStatsList, blockStats)
+			if blockStats.OccupancyRate < 100 {
+				vs.stats.PartialBlocks++
 			}
-			
-			bytesUsed += bytesConsumed
-			offset += bytesConsumed
+			continue
 		}
 
-		totalUsed += bytesUsed
-
-		occupancyRate := float64(bytesUsed) / float64(vs.blockSize) * 100
-		blockStats := BlockStats{
-			BlockNumber:   blockNum,
-			BytesUsed:     bytesUsed,
-			BytesTotal:    vs.blockSize,
-			OccupancyRate: occupancyRate,
-			RecordsCount:  recordsCount,
-		}
+		blockStats := vs.pageStats(blockNum, page)
+		totalUsed += blockStats.BytesUsed
+		vs.stats.TotalLiveBytes += blockStats.LiveBytes
+		vs.stats.TotalDeadBytes += blockStats.DeadBytes
+		vs.stats.TotalTombstones += page.deadRecords()
 
-		if occupancyRate < 100 && occupancyRate > 0 {
+		if blockStats.OccupancyRate < 100 && blockStats.OccupancyRate > 0 {
 			vs.stats.PartialBlocks++
 		}
 
@@ -270,62 +296,94 @@ func (vs *VariableStorage) recalculateStatsFromFile(filename string) {
 	}
 }
 
+// FindStudentByCPF percorre o arquivo; IndexedStorage usa o índice de CPF
+func (vs *VariableStorage) FindStudentByCPF(filename string, cpf string) (*entity.Student, error) {
+	return scanForCPF(vs, filename, cpf)
+}
+
+// FindStudentsByCurso percorre o arquivo; IndexedStorage usa o índice de curso
+func (vs *VariableStorage) FindStudentsByCurso(filename string, curso string) ([]*entity.Student, error) {
+	return scanStudentsWhere(vs, filename, sameCurso(curso))
+}
+
+// FindStudentsByAnoIngresso percorre o arquivo; IndexedStorage usa o índice de ano de ingresso
+func (vs *VariableStorage) FindStudentsByAnoIngresso(filename string, ano int) ([]*entity.Student, error) {
+	return scanStudentsWhere(vs, filename, sameAnoIngresso(ano))
+}
+
+// ScanStudentsByCA percorre o arquivo e entrega os alunos com CA entre min e max em ordem de CA
+func (vs *VariableStorage) ScanStudentsByCA(filename string, min float64, max float64, fn func(student *entity.Student) bool) error {
+	return scanByCA(vs, filename, min, max, fn)
+}
+
+// ScanStudentsByAnoIngresso percorre o arquivo e entrega os alunos com ano de ingresso entre
+// min e max em ordem de ano
+func (vs *VariableStorage) ScanStudentsByAnoIngresso(filename string, min int, max int, fn func(student *entity.Student) bool) error {
+	return scanByAnoIngresso(vs, filename, min, max, fn)
+}
+
 func (vs *VariableStorage) FindStudentByMatricula(filename string, matricula int) (*entity.Student, error) {
-	file, err := os.Open(filename)
+	bf, err := openBlockFile(filename, ModeVariable, vs.blockSize, false, false)
+	if err != nil {
+		return nil, err
+	}
+	defer bf.Close()
+
+	_, page, slot, err := vs.findStudentPage(bf, filename, matricula)
+	if err != nil {
+		return nil, fmt.Errorf("aluno com matrícula %d não encontrado", matricula)
+	}
+
+	record, err := vs.resolveRecord(bf, page.record(slot))
 	if err != nil {
-		return nil, fmt.Errorf("erro ao abrir arquivo: %w", err)
+		return nil, err
 	}
-	defer file.Close()
+	student, _, err := vs.deserializeStudentFromBlock(record, 0)
+	if err != nil {
+		return nil, err
+	}
+	return student, nil
+}
 
-	fileInfo, err := file.Stat()
+// LocateStudent devolve o identificador estável (bloco, slot) do aluno
+func (vs *VariableStorage) LocateStudent(filename string, matricula int) (RecordID, error) {
+	bf, err := openBlockFile(filename, ModeVariable, vs.blockSize, false, false)
 	if err != nil {
-		return nil, fmt.Errorf("erro ao obter informações do arquivo: %w", err)
+		return RecordID{}, err
 	}
+	defer bf.Close()
 
-	totalBlocks := int(fileInfo.Size()) / vs.blockSize
-	return vs.findStudentContiguous(file, totalBlocks, matricula)
+	return vs.findStudentLocation(bf, filename, matricula)
 }
 
-func (vs *VariableStorage) findStudentContiguous(file *os.File, totalBlocks int, matricula int) (*entity.Student, error) {
+// scanStudents percorre os alunos ativos na ordem física; fn devolve false para interromper
+func (vs *VariableStorage) scanStudents(bf *blockFile, totalBlocks int, fn func(rid RecordID, student *entity.Student) bool) {
 	for blockNum := 0; blockNum < totalBlocks; blockNum++ {
-		block := make([]byte, vs.blockSize)
-		_, err := file.ReadAt(block, int64(blockNum*vs.blockSize))
+		block, err := bf.readBlock(blockNum)
 		if err != nil {
 			continue
 		}
 
-		offset := 0
-		for offset < vs.blockSize {
-			if offset+4 > vs.blockSize {
-				break
+		page := loadSlottedPage(block)
+		for slot := 0; slot < page.slotCount(); slot++ {
+			record, err := vs.resolveRecord(bf, page.record(slot))
+			if err != nil || record == nil {
+				continue
 			}
 
-			if block[offset] == 0 && block[offset+1] == 0 && block[offset+2] == 0 && block[offset+3] == 0 {
-				break
+			student, _, err := vs.deserializeStudentFromBlock(record, 0)
+			if err != nil || student == nil {
+				continue
 			}
 
-			student, bytesConsumed, err := vs.deserializeStudentFromBlock(block, offset)
-			if err != nil {
-				if bytesConsumed > 0 {
-					offset += bytesConsumed
-					continue
-				}
-				break
-			}
-			
-			if student != nil {
-				if student.Matricula == matricula {
-					return student, nil
-				}
+			if !fn(RecordID{Block: blockNum, Slot: slot}, student) {
+				return
 			}
-
-			offset += bytesConsumed
 		}
 	}
-
-	return nil, fmt.Errorf("aluno com matrícula %d não encontrado", matricula)
 }
 
+
 func (vs *VariableStorage) deserializeStudentFromBlock(block []byte, offset int) (*entity.Student, int, error) {
 	if offset+4 > len(block) {
 		return nil, 0, fmt.Errorf("offset fora dos limites")
@@ -473,134 +531,232 @@ func (vs *VariableStorage) GetBlockSize() int {
 	return vs.blockSize
 }
 
+// SetReorganizeBackup define se Reorganize preserva o arquivo original em _backup.dat
+func (vs *VariableStorage) SetReorganizeBackup(keep bool) {
+	vs.keepBackup = keep
+}
+
 func (vs *VariableStorage) GetAllStudents(filename string) ([]*entity.Student, error) {
-	file, err := os.Open(filename)
+	bf, err := openBlockFile(filename, ModeVariable, vs.blockSize, false, false)
+	if err != nil {
+		return nil, err
+	}
+	defer bf.Close()
+
+	students := make([]*entity.Student, 0)
+	vs.scanStudents(bf, bf.totalBlocks(), func(_ RecordID, student *entity.Student) bool {
+		if student.Matricula > 0 {
+			students = append(students, student)
+		}
+		return true
+	})
+
+	return students, nil
+}
+
+// AddStudents com inserção inteligente no final dos blocos, segundo a política de alocação
+// configurada, consultando o mapa de espaço livre em vez de varrer o arquivo
+func (vs *VariableStorage) AddStudents(filename string, students []entity.Student) (err error) {
+	if err := checkNewMatriculas(vs, filename, students); err != nil {
+		return err
+	}
+	_, err = vs.insertRecords(filename, students)
+	return err
+}
+
+// insertRecords grava o lote com uma única abertura do arquivo e grava o mapa de espaço livre
+// e os filtros de Bloom uma vez, sem verificar as matrículas
+func (vs *VariableStorage) insertRecords(filename string, students []entity.Student) (_ []RecordID, err error) {
+	bf, err := openBlockFile(filename, ModeVariable, vs.blockSize, true, true)
 	if err != nil {
-		return nil, fmt.Errorf("erro ao abrir arquivo: %w", err)
+		return nil, err
+	}
+	defer closeBlockFile(bf, &err)
+
+	fsm := vs.loadFreeSpace(bf, filename)
+
+	records := make([][]byte, len(students))
+	for i, student := range students {
+		records[i] = vs.serializeStudent(student)
 	}
-	defer file.Close()
 
-	fileInfo, err := file.Stat()
+	rids, err := vs.insertRecordData(bf, fsm, records)
 	if err != nil {
-		return nil, fmt.Errorf("erro ao obter informações do arquivo: %w", err)
+		return nil, err
 	}
 
-	totalBlocks := int(fileInfo.Size()) / vs.blockSize
-	students := make([]*entity.Student, 0)
+	bf.addRecordCount(len(students))
+	return rids, vs.saveFreeSpace(bf)
+}
 
-	for blockNum := 0; blockNum < totalBlocks; blockNum++ {
-		block := make([]byte, vs.blockSize)
-		_, err := file.ReadAt(block, int64(blockNum*vs.blockSize))
+func (vs *VariableStorage) insertRecordData(bf *blockFile, fsm *freeSpaceMap, records [][]byte) ([]RecordID, error) {
+	rids := make([]RecordID, 0, len(records))
+	for _, recordData := range records {
+		rid, err := vs.insertRecord(bf, fsm, recordData)
 		if err != nil {
-			continue
+			return nil, err
 		}
+		rids = append(rids, rid)
+	}
+	return rids, nil
+}
 
-		offset := 0
-		for offset < vs.blockSize {
-			if offset+4 > vs.blockSize {
-				break
-			}
+// insertRecord grava o registro (ou seu stub de overflow) no bloco escolhido pela
+// política de alocação, ou em um bloco novo, e devolve o identificador atribuído
+func (vs *VariableStorage) insertRecord(bf *blockFile, fsm *freeSpaceMap, recordData []byte) (RecordID, error) {
+	home, err := vs.homeRecord(bf, fsm, recordData)
+	if err != nil {
+		return RecordID{}, err
+	}
+	return vs.placeRecord(bf, fsm, home)
+}
 
-			if block[offset] == 0 && block[offset+1] == 0 && block[offset+2] == 0 && block[offset+3] == 0 {
-				break
-			}
+func (vs *VariableStorage) placeRecord(bf *blockFile, fsm *freeSpaceMap, recordData []byte) (RecordID, error) {
+	var page *slottedPage
+	blockNum := fsm.findBlock(vs.policy, len(recordData), vs.nextFitCursor)
+	if blockNum >= 0 {
+		block, err := bf.readBlock(blockNum)
+		if err != nil {
+			return RecordID{}, err
+		}
+		page = loadSlottedPage(block)
+	} else {
+		blockNum = fsm.len()
+		page = newSlottedPage(vs.blockSize)
+		fsm.append(0)
+	}
+	vs.nextFitCursor = blockNum
+
+	slot := page.insert(recordData)
+	if slot < 0 {
+		return RecordID{}, fmt.Errorf("mapa de espaço livre inconsistente no bloco %d", blockNum)
+	}
+	if err := bf.writeBlock(blockNum, page.data); err != nil {
+		return RecordID{}, err
+	}
+	fsm.set(blockNum, page.freeSpace())
+	vs.filters.set(blockNum, vs.pageKeys(page))
+	return RecordID{Block: blockNum, Slot: slot}, nil
+}
 
-			student, bytesConsumed, err := vs.deserializeStudentFromBlock(block, offset)
+
+// loadFreeSpace devolve o mapa de espaço livre do arquivo, reaproveitando o que está em
+// memória ou o arquivo .fsm quando a geração confere; caso contrário reconstrói a partir dos blocos.
+// Também carrega os filtros de Bloom, mantidos junto com o mapa. Deve ser chamado antes da
+// primeira escrita da operação
+func (vs *VariableStorage) loadFreeSpace(bf *blockFile, filename string) *freeSpaceMap {
+	vs.loadBlockFilters(bf, filename)
+	totalBlocks := bf.totalBlocks()
+	if vs.fsm != nil && vs.fsmFilename == filename && vs.fsmGeneration == bf.header.Generation && vs.fsm.len() == totalBlocks {
+		return vs.fsm
+	}
+
+	fsm := loadFreeSpaceMap(companionFilename(filename, ".fsm"), bf.header.Generation, totalBlocks)
+	if fsm == nil {
+		free := make([]int, totalBlocks)
+		for blockNum := 0; blockNum < totalBlocks; blockNum++ {
+			block, err := bf.readBlock(blockNum)
 			if err != nil {
-				if bytesConsumed > 0 {
-					offset += bytesConsumed
-					continue
-				}
-				break
+				continue
 			}
-			
-			if student != nil && student.Matricula > 0 {
-				students = append(students, student)
+			// Páginas de overflow não recebem inserções
+			if page := loadSlottedPage(block); !page.isOverflow() {
+				free[blockNum] = page.freeSpace()
 			}
-			
-			offset += bytesConsumed
 		}
+		fsm = newFreeSpaceMap(free)
 	}
 
-	return students, nil
+	vs.fsm = fsm
+	vs.fsmFilename = filename
+	vs.fsmGeneration = bf.header.Generation
+	return fsm
 }
 
-// AddStudents com inserção inteligente (Best/First Fit no final dos blocos)
-func (vs *VariableStorage) AddStudents(filename string, students []entity.Student) error {
-	vs.recalculateStatsFromFile(filename)
-
-	file, err := os.OpenFile(filename, os.O_RDWR|os.O_CREATE, 0644)
-	if err != nil {
-		return fmt.Errorf("erro ao abrir arquivo: %w", err)
+// saveFreeSpace grava o mapa de espaço livre e os filtros de Bloom com a geração atual
+func (vs *VariableStorage) saveFreeSpace(bf *blockFile) error {
+	vs.fsmGeneration = bf.header.Generation
+	if err := vs.fsm.save(companionFilename(vs.fsmFilename, ".fsm"), vs.fsmGeneration); err != nil {
+		return err
 	}
-	defer file.Close()
 
-	for _, student := range students {
-		recordData := vs.serializeStudent(student)
-		recordSize := len(recordData)
+	vs.filtersGeneration = bf.header.Generation
+	vs.filters.resize(bf.totalBlocks())
+	return vs.filters.save(companionFilename(vs.filtersFilename, bloomExtension), vs.filtersGeneration)
+}
 
-		if recordSize > vs.blockSize {
-			return fmt.Errorf("registro muito grande para o bloco")
-		}
+// loadBlockFilters devolve os filtros de Bloom do arquivo, reaproveitando os que estão em
+// memória ou o arquivo .blm quando a geração confere; caso contrário os reconstrói a partir
+// das páginas e grava o arquivo
+func (vs *VariableStorage) loadBlockFilters(bf *blockFile, filename string) *blockFilters {
+	totalBlocks := bf.totalBlocks()
+	size := bloomFilterBytes(vs.blockSize)
+	if vs.filters != nil && vs.filtersFilename == filename && vs.filtersGeneration == bf.header.Generation && vs.filters.len() == totalBlocks {
+		return vs.filters
+	}
 
-		inserted := false
-
-		for i, blockStats := range vs.stats.BlockStatsList {
-			if blockStats.BytesUsed + recordSize <= vs.blockSize {
-				block := make([]byte, vs.blockSize)
-				_, err := file.ReadAt(block, int64(i * vs.blockSize))
-				if err == nil {
-					offset := 0
-					for offset < vs.blockSize {
-						if offset+4 > vs.blockSize { break }
-						sz := int(binary.LittleEndian.Uint32(block[offset:offset+4]))
-						if sz == 0 { break }
-						offset += 4 + sz
-					}
-					
-					if offset + recordSize <= vs.blockSize {
-						copy(block[offset:], recordData)
-						vs.writeBlockAt(file, block, int64(i))
-						
-						vs.stats.BlockStatsList[i].BytesUsed += recordSize
-						vs.stats.TotalBytesUsed += recordSize
-						inserted = true
-						break
-					}
-				}
+	filtersFilename := companionFilename(filename, bloomExtension)
+	filters := loadBlockFiltersFile(filtersFilename, bf.header.Generation, totalBlocks, size)
+	if filters == nil {
+		filters = newBlockFilters(size, totalBlocks)
+		for blockNum := 0; blockNum < totalBlocks; blockNum++ {
+			block, err := bf.readBlock(blockNum)
+			if err != nil {
+				continue
 			}
+			filters.set(blockNum, vs.pageKeys(loadSlottedPage(block)))
 		}
+		filters.save(filtersFilename, bf.header.Generation)
+	}
 
-		if inserted {
-			continue
-		}
+	vs.filters = filters
+	vs.filtersFilename = filename
+	vs.filtersGeneration = bf.header.Generation
+	return filters
+}
 
-		newBlock := make([]byte, vs.blockSize)
-		copy(newBlock, recordData)
-		
-		offset := int64(vs.stats.TotalBlocks * vs.blockSize)
-		_, err = file.WriteAt(newBlock, offset)
-		if err != nil {
-			return err
-		}
+// pageKeys devolve as matrículas dos registros e stubs da página; páginas de overflow não têm
+func (vs *VariableStorage) pageKeys(page *slottedPage) []int {
+	if page.isOverflow() {
+		return nil
+	}
 
-		vs.stats.TotalBlocks++
-		vs.stats.TotalBytesTotal += vs.blockSize
-		vs.stats.TotalBytesUsed += recordSize
-		
-		newStat := BlockStats{
-			BlockNumber: vs.stats.TotalBlocks - 1,
-			BytesUsed: recordSize,
-			BytesTotal: vs.blockSize,
+	keys := make([]int, 0, page.slotCount())
+	for slot := 0; slot < page.slotCount(); slot++ {
+		record := page.record(slot)
+		if len(record) < 9 || record[4] == StatusDeleted {
+			continue
 		}
-		vs.stats.BlockStatsList = append(vs.stats.BlockStatsList, newStat)
+		keys = append(keys, int(binary.LittleEndian.Uint32(record[5:9])))
 	}
+	return keys
+}
 
-	vs.calculateFinalStats()
-	return nil
+// BloomStats descreve os filtros de Bloom do arquivo e os blocos que as buscas por
+// matrícula desta instância deixaram de ler
+func (vs *VariableStorage) BloomStats(filename string) (*BloomFilterStats, error) {
+	bf, err := openBlockFile(filename, ModeVariable, vs.blockSize, false, false)
+	if err != nil {
+		return nil, err
+	}
+	defer bf.Close()
+
+	filters := vs.loadBlockFilters(bf, filename)
+	fillRate, nonEmpty := filters.fillRate()
+	return &BloomFilterStats{
+		Blocks:         filters.len(),
+		Filters:        nonEmpty,
+		FilterBytes:    filters.size,
+		Hashes:         bloomHashes,
+		FillRate:       fillRate,
+		Lookups:        vs.bloom.lookups,
+		BlocksRead:     vs.bloom.blocksRead,
+		BlocksSkipped:  vs.bloom.blocksSkipped,
+		FalsePositives: vs.bloom.falsePositives,
+	}, nil
 }
 
-// Reorganize: Compactação física
+// Reorganize: Compactação física, substituindo o arquivo original (ver replaceFile)
 func (vs *VariableStorage) Reorganize(filename string) (*ReorganizationReport, error) {
 	statsBefore := vs.GetStats(filename)
 
@@ -609,12 +765,7 @@ func (vs *VariableStorage) Reorganize(filename string) (*ReorganizationReport, e
 		return nil, err
 	}
 
-	reorgFilename := filename
-	if len(filename) > 4 && filename[len(filename)-4:] == ".dat" {
-		reorgFilename = filename[:len(filename)-4] + "_reorg.dat"
-	} else {
-		reorgFilename = filename + "_reorg.dat"
-	}
+	tempFilename := temporaryFilename(filename)
 
 	tempStorage, err := NewVariableStorage(vs.blockSize)
 	if err != nil {
@@ -626,189 +777,286 @@ func (vs *VariableStorage) Reorganize(filename string) (*ReorganizationReport, e
 		studentsValue[i] = *s
 	}
 	
-	err = tempStorage.WriteStudents(reorgFilename, studentsValue)
+	err = tempStorage.WriteStudents(tempFilename, studentsValue)
 	if err != nil {
+		removeTemporaryFiles(tempFilename, ".fsm", bloomExtension)
 		return nil, err
 	}
-	
-	statsAfter := tempStorage.GetStats(reorgFilename)
-	
-	occBefore := 0.0
-	if statsBefore.TotalBlocks > 0 {
-		sum := 0.0
-		for _, b := range statsBefore.BlockStatsList {
-			sum += b.OccupancyRate
-		}
-		occBefore = sum / float64(statsBefore.TotalBlocks)
-	}
-	
-	occAfter := 0.0
-	if statsAfter.TotalBlocks > 0 {
-		sum := 0.0
-		for _, b := range statsAfter.BlockStatsList {
-			sum += b.OccupancyRate
-		}
-		occAfter = sum / float64(statsAfter.TotalBlocks)
-	}
 
-	report := &ReorganizationReport{
-		BlocksBefore:     statsBefore.TotalBlocks,
-		BlocksAfter:      statsAfter.TotalBlocks,
-		OccupancyBefore:  occBefore,
-		OccupancyAfter:   occAfter,
-		EfficiencyBefore: statsBefore.EfficiencyRate,
-		EfficiencyAfter:  statsAfter.EfficiencyRate,
-		EfficiencyGain:   statsAfter.EfficiencyRate - statsBefore.EfficiencyRate,
-		FreedBlocks:      statsBefore.TotalBlocks - statsAfter.TotalBlocks,
+	backup, err := replaceFile(tempFilename, filename, vs.keepBackup, append([]string{".fsm", bloomExtension}, indexExtensions...)...)
+	if err != nil {
+		return nil, err
 	}
-	
+	vs.fsm = nil
+	vs.filters = nil
+
+	statsAfter := vs.GetStats(filename)
+	report := newReorganizationReport(statsBefore, statsAfter)
+	report.BackupFilename = backup
 	return report, nil
 }
 
-// FindStudentLocation e helpers
-func (vs *VariableStorage) findStudentLocation(file *os.File, totalBlocks int, matricula int) (int, int, int, error) {
+func (vs *VariableStorage) findStudentLocation(bf *blockFile, filename string, matricula int) (RecordID, error) {
+	rid, _, _, err := vs.findStudentPage(bf, filename, matricula)
+	return rid, err
+}
+
+// findStudentPage percorre os blocos cujo filtro de Bloom pode conter a matrícula, sem ler
+// nem decodificar os demais, e devolve a posição e a página do registro
+func (vs *VariableStorage) findStudentPage(bf *blockFile, filename string, matricula int) (RecordID, *slottedPage, int, error) {
+	filters := vs.loadBlockFilters(bf, filename)
+	vs.bloom.lookups++
+
+	totalBlocks := bf.totalBlocks()
 	for blockNum := 0; blockNum < totalBlocks; blockNum++ {
-		block := make([]byte, vs.blockSize)
-		_, err := file.ReadAt(block, int64(blockNum*vs.blockSize))
-		if err != nil {
+		if !filters.mayContain(blockNum, matricula) {
+			vs.bloom.blocksSkipped++
 			continue
 		}
 
-		offset := 0
-		for offset < vs.blockSize {
-			if offset+4 > vs.blockSize {
-				break
-			}
-			
-			if block[offset] == 0 && block[offset+1] == 0 && block[offset+2] == 0 && block[offset+3] == 0 {
-				break
-			}
-
-			totalSize := int(binary.LittleEndian.Uint32(block[offset : offset+4]))
-			if totalSize == 0 || offset+4+totalSize > len(block) {
-				break
-			}
-			
-			status := block[offset+4]
-			bytesConsumed := 4 + totalSize
+		block, err := bf.readBlock(blockNum)
+		if err != nil {
+			continue
+		}
+		vs.bloom.blocksRead++
 
-			if status == StatusDeleted {
-				offset += bytesConsumed
+		page := loadSlottedPage(block)
+		for slot := 0; slot < page.slotCount(); slot++ {
+			record := page.record(slot)
+			if len(record) < 9 || record[4] == StatusDeleted {
 				continue
 			}
 
-			if offset+9 <= len(block) {
-				matrBytes := block[offset+5 : offset+9]
-				readMatricula := int(binary.LittleEndian.Uint32(matrBytes))
-				
-				if readMatricula == matricula {
-					return blockNum, offset, bytesConsumed, nil
-				}
+			if int(binary.LittleEndian.Uint32(record[5:9])) == matricula {
+				return RecordID{Block: blockNum, Slot: slot}, page, slot, nil
 			}
-
-			offset += bytesConsumed
 		}
+		vs.bloom.falsePositives++
 	}
-	return -1, -1, 0, fmt.Errorf("aluno não encontrado")
+	return RecordID{}, nil, 0, fmt.Errorf("aluno não encontrado")
 }
 
+// UpdateStudent regrava o aluno no mesmo slot quando ele ainda cabe no bloco (mantendo o
+// RecordID); caso contrário o registro é removido e reinserido em outro bloco
 func (vs *VariableStorage) UpdateStudent(filename string, updatedStudent entity.Student) error {
-	file, err := os.OpenFile(filename, os.O_RDWR, 0644)
-	if err != nil {
-		return fmt.Errorf("erro ao abrir arquivo: %w", err)
+	if err := vs.updateStudent(filename, updatedStudent); err != nil {
+		return err
 	}
-	defer file.Close()
+	return vs.checkAutoReorganize(filename)
+}
 
-	fileInfo, err := file.Stat()
+func (vs *VariableStorage) updateStudent(filename string, updatedStudent entity.Student) (err error) {
+	bf, err := openBlockFile(filename, ModeVariable, vs.blockSize, true, false)
 	if err != nil {
-		return fmt.Errorf("erro ao ler stats: %w", err)
+		return err
 	}
-	totalBlocks := int(fileInfo.Size()) / vs.blockSize
+	defer closeBlockFile(bf, &err)
 
-	blockNum, offset, oldTotalSize, err := vs.findStudentLocation(file, totalBlocks, updatedStudent.Matricula)
+	rid, err := vs.findStudentLocation(bf, filename, updatedStudent.Matricula)
 	if err != nil {
 		return err
 	}
 
-	newRecord := vs.serializeStudent(updatedStudent)
-	newTotalSize := len(newRecord)
+	_, err = vs.updateAt(bf, filename, rid, updatedStudent)
+	return err
+}
+
+// updateAt regrava o registro de rid, devolvendo sua posição final
+func (vs *VariableStorage) updateAt(bf *blockFile, filename string, rid RecordID, updatedStudent entity.Student) (RecordID, error) {
+	fsm := vs.loadFreeSpace(bf, filename)
+
+	newRecord, err := vs.homeRecord(bf, fsm, vs.serializeStudent(updatedStudent))
+	if err != nil {
+		return RecordID{}, err
+	}
 
-	block := make([]byte, vs.blockSize)
-	blockStart := int64(blockNum * vs.blockSize)
-	_, err = file.ReadAt(block, blockStart)
+	block, err := bf.readBlock(rid.Block)
+	if err != nil {
+		return RecordID{}, err
+	}
+	page := loadSlottedPage(block)
+	oldRecord := append([]byte(nil), page.record(rid.Slot)...)
+
+	relocate := !page.replace(rid.Slot, newRecord)
+	if relocate {
+		page.remove(rid.Slot)
+	}
+
+	if err := bf.writeBlock(rid.Block, page.data); err != nil {
+		return RecordID{}, err
+	}
+	fsm.set(rid.Block, page.freeSpace())
+	vs.filters.set(rid.Block, vs.pageKeys(page))
+
+	if relocate {
+		rid, err = vs.placeRecord(bf, fsm, newRecord)
+		if err != nil {
+			return RecordID{}, err
+		}
+	}
+
+	// A cadeia antiga só é liberada depois que a nova versão está gravada
+	if isOverflowStub(oldRecord) {
+		if err := vs.freeOverflow(bf, fsm, oldRecord); err != nil {
+			return RecordID{}, err
+		}
+	}
+	return rid, vs.saveFreeSpace(bf)
+}
+
+func (vs *VariableStorage) DeleteStudent(filename string, matricula int) error {
+	if err := vs.deleteStudent(filename, matricula); err != nil {
+		return err
+	}
+	return vs.checkAutoReorganize(filename)
+}
+
+func (vs *VariableStorage) deleteStudent(filename string, matricula int) (err error) {
+	bf, err := openBlockFile(filename, ModeVariable, vs.blockSize, true, false)
 	if err != nil {
 		return err
 	}
+	defer closeBlockFile(bf, &err)
 
-	realBytesUsed := 0
-	checkOffset := 0
-	for checkOffset < vs.blockSize {
-		if checkOffset+4 > vs.blockSize { break }
-		ts := int(binary.LittleEndian.Uint32(block[checkOffset:checkOffset+4]))
-		if ts == 0 { break }
-		realBytesUsed += 4 + ts
-		checkOffset += 4 + ts
+	rid, err := vs.findStudentLocation(bf, filename, matricula)
+	if err != nil {
+		return fmt.Errorf("aluno não encontrado")
 	}
 
-	spaceFree := vs.blockSize - realBytesUsed
-	sizeDiff := newTotalSize - oldTotalSize
+	return vs.deleteAt(bf, filename, rid)
+}
+
+func (vs *VariableStorage) deleteAt(bf *blockFile, filename string, rid RecordID) error {
+	fsm := vs.loadFreeSpace(bf, filename)
+	block, err := bf.readBlock(rid.Block)
+	if err != nil {
+		return err
+	}
 
-	canFitInBlock := (spaceFree >= sizeDiff)
+	page := loadSlottedPage(block)
+	oldRecord := append([]byte(nil), page.record(rid.Slot)...)
+	page.remove(rid.Slot)
+	if err := bf.writeBlock(rid.Block, page.data); err != nil {
+		return err
+	}
 
-	if canFitInBlock {
-		newBlock := make([]byte, 0, vs.blockSize)
-		newBlock = append(newBlock, block[:offset]...)
-		newBlock = append(newBlock, newRecord...)
-		remainingStart := offset + oldTotalSize
-		if remainingStart < realBytesUsed {
-			newBlock = append(newBlock, block[remainingStart:realBytesUsed]...)
+	fsm.set(rid.Block, page.freeSpace())
+	vs.filters.set(rid.Block, vs.pageKeys(page))
+	if isOverflowStub(oldRecord) {
+		if err := vs.freeOverflow(bf, fsm, oldRecord); err != nil {
+			return err
 		}
-		
-		vs.writeBlockAt(file, newBlock, int64(blockNum))
-		vs.recalculateStatsFromFile(filename)
-		return nil
 	}
+	bf.addRecordCount(-1)
+	return vs.saveFreeSpace(bf)
+}
+
+func (vs *VariableStorage) InsertStudent(filename string, student entity.Student) (RecordID, error) {
+	if err := checkNewMatriculas(vs, filename, []entity.Student{student}); err != nil {
+		return RecordID{}, err
+	}
+
+	rids, err := vs.insertRecords(filename, []entity.Student{student})
+	if err != nil {
+		return RecordID{}, err
+	}
+	return rids[0], nil
+}
 
-	_, err = file.WriteAt([]byte{StatusDeleted}, blockStart+int64(offset)+4)
+func (vs *VariableStorage) ScanStudents(filename string, fn func(rid RecordID, student *entity.Student) bool) error {
+	bf, err := openBlockFile(filename, ModeVariable, vs.blockSize, false, false)
 	if err != nil {
 		return err
 	}
-	
-	file.Close() 
-	
-	return vs.AddStudents(filename, []entity.Student{updatedStudent})
+	defer bf.Close()
+
+	vs.scanStudents(bf, bf.totalBlocks(), func(rid RecordID, student *entity.Student) bool {
+		if student.Matricula <= 0 {
+			return true
+		}
+		return fn(rid, student)
+	})
+	return nil
 }
 
-func (vs *VariableStorage) DeleteStudent(filename string, matricula int) error {
-	file, err := os.OpenFile(filename, os.O_RDWR, 0644)
+// pageAt lê a página de rid, verificando que o slot está ocupado
+func (vs *VariableStorage) pageAt(bf *blockFile, rid RecordID) (*slottedPage, error) {
+	if rid.Block < 0 || rid.Block >= bf.totalBlocks() {
+		return nil, fmt.Errorf("%w: %s", ErrRecordNotFound, rid)
+	}
+
+	block, err := bf.readBlock(rid.Block)
 	if err != nil {
-		return fmt.Errorf("erro ao abrir arquivo: %w", err)
+		return nil, err
 	}
-	defer file.Close()
 
-	fileInfo, err := file.Stat()
+	page := loadSlottedPage(block)
+	if !page.isLive(rid.Slot) {
+		return nil, fmt.Errorf("%w: %s", ErrRecordNotFound, rid)
+	}
+	return page, nil
+}
+
+func (vs *VariableStorage) GetByRID(filename string, rid RecordID) (*entity.Student, error) {
+	bf, err := openBlockFile(filename, ModeVariable, vs.blockSize, false, false)
 	if err != nil {
-		return fmt.Errorf("erro ao obter status do arquivo: %w", err)
+		return nil, err
 	}
+	defer bf.Close()
 
-	totalBlocks := int(fileInfo.Size()) / vs.blockSize
-	blockNum, offset, _, err := vs.findStudentLocation(file, totalBlocks, matricula)
+	page, err := vs.pageAt(bf, rid)
 	if err != nil {
-		return fmt.Errorf("aluno não encontrado")
+		return nil, err
 	}
 
-	statusOffset := int64(blockNum*vs.blockSize) + int64(offset) + 4
-	_, err = file.WriteAt([]byte{StatusDeleted}, statusOffset)
-	
-	if err == nil {
-		vs.recalculateStatsFromFile(filename)
+	record, err := vs.resolveRecord(bf, page.record(rid.Slot))
+	if err != nil {
+		return nil, err
 	}
-	return err
+
+	student, _, err := vs.deserializeStudentFromBlock(record, 0)
+	if err != nil {
+		return nil, err
+	}
+	if student == nil {
+		return nil, fmt.Errorf("%w: %s", ErrRecordNotFound, rid)
+	}
+	return student, nil
 }
 
-func (vs *VariableStorage) writeBlockAt(file *os.File, block []byte, blockIndex int64) error {
-	padded := make([]byte, vs.blockSize)
-	copy(padded, block)
-	_, err := file.WriteAt(padded, blockIndex*int64(vs.blockSize))
-	return err
+// UpdateByRID devolve o novo RecordID quando o registro não cabe mais no bloco e é
+// realocado. Operações por RecordID não disparam a reorganização automática, que
+// invalidaria o identificador devolvido
+func (vs *VariableStorage) UpdateByRID(filename string, rid RecordID, student entity.Student) (RecordID, error) {
+	if err := checkUpdatedMatricula(vs, filename, rid, student); err != nil {
+		return RecordID{}, err
+	}
+	return vs.updateRecord(filename, rid, student)
+}
+
+// updateRecord é o UpdateByRID sem a verificação de matrícula
+func (vs *VariableStorage) updateRecord(filename string, rid RecordID, student entity.Student) (_ RecordID, err error) {
+	bf, err := openBlockFile(filename, ModeVariable, vs.blockSize, true, false)
+	if err != nil {
+		return RecordID{}, err
+	}
+	defer closeBlockFile(bf, &err)
+
+	if _, err := vs.pageAt(bf, rid); err != nil {
+		return RecordID{}, err
+	}
+	return vs.updateAt(bf, filename, rid, student)
+}
+
+func (vs *VariableStorage) DeleteByRID(filename string, rid RecordID) (err error) {
+	bf, err := openBlockFile(filename, ModeVariable, vs.blockSize, true, false)
+	if err != nil {
+		return err
+	}
+	defer closeBlockFile(bf, &err)
+
+	if _, err := vs.pageAt(bf, rid); err != nil {
+		return err
+	}
+	return vs.deleteAt(bf, filename, rid)
 }
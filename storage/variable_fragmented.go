@@ -4,12 +4,28 @@ import (
 	"aeds2-tp1/entity"
 	"encoding/binary"
 	"fmt"
-	"os"
+)
+
+// Cabeçalho de cada pedaço (chunk): flags (1) + status (1) + tamanho (4)
+const fragmentHeaderSize = 6
+
+const (
+	chunkHasNext        = 1 << 0
+	chunkIsContinuation = 1 << 1
 )
 
 type VariableFragmentedStorage struct {
-	blockSize int
-	stats     StorageStats
+	blockSize  int
+	stats      StorageStats
+	keepBackup bool
+}
+
+type fragmentChunk struct {
+	blockNum int
+	offset   int
+	flags    byte
+	status   byte
+	size     int
 }
 
 func NewVariableFragmentedStorage(blockSize int) (*VariableFragmentedStorage, error) {
@@ -28,7 +44,7 @@ func NewVariableFragmentedStorage(blockSize int) (*VariableFragmentedStorage, er
 }
 
 func (vfs *VariableFragmentedStorage) ValidateBlockSize(blockSize int) error {
-	minSize := 4 +
+	minSize := fragmentHeaderSize +
 		4 + entity.MaxNomeLength +
 		entity.CPFLength +
 		4 + entity.MaxCursoLength +
@@ -44,12 +60,16 @@ func (vfs *VariableFragmentedStorage) ValidateBlockSize(blockSize int) error {
 	return nil
 }
 
-func (vfs *VariableFragmentedStorage) WriteStudents(filename string, students []entity.Student) error {
-	file, err := os.Create(filename)
+func (vfs *VariableFragmentedStorage) WriteStudents(filename string, students []entity.Student) (err error) {
+	if err := checkBatchMatriculas(students); err != nil {
+		return err
+	}
+
+	bf, err := createBlockFile(filename, ModeVariableFragmented, vfs.blockSize)
 	if err != nil {
-		return fmt.Errorf("erro ao criar arquivo: %w", err)
+		return err
 	}
-	defer file.Close()
+	defer closeBlockFile(bf, &err)
 
 	currentBlock := make([]byte, 0, vfs.blockSize)
 	currentBlockNumber := 0
@@ -61,30 +81,48 @@ func (vfs *VariableFragmentedStorage) WriteStudents(filename string, students []
 
 	for i, student := range students {
 		recordData := vfs.serializeStudent(student)
-		vfs.writeFragmentedRecord(&currentBlock, &currentBlockNumber, &blockStats, recordData, file, i == len(students)-1)
+		if _, err := vfs.writeFragmentedRecord(&currentBlock, &currentBlockNumber, &blockStats, recordData, bf, i == len(students)-1); err != nil {
+			return err
+		}
 	}
 
 	if len(currentBlock) > 0 {
 		blockStats.OccupancyRate = float64(blockStats.BytesUsed) / float64(blockStats.BytesTotal) * 100
 		vfs.stats.BlockStatsList = append(vfs.stats.BlockStatsList, blockStats)
-		vfs.writeBlock(file, currentBlock)
+		if err := bf.appendBlock(currentBlock); err != nil {
+			return err
+		}
 		vfs.stats.TotalBlocks++
 		vfs.stats.TotalBytesUsed += blockStats.BytesUsed
 		vfs.stats.TotalBytesTotal += blockStats.BytesTotal
 	}
 
+	bf.addRecordCount(len(students))
 	vfs.calculateFinalStats()
 	return nil
 }
 
-func (vfs *VariableFragmentedStorage) writeFragmentedRecord(currentBlock *[]byte, currentBlockNumber *int, blockStats *BlockStats, recordData []byte, file *os.File, isLast bool) {
+func (vfs *VariableFragmentedStorage) chunkHeader(flags byte, size int) []byte {
+	header := make([]byte, fragmentHeaderSize)
+	header[0] = flags
+	header[1] = StatusActive
+	binary.LittleEndian.PutUint32(header[2:6], uint32(size))
+	return header
+}
+
+// writeFragmentedRecord acrescenta o registro ao bloco corrente, espalhando-o pelos blocos
+// seguintes se necessário, e devolve a posição do pedaço inicial
+func (vfs *VariableFragmentedStorage) writeFragmentedRecord(currentBlock *[]byte, currentBlockNumber *int, blockStats *BlockStats, recordData []byte, bf *blockFile, isLast bool) (RecordID, error) {
 	recordSize := len(recordData)
 	availableSpace := vfs.blockSize - len(*currentBlock)
 
-	if recordSize <= availableSpace {
+	if fragmentHeaderSize+recordSize <= availableSpace {
+		head := RecordID{Block: *currentBlockNumber, Slot: len(*currentBlock)}
+		*currentBlock = append(*currentBlock, vfs.chunkHeader(0, recordSize)...)
 		*currentBlock = append(*currentBlock, recordData...)
-		blockStats.BytesUsed += recordSize
+		blockStats.BytesUsed += fragmentHeaderSize + recordSize
 		blockStats.RecordsCount++
+		return head, nil
 	} else {
 		if len(*currentBlock) > 0 {
 			blockStats.OccupancyRate = float64(blockStats.BytesUsed) / float64(blockStats.BytesTotal) * 100
@@ -92,61 +130,68 @@ func (vfs *VariableFragmentedStorage) writeFragmentedRecord(currentBlock *[]byte
 				vfs.stats.PartialBlocks++
 			}
 			vfs.stats.BlockStatsList = append(vfs.stats.BlockStatsList, *blockStats)
-			vfs.writeBlock(file, *currentBlock)
+			if err := bf.appendBlock(*currentBlock); err != nil {
+				return RecordID{}, err
+			}
 			vfs.stats.TotalBlocks++
 			vfs.stats.TotalBytesUsed += blockStats.BytesUsed
 			vfs.stats.TotalBytesTotal += blockStats.BytesTotal
+			*currentBlockNumber++
 		}
 
+		head := RecordID{Block: *currentBlockNumber, Slot: 0}
 		remainingData := recordData
-		headerSize := 5
 		isFirstChunk := true
 
 		for len(remainingData) > 0 {
 			*currentBlock = make([]byte, 0, vfs.blockSize)
-			*currentBlockNumber++
 			*blockStats = BlockStats{
 				BlockNumber: *currentBlockNumber,
 				BytesUsed:   0,
 				BytesTotal:  vfs.blockSize,
 			}
 
-			spaceAvailable := vfs.blockSize - headerSize
+			spaceAvailable := vfs.blockSize - fragmentHeaderSize
 			chunkSize := len(remainingData)
 			if chunkSize > spaceAvailable {
 				chunkSize = spaceAvailable
 			}
 
-			continuationFlag := byte(1)
-			if len(remainingData) <= spaceAvailable {
-				continuationFlag = byte(0)
+			flags := byte(0)
+			if len(remainingData) > spaceAvailable {
+				flags |= chunkHasNext
+			}
+			if !isFirstChunk {
+				flags |= chunkIsContinuation
 			}
 
-			*currentBlock = append(*currentBlock, continuationFlag)
-
-			sizeBytes := make([]byte, 4)
-			binary.LittleEndian.PutUint32(sizeBytes, uint32(chunkSize))
-			*currentBlock = append(*currentBlock, sizeBytes...)
-
+			*currentBlock = append(*currentBlock, vfs.chunkHeader(flags, chunkSize)...)
 			*currentBlock = append(*currentBlock, remainingData[:chunkSize]...)
-			blockStats.BytesUsed += headerSize + chunkSize
+			blockStats.BytesUsed += fragmentHeaderSize + chunkSize
 			if isFirstChunk {
 				blockStats.RecordsCount++
 				isFirstChunk = false
 			}
 
 			remainingData = remainingData[chunkSize:]
+			if len(remainingData) == 0 {
+				break
+			}
 
 			blockStats.OccupancyRate = float64(blockStats.BytesUsed) / float64(blockStats.BytesTotal) * 100
 			if blockStats.OccupancyRate < 100 {
 				vfs.stats.PartialBlocks++
 			}
 			vfs.stats.BlockStatsList = append(vfs.stats.BlockStatsList, *blockStats)
-			vfs.writeBlock(file, *currentBlock)
+			if err := bf.appendBlock(*currentBlock); err != nil {
+				return RecordID{}, err
+			}
 			vfs.stats.TotalBlocks++
 			vfs.stats.TotalBytesUsed += blockStats.BytesUsed
 			vfs.stats.TotalBytesTotal += blockStats.BytesTotal
+			*currentBlockNumber++
 		}
+		return head, nil
 	}
 }
 
@@ -189,18 +234,12 @@ func (vfs *VariableFragmentedStorage) serializeStudent(student entity.Student) [
 	data = append(data, anoBytes...)
 
 	caBytes := make([]byte, 8)
-	binary.LittleEndian.PutUint64(caBytes, uint64(student.CA*100))
+	binary.LittleEndian.PutUint64(caBytes, uint64(caCents(student.CA)))
 	data = append(data, caBytes...)
 
 	return data
 }
 
-func (vfs *VariableFragmentedStorage) writeBlock(file *os.File, block []byte) {
-	paddedBlock := make([]byte, vfs.blockSize)
-	copy(paddedBlock, block)
-	file.Write(paddedBlock)
-}
-
 func (vfs *VariableFragmentedStorage) calculateFinalStats() {
 	if vfs.stats.TotalBytesTotal > 0 {
 		vfs.stats.EfficiencyRate = float64(vfs.stats.TotalBytesUsed) / float64(vfs.stats.TotalBytesTotal) * 100
@@ -213,58 +252,41 @@ func (vfs *VariableFragmentedStorage) GetStats(filename string) StorageStats {
 }
 
 func (vfs *VariableFragmentedStorage) recalculateStatsFromFile(filename string) {
-	fileInfo, err := os.Stat(filename)
+	bf, err := openBlockFile(filename, ModeVariableFragmented, vfs.blockSize, false, false)
 	if err != nil {
 		return
 	}
+	defer bf.Close()
 
-	totalBlocks := int(fileInfo.Size()) / vfs.blockSize
+	totalBlocks := bf.totalBlocks()
 	vfs.stats = StorageStats{
 		TotalBlocks:     totalBlocks,
 		TotalBytesTotal: totalBlocks * vfs.blockSize,
 		BlockStatsList:  make([]BlockStats, 0),
 	}
 
-	file, err := os.Open(filename)
-	if err != nil {
-		return
-	}
-	defer file.Close()
-
 	totalUsed := 0
 	for blockNum := 0; blockNum < totalBlocks; blockNum++ {
-		block := make([]byte, vfs.blockSize)
-		_, err := file.ReadAt(block, int64(blockNum*vfs.blockSize))
+		block, err := bf.readBlock(blockNum)
 		if err != nil {
 			continue
 		}
 
 		bytesUsed := 0
+		deadBytes := 0
 		recordsCount := 0
-		offset := 0
-		for offset < vfs.blockSize {
-			if offset+5 > vfs.blockSize {
-				break
-			}
-
-			continuationFlag := block[offset]
-			chunkSizeBytes := block[offset+1 : offset+5]
-			chunkSize := int(binary.LittleEndian.Uint32(chunkSizeBytes))
-
-			if offset+5+chunkSize > vfs.blockSize {
-				break
+		tombstones := 0
+		for _, chunk := range vfs.blockChunks(block, blockNum) {
+			bytesUsed += fragmentHeaderSize + chunk.size
+			if chunk.status == StatusDeleted {
+				deadBytes += fragmentHeaderSize + chunk.size
+				if chunk.flags&chunkIsContinuation == 0 {
+					tombstones++
+				}
 			}
-
-			bytesUsed += 5 + chunkSize
-			if continuationFlag == 0 {
+			if chunk.flags&chunkIsContinuation == 0 && chunk.status == StatusActive {
 				recordsCount++
 			}
-
-			if continuationFlag == 0 {
-				offset += 5 + chunkSize
-			} else {
-				offset = vfs.blockSize
-			}
 		}
 
 		totalUsed += bytesUsed
@@ -276,7 +298,12 @@ func (vfs *VariableFragmentedStorage) recalculateStatsFromFile(filename string)
 			BytesTotal:    vfs.blockSize,
 			OccupancyRate: occupancyRate,
 			RecordsCount:  recordsCount,
+			LiveBytes:     bytesUsed - deadBytes,
+			DeadBytes:     deadBytes,
 		}
+		vfs.stats.TotalLiveBytes += blockStats.LiveBytes
+		vfs.stats.TotalDeadBytes += blockStats.DeadBytes
+		vfs.stats.TotalTombstones += tombstones
 
 		if occupancyRate < 100 && occupancyRate > 0 {
 			vfs.stats.PartialBlocks++
@@ -291,97 +318,159 @@ func (vfs *VariableFragmentedStorage) recalculateStatsFromFile(filename string)
 	}
 }
 
-func (vfs *VariableFragmentedStorage) GetBlockSize() int {
-	return vfs.blockSize
-}
+// blockChunks lista os pedaços gravados em um bloco, parando no primeiro espaço vazio
+func (vfs *VariableFragmentedStorage) blockChunks(block []byte, blockNum int) []fragmentChunk {
+	chunks := make([]fragmentChunk, 0)
+	offset := 0
+	for offset+fragmentHeaderSize <= vfs.blockSize {
+		chunkSize := int(binary.LittleEndian.Uint32(block[offset+2 : offset+6]))
+		if chunkSize == 0 || offset+fragmentHeaderSize+chunkSize > vfs.blockSize {
+			break
+		}
 
-func (vfs *VariableFragmentedStorage) FindStudentByMatricula(filename string, matricula int) (*entity.Student, error) {
-	file, err := os.Open(filename)
-	if err != nil {
-		return nil, fmt.Errorf("erro ao abrir arquivo: %w", err)
+		chunks = append(chunks, fragmentChunk{
+			blockNum: blockNum,
+			offset:   offset,
+			flags:    block[offset],
+			status:   block[offset+1],
+			size:     chunkSize,
+		})
+		offset += fragmentHeaderSize + chunkSize
 	}
-	defer file.Close()
+	return chunks
+}
 
-	fileInfo, err := file.Stat()
-	if err != nil {
-		return nil, fmt.Errorf("erro ao obter informações do arquivo: %w", err)
+// readChain segue a cadeia de pedaços a partir do pedaço inicial, devolvendo os dados concatenados
+func (vfs *VariableFragmentedStorage) readChain(bf *blockFile, totalBlocks int, block []byte, head fragmentChunk) ([]byte, []fragmentChunk) {
+	recordData := make([]byte, head.size)
+	copy(recordData, block[head.offset+fragmentHeaderSize:head.offset+fragmentHeaderSize+head.size])
+	chain := []fragmentChunk{head}
+
+	current := head
+	for current.flags&chunkHasNext != 0 {
+		nextBlockNum := current.blockNum + 1
+		if nextBlockNum >= totalBlocks {
+			break
+		}
+
+		nextBlock, err := bf.readBlock(nextBlockNum)
+		if err != nil {
+			break
+		}
+
+		nextChunks := vfs.blockChunks(nextBlock, nextBlockNum)
+		if len(nextChunks) == 0 || nextChunks[0].flags&chunkIsContinuation == 0 {
+			break
+		}
+
+		current = nextChunks[0]
+		recordData = append(recordData, nextBlock[fragmentHeaderSize:fragmentHeaderSize+current.size]...)
+		chain = append(chain, current)
 	}
 
-	totalBlocks := int(fileInfo.Size()) / vfs.blockSize
-	return vfs.findStudentFragmented(file, totalBlocks, matricula)
+	return recordData, chain
 }
 
-func (vfs *VariableFragmentedStorage) findStudentFragmented(file *os.File, totalBlocks int, matricula int) (*entity.Student, error) {
+// scanRecords percorre todas as cadeias ativas do arquivo; fn retorna false para interromper
+func (vfs *VariableFragmentedStorage) scanRecords(bf *blockFile, totalBlocks int, fn func(recordData []byte, chain []fragmentChunk) bool) {
 	for blockNum := 0; blockNum < totalBlocks; blockNum++ {
-		block := make([]byte, vfs.blockSize)
-		_, err := file.ReadAt(block, int64(blockNum*vfs.blockSize))
+		block, err := bf.readBlock(blockNum)
 		if err != nil {
 			continue
 		}
 
-		offset := 0
-		for offset < vfs.blockSize {
-			if offset+5 > vfs.blockSize {
-				break
+		for _, chunk := range vfs.blockChunks(block, blockNum) {
+			if chunk.flags&chunkIsContinuation != 0 || chunk.status != StatusActive {
+				continue
 			}
 
-			continuationFlag := block[offset]
-			chunkSizeBytes := block[offset+1 : offset+5]
-			chunkSize := int(binary.LittleEndian.Uint32(chunkSizeBytes))
-
-			if offset+5+chunkSize > vfs.blockSize {
-				break
+			recordData, chain := vfs.readChain(bf, totalBlocks, block, chunk)
+			if !fn(recordData, chain) {
+				return
 			}
+		}
+	}
+}
+
+func (vfs *VariableFragmentedStorage) GetBlockSize() int {
+	return vfs.blockSize
+}
 
-			chunkData := make([]byte, chunkSize)
-			copy(chunkData, block[offset+5:offset+5+chunkSize])
+// SetReorganizeBackup define se Reorganize preserva o arquivo original em _backup.dat
+func (vfs *VariableFragmentedStorage) SetReorganizeBackup(keep bool) {
+	vfs.keepBackup = keep
+}
 
-			recordData := chunkData
-			currentBlockNum := blockNum
-			currentContFlag := continuationFlag
+// FindStudentByCPF percorre o arquivo; IndexedStorage usa o índice de CPF
+func (vfs *VariableFragmentedStorage) FindStudentByCPF(filename string, cpf string) (*entity.Student, error) {
+	return scanForCPF(vfs, filename, cpf)
+}
 
-			for currentContFlag == 1 {
-				currentBlockNum++
-				if currentBlockNum >= totalBlocks {
-					break
-				}
+// FindStudentsByCurso percorre o arquivo; IndexedStorage usa o índice de curso
+func (vfs *VariableFragmentedStorage) FindStudentsByCurso(filename string, curso string) ([]*entity.Student, error) {
+	return scanStudentsWhere(vfs, filename, sameCurso(curso))
+}
 
-				nextBlock := make([]byte, vfs.blockSize)
-				_, err := file.ReadAt(nextBlock, int64(currentBlockNum*vfs.blockSize))
-				if err != nil {
-					break
-				}
+// FindStudentsByAnoIngresso percorre o arquivo; IndexedStorage usa o índice de ano de ingresso
+func (vfs *VariableFragmentedStorage) FindStudentsByAnoIngresso(filename string, ano int) ([]*entity.Student, error) {
+	return scanStudentsWhere(vfs, filename, sameAnoIngresso(ano))
+}
 
-				nextContFlag := nextBlock[0]
-				nextChunkSizeBytes := nextBlock[1:5]
-				nextChunkSize := int(binary.LittleEndian.Uint32(nextChunkSizeBytes))
+// ScanStudentsByCA percorre o arquivo e entrega os alunos com CA entre min e max em ordem de CA
+func (vfs *VariableFragmentedStorage) ScanStudentsByCA(filename string, min float64, max float64, fn func(student *entity.Student) bool) error {
+	return scanByCA(vfs, filename, min, max, fn)
+}
 
-				if 5+nextChunkSize <= vfs.blockSize {
-					recordData = append(recordData, nextBlock[5:5+nextChunkSize]...)
-				}
+// ScanStudentsByAnoIngresso percorre o arquivo e entrega os alunos com ano de ingresso entre
+// min e max em ordem de ano
+func (vfs *VariableFragmentedStorage) ScanStudentsByAnoIngresso(filename string, min int, max int, fn func(student *entity.Student) bool) error {
+	return scanByAnoIngresso(vfs, filename, min, max, fn)
+}
 
-				currentContFlag = nextContFlag
-			}
+func (vfs *VariableFragmentedStorage) FindStudentByMatricula(filename string, matricula int) (*entity.Student, error) {
+	bf, err := openBlockFile(filename, ModeVariableFragmented, vfs.blockSize, false, false)
+	if err != nil {
+		return nil, err
+	}
+	defer bf.Close()
 
-			if len(recordData) >= 4 {
-				readMatricula := int(binary.LittleEndian.Uint32(recordData[:4]))
-				if readMatricula == matricula {
-					student, err := vfs.deserializeStudent(recordData)
-					if err == nil {
-						return student, nil
-					}
-				}
-			}
+	totalBlocks := bf.totalBlocks()
+	return vfs.findStudentFragmented(bf, totalBlocks, matricula)
+}
 
-			if continuationFlag == 0 {
-				offset += 5 + chunkSize
-			} else {
-				offset = vfs.blockSize
+func (vfs *VariableFragmentedStorage) findStudentFragmented(bf *blockFile, totalBlocks int, matricula int) (*entity.Student, error) {
+	var found *entity.Student
+	vfs.scanRecords(bf, totalBlocks, func(recordData []byte, chain []fragmentChunk) bool {
+		if len(recordData) >= 4 && int(binary.LittleEndian.Uint32(recordData[:4])) == matricula {
+			student, err := vfs.deserializeStudent(recordData)
+			if err == nil {
+				found = student
+				return false
 			}
 		}
+		return true
+	})
+
+	if found == nil {
+		return nil, fmt.Errorf("aluno com matrícula %d não encontrado", matricula)
 	}
+	return found, nil
+}
+
+func (vfs *VariableFragmentedStorage) findChain(bf *blockFile, totalBlocks int, matricula int) ([]fragmentChunk, error) {
+	var found []fragmentChunk
+	vfs.scanRecords(bf, totalBlocks, func(recordData []byte, chain []fragmentChunk) bool {
+		if len(recordData) >= 4 && int(binary.LittleEndian.Uint32(recordData[:4])) == matricula {
+			found = chain
+			return false
+		}
+		return true
+	})
 
-	return nil, fmt.Errorf("aluno com matrícula %d não encontrado", matricula)
+	if found == nil {
+		return nil, fmt.Errorf("aluno com matrícula %d não encontrado", matricula)
+	}
+	return found, nil
 }
 
 func (vfs *VariableFragmentedStorage) deserializeStudent(data []byte) (*entity.Student, error) {
@@ -481,107 +570,340 @@ func (vfs *VariableFragmentedStorage) deserializeStudent(data []byte) (*entity.S
 }
 
 func (vfs *VariableFragmentedStorage) GetAllStudents(filename string) ([]*entity.Student, error) {
-	file, err := os.Open(filename)
+	bf, err := openBlockFile(filename, ModeVariableFragmented, vfs.blockSize, false, false)
 	if err != nil {
-		return nil, fmt.Errorf("erro ao abrir arquivo: %w", err)
+		return nil, err
 	}
-	defer file.Close()
+	defer bf.Close()
+
+	totalBlocks := bf.totalBlocks()
+	students := make([]*entity.Student, 0)
+
+	vfs.scanRecords(bf, totalBlocks, func(recordData []byte, chain []fragmentChunk) bool {
+		if len(recordData) >= 4 {
+			student, err := vfs.deserializeStudent(recordData)
+			if err == nil && student.Matricula > 0 {
+				students = append(students, student)
+			}
+		}
+		return true
+	})
 
-	fileInfo, err := file.Stat()
+	return students, nil
+}
+
+// AddStudents continua a partir do espaço livre no final do último bloco,
+// gravando apenas os blocos alterados
+func (vfs *VariableFragmentedStorage) AddStudents(filename string, students []entity.Student) (err error) {
+	if err := checkNewMatriculas(vfs, filename, students); err != nil {
+		return err
+	}
+	_, err = vfs.insertRecords(filename, students)
+	return err
+}
+
+// insertRecords grava o lote com uma única abertura do arquivo, sem verificar as matrículas
+func (vfs *VariableFragmentedStorage) insertRecords(filename string, students []entity.Student) (_ []RecordID, err error) {
+	bf, err := openBlockFile(filename, ModeVariableFragmented, vfs.blockSize, true, true)
 	if err != nil {
-		return nil, fmt.Errorf("erro ao obter informações do arquivo: %w", err)
+		return nil, err
 	}
+	defer closeBlockFile(bf, &err)
 
-	totalBlocks := int(fileInfo.Size()) / vfs.blockSize
-	students := make([]*entity.Student, 0)
+	records := make([][]byte, len(students))
+	for i, student := range students {
+		records[i] = vfs.serializeStudent(student)
+	}
 
-	for blockNum := 0; blockNum < totalBlocks; blockNum++ {
-		block := make([]byte, vfs.blockSize)
-		_, err := file.ReadAt(block, int64(blockNum*vfs.blockSize))
-		if err != nil {
+	rids, err := vfs.appendRecords(bf, bf.totalBlocks(), records)
+	if err != nil {
+		return nil, err
+	}
+
+	bf.addRecordCount(len(records))
+	return rids, nil
+}
+
+func (vfs *VariableFragmentedStorage) InsertStudent(filename string, student entity.Student) (RecordID, error) {
+	if err := checkNewMatriculas(vfs, filename, []entity.Student{student}); err != nil {
+		return RecordID{}, err
+	}
+
+	rids, err := vfs.insertRecords(filename, []entity.Student{student})
+	if err != nil {
+		return RecordID{}, err
+	}
+	return rids[0], nil
+}
+
+func (vfs *VariableFragmentedStorage) ScanStudents(filename string, fn func(rid RecordID, student *entity.Student) bool) error {
+	bf, err := openBlockFile(filename, ModeVariableFragmented, vfs.blockSize, false, false)
+	if err != nil {
+		return err
+	}
+	defer bf.Close()
+
+	vfs.scanRecords(bf, bf.totalBlocks(), func(recordData []byte, chain []fragmentChunk) bool {
+		student, err := vfs.deserializeStudent(recordData)
+		if err != nil || student.Matricula <= 0 {
+			return true
+		}
+		return fn(RecordID{Block: chain[0].blockNum, Slot: chain[0].offset}, student)
+	})
+	return nil
+}
+
+// chainAt devolve a cadeia cujo pedaço inicial está em rid
+func (vfs *VariableFragmentedStorage) chainAt(bf *blockFile, rid RecordID) ([]byte, []fragmentChunk, error) {
+	totalBlocks := bf.totalBlocks()
+	if rid.Block < 0 || rid.Block >= totalBlocks {
+		return nil, nil, fmt.Errorf("%w: %s", ErrRecordNotFound, rid)
+	}
+
+	block, err := bf.readBlock(rid.Block)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for _, chunk := range vfs.blockChunks(block, rid.Block) {
+		if chunk.offset != rid.Slot {
 			continue
 		}
+		if chunk.flags&chunkIsContinuation != 0 || chunk.status != StatusActive {
+			break
+		}
+		recordData, chain := vfs.readChain(bf, totalBlocks, block, chunk)
+		return recordData, chain, nil
+	}
+	return nil, nil, fmt.Errorf("%w: %s", ErrRecordNotFound, rid)
+}
 
-		offset := 0
-		for offset < vfs.blockSize {
-			if offset+5 > vfs.blockSize {
-				break
-			}
+func (vfs *VariableFragmentedStorage) GetByRID(filename string, rid RecordID) (*entity.Student, error) {
+	bf, err := openBlockFile(filename, ModeVariableFragmented, vfs.blockSize, false, false)
+	if err != nil {
+		return nil, err
+	}
+	defer bf.Close()
 
-			continuationFlag := block[offset]
-			chunkSizeBytes := block[offset+1 : offset+5]
-			chunkSize := int(binary.LittleEndian.Uint32(chunkSizeBytes))
+	recordData, _, err := vfs.chainAt(bf, rid)
+	if err != nil {
+		return nil, err
+	}
+	return vfs.deserializeStudent(recordData)
+}
 
-			if offset+5+chunkSize > vfs.blockSize {
-				break
-			}
+// UpdateByRID devolve o novo RecordID quando o registro precisa ser realocado
+func (vfs *VariableFragmentedStorage) UpdateByRID(filename string, rid RecordID, student entity.Student) (RecordID, error) {
+	if err := checkUpdatedMatricula(vfs, filename, rid, student); err != nil {
+		return RecordID{}, err
+	}
+	return vfs.updateRecord(filename, rid, student)
+}
 
-			chunkData := make([]byte, chunkSize)
-			copy(chunkData, block[offset+5:offset+5+chunkSize])
+// updateRecord é o UpdateByRID sem a verificação de matrícula
+func (vfs *VariableFragmentedStorage) updateRecord(filename string, rid RecordID, student entity.Student) (_ RecordID, err error) {
+	bf, err := openBlockFile(filename, ModeVariableFragmented, vfs.blockSize, true, false)
+	if err != nil {
+		return RecordID{}, err
+	}
+	defer closeBlockFile(bf, &err)
 
-			recordData := chunkData
-			currentBlockNum := blockNum
-			currentContFlag := continuationFlag
+	_, chain, err := vfs.chainAt(bf, rid)
+	if err != nil {
+		return RecordID{}, err
+	}
+	return vfs.rewriteChain(bf, chain, vfs.serializeStudent(student))
+}
 
-			for currentContFlag == 1 {
-				currentBlockNum++
-				if currentBlockNum >= totalBlocks {
-					break
-				}
+func (vfs *VariableFragmentedStorage) DeleteByRID(filename string, rid RecordID) (err error) {
+	bf, err := openBlockFile(filename, ModeVariableFragmented, vfs.blockSize, true, false)
+	if err != nil {
+		return err
+	}
+	defer closeBlockFile(bf, &err)
 
-				nextBlock := make([]byte, vfs.blockSize)
-				_, err := file.ReadAt(nextBlock, int64(currentBlockNum*vfs.blockSize))
-				if err != nil {
-					break
-				}
+	_, chain, err := vfs.chainAt(bf, rid)
+	if err != nil {
+		return err
+	}
 
-				nextContFlag := nextBlock[0]
-				nextChunkSizeBytes := nextBlock[1:5]
-				nextChunkSize := int(binary.LittleEndian.Uint32(nextChunkSizeBytes))
+	if err := vfs.markChain(bf, chain, StatusDeleted); err != nil {
+		return err
+	}
+	bf.addRecordCount(-1)
+	return nil
+}
 
-				if 5+nextChunkSize <= vfs.blockSize {
-					recordData = append(recordData, nextBlock[5:5+nextChunkSize]...)
-				}
+// UpdateStudent regrava a cadeia no lugar quando o novo registro cabe nos pedaços
+// existentes; caso contrário, a cadeia é removida e o registro realocado no final
+func (vfs *VariableFragmentedStorage) UpdateStudent(filename string, updatedStudent entity.Student) (err error) {
+	bf, err := openBlockFile(filename, ModeVariableFragmented, vfs.blockSize, true, false)
+	if err != nil {
+		return err
+	}
+	defer closeBlockFile(bf, &err)
 
-				currentContFlag = nextContFlag
-			}
+	totalBlocks := bf.totalBlocks()
+	chain, err := vfs.findChain(bf, totalBlocks, updatedStudent.Matricula)
+	if err != nil {
+		return err
+	}
 
-			if len(recordData) >= 4 {
-				student, err := vfs.deserializeStudent(recordData)
-				if err == nil && student.Matricula > 0 {
-					students = append(students, student)
-				}
-			}
+	_, err = vfs.rewriteChain(bf, chain, vfs.serializeStudent(updatedStudent))
+	return err
+}
+
+// rewriteChain regrava o registro nos pedaços da cadeia ou, se não couber, remove a cadeia
+// e acrescenta o registro no final; devolve a posição resultante
+func (vfs *VariableFragmentedStorage) rewriteChain(bf *blockFile, chain []fragmentChunk, recordData []byte) (RecordID, error) {
+	capacity := 0
+	for _, chunk := range chain {
+		capacity += chunk.size
+	}
 
-			if continuationFlag == 0 {
-				offset += 5 + chunkSize
-			} else {
-				offset = vfs.blockSize
+	if len(recordData) <= capacity {
+		padded := make([]byte, capacity)
+		copy(padded, recordData)
+
+		for _, chunk := range chain {
+			if err := bf.writeAt(chunk.blockNum, chunk.offset+fragmentHeaderSize, padded[:chunk.size]); err != nil {
+				return RecordID{}, err
 			}
+			padded = padded[chunk.size:]
 		}
+		return RecordID{Block: chain[0].blockNum, Slot: chain[0].offset}, nil
 	}
 
-	return students, nil
-}
+	if err := vfs.markChain(bf, chain, StatusDeleted); err != nil {
+		return RecordID{}, err
+	}
 
-func (vfs *VariableFragmentedStorage) AddStudents(filename string, students []entity.Student) error {
-	existingStudents, err := vfs.GetAllStudents(filename)
+	rids, err := vfs.appendRecords(bf, bf.totalBlocks(), [][]byte{recordData})
 	if err != nil {
-		return fmt.Errorf("erro ao ler alunos existentes: %w", err)
+		return RecordID{}, err
 	}
+	return rids[0], nil
+}
 
-	allStudents := make([]entity.Student, len(existingStudents))
-	for i, s := range existingStudents {
-		allStudents[i] = *s
+func (vfs *VariableFragmentedStorage) DeleteStudent(filename string, matricula int) (err error) {
+	bf, err := openBlockFile(filename, ModeVariableFragmented, vfs.blockSize, true, false)
+	if err != nil {
+		return err
 	}
+	defer closeBlockFile(bf, &err)
 
-	allStudents = append(allStudents, students...)
-
-	err = vfs.WriteStudents(filename, allStudents)
+	totalBlocks := bf.totalBlocks()
+	chain, err := vfs.findChain(bf, totalBlocks, matricula)
 	if err != nil {
+		return fmt.Errorf("aluno não encontrado")
+	}
+
+	if err := vfs.markChain(bf, chain, StatusDeleted); err != nil {
 		return err
 	}
 
-	vfs.calculateFinalStats()
+	bf.addRecordCount(-1)
 	return nil
 }
+
+// markChain grava o status em todos os pedaços da cadeia
+func (vfs *VariableFragmentedStorage) markChain(bf *blockFile, chain []fragmentChunk, status byte) error {
+	for _, chunk := range chain {
+		if err := bf.writeAt(chunk.blockNum, chunk.offset+1, []byte{status}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// appendRecords reabre o último bloco e grava os registros a partir do seu espaço livre,
+// devolvendo a posição de cada um
+func (vfs *VariableFragmentedStorage) appendRecords(bf *blockFile, totalBlocks int, records [][]byte) ([]RecordID, error) {
+	if len(records) == 0 {
+		return nil, nil
+	}
+
+	currentBlock := make([]byte, 0, vfs.blockSize)
+	currentBlockNumber := totalBlocks
+
+	if totalBlocks > 0 {
+		lastBlock, err := bf.readBlock(totalBlocks - 1)
+		if err != nil {
+			return nil, fmt.Errorf("erro ao ler último bloco: %w", err)
+		}
+
+		end := 0
+		for _, chunk := range vfs.blockChunks(lastBlock, totalBlocks-1) {
+			end = chunk.offset + fragmentHeaderSize + chunk.size
+		}
+
+		if end+fragmentHeaderSize < vfs.blockSize {
+			currentBlock = append(currentBlock, lastBlock[:end]...)
+			currentBlockNumber = totalBlocks - 1
+		}
+	}
+
+	if err := bf.seekBlock(currentBlockNumber); err != nil {
+		return nil, err
+	}
+
+	blockStats := BlockStats{
+		BlockNumber: currentBlockNumber,
+		BytesUsed:   len(currentBlock),
+		BytesTotal:  vfs.blockSize,
+	}
+
+	rids := make([]RecordID, len(records))
+	for i, recordData := range records {
+		rid, err := vfs.writeFragmentedRecord(&currentBlock, &currentBlockNumber, &blockStats, recordData, bf, i == len(records)-1)
+		if err != nil {
+			return nil, err
+		}
+		rids[i] = rid
+	}
+
+	if len(currentBlock) > 0 {
+		if err := bf.appendBlock(currentBlock); err != nil {
+			return nil, err
+		}
+	}
+	return rids, nil
+}
+
+// Reorganize: Compactação física, reconstruindo as cadeias de forma contígua
+func (vfs *VariableFragmentedStorage) Reorganize(filename string) (*ReorganizationReport, error) {
+	statsBefore := vfs.GetStats(filename)
+
+	students, err := vfs.GetAllStudents(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	tempFilename := temporaryFilename(filename)
+
+	tempStorage, err := NewVariableFragmentedStorage(vfs.blockSize)
+	if err != nil {
+		return nil, err
+	}
+
+	studentsValue := make([]entity.Student, len(students))
+	for i, s := range students {
+		studentsValue[i] = *s
+	}
+
+	err = tempStorage.WriteStudents(tempFilename, studentsValue)
+	if err != nil {
+		removeTemporaryFiles(tempFilename)
+		return nil, err
+	}
+
+	backup, err := replaceFile(tempFilename, filename, vfs.keepBackup, indexExtensions...)
+	if err != nil {
+		return nil, err
+	}
+
+	statsAfter := vfs.GetStats(filename)
+	report := newReorganizationReport(statsBefore, statsAfter)
+	report.BackupFilename = backup
+	return report, nil
+}
@@ -0,0 +1,271 @@
+package storage
+
+import (
+	"aeds2-tp1/entity"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+)
+
+// IndexStatus é a situação do arquivo de um índice em relação ao arquivo de dados
+type IndexStatus int
+
+const (
+	IndexCurrent IndexStatus = iota
+	IndexStale
+	IndexAbsent
+	IndexInvalid
+)
+
+func (s IndexStatus) String() string {
+	switch s {
+	case IndexCurrent:
+		return "atualizado"
+	case IndexStale:
+		return "desatualizado (geração diferente do arquivo de dados)"
+	case IndexAbsent:
+		return "ausente"
+	case IndexInvalid:
+		return "inválido"
+	}
+	return fmt.Sprintf("situação desconhecida (%d)", int(s))
+}
+
+// IndexProblem é uma entrada do índice sem o registro correspondente (órfã) ou um registro
+// ativo sem a entrada correspondente (faltando)
+type IndexProblem struct {
+	Key    string
+	RID    RecordID
+	Reason string
+}
+
+// IndexCheck é o resultado da verificação de um índice. Duplicates conta os registros ativos
+// que não estão no índice único porque outro registro tem a mesma chave
+type IndexCheck struct {
+	Name       string
+	Filename   string
+	Status     IndexStatus
+	Entries    int
+	Orphans    []IndexProblem
+	Missing    []IndexProblem
+	Duplicates int
+}
+
+func (c *IndexCheck) Consistent() bool {
+	return c.Status == IndexCurrent && len(c.Orphans) == 0 && len(c.Missing) == 0
+}
+
+type IndexVerification struct {
+	Records int
+	Checks  []IndexCheck
+}
+
+func (v *IndexVerification) Consistent() bool {
+	for i := range v.Checks {
+		if !v.Checks[i].Consistent() {
+			return false
+		}
+	}
+	return true
+}
+
+// liveRecords guarda os registros ativos do arquivo de dados na ordem física
+type liveRecords struct {
+	rids     []RecordID
+	students map[RecordID]*entity.Student
+}
+
+// VerifyIndexes confere os arquivos de índice como estão em disco, sem reconstruí-los: cada
+// entrada deve apontar para um registro ativo com a mesma chave e cada registro ativo deve
+// ter sua entrada. Índices desatualizados também são conferidos, para mostrar a divergência
+func (s *IndexedStorage) VerifyIndexes(filename string) (*IndexVerification, error) {
+	header, err := ReadFileHeader(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	records := &liveRecords{students: make(map[RecordID]*entity.Student)}
+	err = s.Storage.ScanStudents(filename, func(rid RecordID, student *entity.Student) bool {
+		records.rids = append(records.rids, rid)
+		records.students[rid] = student
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	verification := &IndexVerification{Records: len(records.rids)}
+	matricula := func(_ RecordID, student *entity.Student) (int, error) { return student.Matricula, nil }
+	cpf := func(_ RecordID, student *entity.Student) (int, error) { return cpfKey(student.CPF), nil }
+	ca := func(rid RecordID, student *entity.Student) (int, error) { return caKey(student.CA, rid) }
+	curso := func(student *entity.Student) string { return cursoKey(student.Curso) }
+	ano := func(student *entity.Student) string { return anoKey(student.AnoIngresso) }
+
+	checks := []struct {
+		name   string
+		ext    string
+		open   func(indexFilename string) (dataIndex, error)
+		verify func(index dataIndex, result *IndexCheck) error
+	}{
+		{
+			name: fmt.Sprintf("primário, matrícula (%s)", s.kind),
+			ext:  s.kind.extension(),
+			open: func(indexFilename string) (dataIndex, error) {
+				return openPrimaryIndex(s.kind, filename, header.BlockSize)
+			},
+			verify: func(index dataIndex, result *IndexCheck) error {
+				return verifyUnique(result, index.(uniqueIndex), records, matricula, strconv.Itoa)
+			},
+		},
+		{
+			name: "CPF (árvore B+)",
+			ext:  cpfIndexExtension,
+			open: func(indexFilename string) (dataIndex, error) { return openBPlusTree(indexFilename, header.BlockSize) },
+			verify: func(index dataIndex, result *IndexCheck) error {
+				return verifyUnique(result, index.(uniqueIndex), records, cpf, formatCPFKey)
+			},
+		},
+		{
+			name: "curso (listas de RecordIDs)",
+			ext:  cursoIndexExtension,
+			open: func(indexFilename string) (dataIndex, error) {
+				return openPostingIndex(indexFilename, header.BlockSize)
+			},
+			verify: func(index dataIndex, result *IndexCheck) error {
+				return verifyPostings(result, index.(*postingIndex), records, curso)
+			},
+		},
+		{
+			name: "ano de ingresso (listas de RecordIDs)",
+			ext:  anoIndexExtension,
+			open: func(indexFilename string) (dataIndex, error) {
+				return openPostingIndex(indexFilename, header.BlockSize)
+			},
+			verify: func(index dataIndex, result *IndexCheck) error {
+				return verifyPostings(result, index.(*postingIndex), records, ano)
+			},
+		},
+		{
+			name: "CA (árvore B+)",
+			ext:  caIndexExtension,
+			open: func(indexFilename string) (dataIndex, error) { return openBPlusTree(indexFilename, header.BlockSize) },
+			verify: func(index dataIndex, result *IndexCheck) error {
+				return verifyUnique(result, index.(uniqueIndex), records, ca, formatCAKey)
+			},
+		},
+	}
+
+	for _, check := range checks {
+		result := IndexCheck{Name: check.name, Filename: companionFilename(filename, check.ext)}
+		index, err := check.open(result.Filename)
+		switch {
+		case errors.Is(err, os.ErrNotExist):
+			result.Status = IndexAbsent
+		case err != nil:
+			result.Status = IndexInvalid
+		default:
+			if index.dataGeneration() != header.Generation {
+				result.Status = IndexStale
+			}
+			err = check.verify(index, &result)
+			index.close()
+			if errors.Is(err, errInvalidIndex) {
+				result.Status = IndexInvalid
+			} else if err != nil {
+				return nil, err
+			}
+		}
+		verification.Checks = append(verification.Checks, result)
+	}
+	return verification, nil
+}
+
+// dataIndex é o que todo arquivo de índice expõe para a verificação
+type dataIndex interface {
+	dataGeneration() uint64
+	close() error
+}
+
+// verifyUnique confere um índice único; key calcula a chave que o registro deveria ter
+func verifyUnique(result *IndexCheck, index uniqueIndex, records *liveRecords, key func(rid RecordID, student *entity.Student) (int, error), format func(key int) string) error {
+	indexed := make(map[int]RecordID)
+	err := index.scan(func(k int, rid RecordID) bool {
+		result.Entries++
+		indexed[k] = rid
+		student, ok := records.students[rid]
+		if !ok {
+			result.Orphans = append(result.Orphans, IndexProblem{Key: format(k), RID: rid, Reason: "nenhum registro ativo no RecordID"})
+			return true
+		}
+		if expected, err := key(rid, student); err != nil || expected != k {
+			result.Orphans = append(result.Orphans, IndexProblem{Key: format(k), RID: rid,
+				Reason: fmt.Sprintf("o registro é do aluno de matrícula %d, com outra chave", student.Matricula)})
+		}
+		return true
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, rid := range records.rids {
+		student := records.students[rid]
+		k, err := key(rid, student)
+		if err != nil {
+			return err
+		}
+
+		current, ok := indexed[k]
+		if ok && current == rid {
+			continue
+		}
+		if other, found := records.students[current]; ok && found {
+			if expected, err := key(current, other); err == nil && expected == k {
+				result.Duplicates++
+				continue
+			}
+		}
+		result.Missing = append(result.Missing, IndexProblem{Key: format(k), RID: rid,
+			Reason: fmt.Sprintf("aluno de matrícula %d sem entrada no índice", student.Matricula)})
+	}
+	return nil
+}
+
+// verifyPostings confere um índice de listas de RecordIDs
+func verifyPostings(result *IndexCheck, index *postingIndex, records *liveRecords, key func(student *entity.Student) string) error {
+	indexed := make(map[postingEntry]bool)
+	for _, k := range index.keys() {
+		rids, err := index.list(k)
+		if err != nil {
+			return err
+		}
+		for _, rid := range rids {
+			result.Entries++
+			indexed[postingEntry{key: k, rid: rid}] = true
+			student, ok := records.students[rid]
+			if !ok {
+				result.Orphans = append(result.Orphans, IndexProblem{Key: k, RID: rid, Reason: "nenhum registro ativo no RecordID"})
+			} else if key(student) != k {
+				result.Orphans = append(result.Orphans, IndexProblem{Key: k, RID: rid,
+					Reason: fmt.Sprintf("o aluno de matrícula %d tem o valor %q", student.Matricula, key(student))})
+			}
+		}
+	}
+
+	for _, rid := range records.rids {
+		student := records.students[rid]
+		if !indexed[postingEntry{key: key(student), rid: rid}] {
+			result.Missing = append(result.Missing, IndexProblem{Key: key(student), RID: rid,
+				Reason: fmt.Sprintf("aluno de matrícula %d sem entrada no índice", student.Matricula)})
+		}
+	}
+	return nil
+}
+
+func formatCAKey(key int) string {
+	return fmt.Sprintf("%.2f", float64(key>>(caBlockBits+caSlotBits))/100)
+}
+
+func formatCPFKey(key int) string {
+	return fmt.Sprintf("%011d", key)
+}
@@ -0,0 +1,170 @@
+package storage
+
+import (
+	"aeds2-tp1/domain"
+	"aeds2-tp1/entity"
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// indexChecks indexa a verificação pela extensão do arquivo de cada índice
+func indexChecks(t *testing.T, s *IndexedStorage, filename string) map[string]IndexCheck {
+	t.Helper()
+	verification, err := s.VerifyIndexes(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checks := make(map[string]IndexCheck)
+	for _, check := range verification.Checks {
+		checks[filepath.Ext(check.Filename)] = check
+	}
+	return checks
+}
+
+func TestVerifyIndexesFindsChangesMadeWithoutIndexes(t *testing.T) {
+	for _, kind := range IndexKinds {
+		fs, err := NewFixedStorage(1024)
+		if err != nil {
+			t.Fatal(err)
+		}
+		s := NewIndexedStorage(fs)
+		s.SetIndexKind(kind)
+		filename := filepath.Join(t.TempDir(), "alunos.dat")
+		generator := domain.NewStudentGenerator()
+		students := generator.Generate(100)
+		if err := s.WriteStudents(filename, students); err != nil {
+			t.Fatal(err)
+		}
+		checkIndexesConsistent(t, s, filename, len(students))
+		for ext, check := range indexChecks(t, s, filename) {
+			if check.Entries != len(students) {
+				t.Fatalf("%s: índice %s com %d entradas para %d alunos", kind, ext, check.Entries, len(students))
+			}
+		}
+
+		// Alterações feitas direto no armazenamento não passam pelos índices
+		generated, err := generator.GenerateFrom(100000101, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := fs.DeleteStudent(filename, students[5].Matricula); err != nil {
+			t.Fatal(err)
+		}
+		changed := students[6]
+		changed.CPF = generated[0].CPF
+		changed.Curso = "Curso Novo"
+		if err := fs.UpdateStudent(filename, changed); err != nil {
+			t.Fatal(err)
+		}
+		added := generated[1]
+		added.Curso, added.AnoIngresso, added.CA = "Outro Curso", 2001, 0.5
+		if _, err := fs.InsertStudent(filename, added); err != nil {
+			t.Fatal(err)
+		}
+
+		// Removido: entrada órfã em todos os índices; inserido: entrada faltando em todos;
+		// atualizado: troca de entrada só nos índices de CPF e curso
+		want := map[string][2]int{kind.extension(): {1, 1}, cpfIndexExtension: {2, 2}, cursoIndexExtension: {2, 2}, anoIndexExtension: {1, 1}, caIndexExtension: {1, 1}}
+		for i := 0; i < 2; i++ {
+			checks := indexChecks(t, s, filename)
+			for ext, counts := range want {
+				check := checks[ext]
+				if check.Status != IndexStale || len(check.Orphans) != counts[0] || len(check.Missing) != counts[1] || check.Duplicates != 0 {
+					t.Fatalf("%s: índice %s %s com %d órfãs e %d faltando, esperadas %v", kind, ext, check.Status, len(check.Orphans), len(check.Missing), counts)
+				}
+			}
+		}
+		if got := indexChecks(t, s, filename)[cpfIndexExtension]; got.Missing[0].Key != changed.CPF && got.Missing[1].Key != changed.CPF {
+			t.Fatalf("%s: CPF novo %s fora das entradas faltando %+v", kind, changed.CPF, got.Missing)
+		}
+
+		if err := s.RebuildIndex(filename); err != nil {
+			t.Fatal(err)
+		}
+		checkIndexesConsistent(t, s, filename, len(students))
+		if got, err := s.FindStudentByCPF(filename, changed.CPF); err != nil || got.Matricula != changed.Matricula {
+			t.Fatalf("%s: FindStudentByCPF após reconstruir: %v", kind, err)
+		}
+	}
+}
+
+func TestVerifyIndexesReportsAbsentAndInvalidFiles(t *testing.T) {
+	fs, err := NewFixedStorage(1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewIndexedStorage(fs)
+	filename := filepath.Join(t.TempDir(), "alunos.dat")
+	students := domain.NewStudentGenerator().Generate(100)
+	if err := s.WriteStudents(filename, students); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.Remove(companionFilename(filename, cursoIndexExtension)); err != nil {
+		t.Fatal(err)
+	}
+	garbage := bytes.Repeat([]byte{0xFF}, 3*1024)
+	if err := os.WriteFile(companionFilename(filename, caIndexExtension), garbage, 0644); err != nil {
+		t.Fatal(err)
+	}
+	for ext, check := range indexChecks(t, s, filename) {
+		want := IndexCurrent
+		switch ext {
+		case cursoIndexExtension:
+			want = IndexAbsent
+		case caIndexExtension:
+			want = IndexInvalid
+		}
+		if check.Status != want {
+			t.Fatalf("índice %s %s, esperado %s", ext, check.Status, want)
+		}
+	}
+
+	// A próxima operação refaz só os índices ausentes ou inválidos
+	got, err := s.FindStudentsByCurso(filename, students[0].Curso)
+	if err != nil || len(got) == 0 {
+		t.Fatalf("FindStudentsByCurso com o índice ausente: %d alunos, %v", len(got), err)
+	}
+	checkIndexesConsistent(t, s, filename, len(students))
+}
+
+func TestVerifyIndexesCountsLegacyDuplicates(t *testing.T) {
+	fs, err := NewFixedStorage(1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewIndexedStorage(fs)
+	filename := filepath.Join(t.TempDir(), "alunos.dat")
+	students := domain.NewStudentGenerator().Generate(50)
+	if err := s.WriteStudents(filename, students); err != nil {
+		t.Fatal(err)
+	}
+
+	// Matrícula e CPF repetidos de arquivos antigos ficam fora dos índices únicos, sem
+	// tornar o índice inconsistente
+	repeated := students[20]
+	repeated.Nome = "Cópia"
+	if _, err := fs.insertRecords(filename, []entity.Student{repeated}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.RebuildIndex(filename); err != nil {
+		t.Fatal(err)
+	}
+	checkIndexesConsistent(t, s, filename, len(students)+1)
+	checks := indexChecks(t, s, filename)
+	for _, ext := range []string{IndexBPlusTree.extension(), cpfIndexExtension} {
+		if checks[ext].Duplicates != 1 || checks[ext].Entries != len(students) {
+			t.Fatalf("índice %s com %d entradas e %d duplicados", ext, checks[ext].Entries, checks[ext].Duplicates)
+		}
+	}
+	if checks[cursoIndexExtension].Entries != len(students)+1 {
+		t.Fatalf("índice de curso com %d entradas", checks[cursoIndexExtension].Entries)
+	}
+
+	// O índice aponta para o último registro na ordem física
+	if got, err := s.FindStudentByMatricula(filename, repeated.Matricula); err != nil || got.Nome != repeated.Nome {
+		t.Fatalf("FindStudentByMatricula devolveu %+v, %v", got, err)
+	}
+}